@@ -11,10 +11,16 @@ import (
 	"syscall"
 	"time"
 
+	"wakeup/api/internal/account"
+	"wakeup/api/internal/auth"
 	"wakeup/api/internal/config"
 	"wakeup/api/internal/database"
+	"wakeup/api/internal/focus"
 	"wakeup/api/internal/handler"
+	"wakeup/api/internal/mail"
 	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/oauth"
+	"wakeup/api/internal/ratelimit"
 	"wakeup/api/internal/storage"
 	"wakeup/api/internal/ws"
 
@@ -30,6 +36,16 @@ func main() {
 
 	cfg := config.Load()
 
+	// Access token signing keys: HS256 with JWT_SECRET unless a key directory is configured
+	keys := auth.NewHMACKeySet(cfg.JWTSecret)
+	if cfg.JWTKeysDir != "" {
+		var err error
+		keys, err = auth.LoadKeySet(cfg.JWTKeysDir, cfg.JWTActiveKeyID, cfg.JWTSecret, cfg.JWTAcceptHS256)
+		if err != nil {
+			log.Fatalf("Failed to load JWT keys: %v", err)
+		}
+	}
+
 	// Connect to database
 	ctx := context.Background()
 	db, err := database.Connect(ctx, cfg.DatabaseURL)
@@ -48,10 +64,16 @@ func main() {
 		log.Printf("Warning: Could not connect to MinIO: %v", err)
 	}
 
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Create router
 	r := chi.NewRouter()
 
 	// Middleware
+	r.Use(middleware.RealIP(trustedProxies))
 	r.Use(chimiddleware.Logger)
 	r.Use(chimiddleware.Recoverer)
 	r.Use(chimiddleware.RequestID)
@@ -91,20 +113,73 @@ func main() {
 		json.NewEncoder(w).Encode(map[string]bool{"ok": true})
 	})
 
+	// Public verification keys so other services can validate access tokens
+	jwksHandler := handler.NewJWKSHandler(keys)
+	r.Get("/.well-known/jwks.json", jwksHandler.Get)
+
 	// Auth routes (only if database is connected)
 	if db != nil {
-		authHandler := handler.NewAuthHandler(db, cfg, minioClient)
+		// WebSocket hub
+		hub := ws.NewHub()
+		go hub.Run()
+
+		// Login throttling, shared across instances when backed by Postgres
+		limits := ratelimit.Limits{
+			ByIP:      ratelimit.NewMemoryLimiter(ratelimit.IPPolicy),
+			ByAccount: ratelimit.NewMemoryLimiter(ratelimit.AccountPolicy),
+		}
+		if cfg.RateLimitBackend == "postgres" {
+			ipLimiter := ratelimit.NewPostgresLimiter(db, ratelimit.IPPolicy)
+			limits = ratelimit.Limits{
+				ByIP:      ipLimiter,
+				ByAccount: ratelimit.NewPostgresLimiter(db, ratelimit.AccountPolicy),
+			}
+			go func() {
+				for range time.Tick(time.Hour) {
+					if err := ipLimiter.Prune(context.Background()); err != nil {
+						log.Printf("Failed to prune login throttles: %v", err)
+					}
+				}
+			}()
+		}
+
+		// Tracks focus goals and finalizes finished days and weeks
+		goalTracker := focus.NewGoalTracker(db, hub)
+		go goalTracker.Run(context.Background())
+
+		// Ends and advances timed focus sessions
+		go focus.NewScheduler(db, hub, goalTracker).Run(context.Background())
+
+		// Daily focus totals behind the friends leaderboard
+		go focus.NewLeaderboardRollup(db).Run(context.Background())
+
+		// Data exports and scheduled account deletions
+		go account.NewWorker(db, minioClient).Run(context.Background())
+
+		authHandler := handler.NewAuthHandler(db, cfg, minioClient, hub, mail.New(cfg), keys, limits)
 
 		r.Post("/auth/register", authHandler.Register)
 		r.Post("/auth/login", authHandler.Login)
+		r.Post("/auth/login/mfa", authHandler.LoginMFA)
 		r.Post("/auth/refresh", authHandler.Refresh)
 		r.Post("/auth/logout", authHandler.Logout)
 		r.Post("/auth/extension/exchange", authHandler.ExtensionExchange)
+		r.Post("/auth/verify-email", authHandler.VerifyEmail)
+		r.Post("/auth/forgot-password", authHandler.ForgotPassword)
+		r.Post("/auth/reset-password", authHandler.ResetPassword)
 
-		// WebSocket hub
-		hub := ws.NewHub()
-		go hub.Run()
-		wsHandler := ws.NewWSHandler(hub, cfg.JWTSecret)
+		// Social / OIDC login
+		oauthHandler := handler.NewOAuthHandler(authHandler, oauth.LoadProviders(cfg))
+		r.Get("/auth/oauth/providers", oauthHandler.Providers)
+		r.Post("/auth/oauth/{provider}/start", oauthHandler.Start)
+		r.Get("/auth/oauth/{provider}/callback", oauthHandler.Callback)
+		r.Post("/auth/oauth/exchange", oauthHandler.Exchange)
+
+		// Calendar feed (public - the secret token in the URL identifies the user)
+		feedHandler := handler.NewCalendarHandler(db, cfg.APIURL)
+		r.Get("/calendar/{token}.ics", feedHandler.Feed)
+
+		wsHandler := ws.NewWSHandler(hub, keys, db)
 		r.Get("/ws", wsHandler.Connect)
 
 		// Avatar proxy (public - no auth needed, URLs are in API responses)
@@ -113,27 +188,163 @@ func main() {
 			r.Get("/files/avatar", fileHandlerPublic.ServeAvatar)
 		}
 
-		// Protected routes
+		// Routes that personal access tokens can reach, each behind the scope it needs
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.AuthMiddleware(cfg.JWTSecret))
-			r.Get("/me", authHandler.Me)
+			r.Use(middleware.AuthMiddleware(keys, db))
+			r.With(middleware.RequireScope(auth.ScopeProfileRead)).Get("/me", authHandler.Me)
+
+			// Focus sessions
+			sessionHandler := handler.NewSessionHandler(db, hub, goalTracker)
+			goalHandler := handler.NewGoalHandler(db, goalTracker)
+			roomHandler := handler.NewRoomHandler(db, hub, goalTracker)
+			calendarHandler := handler.NewCalendarHandler(db, cfg.APIURL)
+			scheduleHandler := handler.NewScheduleHandler(db, hub)
+			leaderboardHandler := handler.NewLeaderboardHandler(db)
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(auth.ScopeFocusRead))
+				r.Get("/focus/sessions", sessionHandler.ListSessions)
+				r.Get("/focus/sessions/active", sessionHandler.GetActiveSession)
+				r.Get("/focus/stats", sessionHandler.Stats)
+				r.Get("/focus/goals", goalHandler.List)
+				r.Get("/focus/goals/history", goalHandler.History)
+				r.Get("/focus/rooms", roomHandler.List)
+				r.Get("/focus/rooms/{id}", roomHandler.Get)
+				r.Get("/focus/blocks", calendarHandler.ListBlocks)
+				r.Get("/focus/schedules", scheduleHandler.List)
+				r.Get("/focus/leaderboard", leaderboardHandler.Get)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(auth.ScopeFocusWrite))
+				r.Post("/focus/sessions/start", sessionHandler.StartSession)
+				r.Post("/focus/sessions/stop", sessionHandler.StopSession)
+				r.Post("/focus/sessions/pause", sessionHandler.PauseSession)
+				r.Post("/focus/sessions/resume", sessionHandler.ResumeSession)
+				r.Post("/focus/sessions/cancel", sessionHandler.CancelSession)
+				r.Post("/focus/sessions/sync", sessionHandler.SyncSessions)
+				r.Patch("/focus/sessions/{id}", sessionHandler.UpdateSession)
+				r.Put("/focus/goals", goalHandler.Upsert)
+				r.Delete("/focus/goals/{id}", goalHandler.Delete)
+				r.Post("/focus/rooms", roomHandler.Create)
+				r.Post("/focus/rooms/{id}/join", roomHandler.Join)
+				r.Post("/focus/rooms/{id}/leave", roomHandler.Leave)
+				r.Post("/focus/rooms/{id}/start", roomHandler.Start)
+				r.Post("/focus/rooms/{id}/end", roomHandler.End)
+				r.Post("/focus/blocks", calendarHandler.CreateBlock)
+				r.Delete("/focus/blocks/{id}", calendarHandler.DeleteBlock)
+				r.Post("/focus/calendar/import", calendarHandler.Import)
+				r.Post("/focus/schedules", scheduleHandler.Create)
+				r.Put("/focus/schedules/{id}", scheduleHandler.Update)
+				r.Delete("/focus/schedules/{id}", scheduleHandler.Delete)
+				r.Post("/focus/schedules/{id}/skip", scheduleHandler.Skip)
+				r.Delete("/focus/schedules/{id}/skip/{date}", scheduleHandler.Unskip)
+			})
+
+			// Block rules
+			blockRuleHandler := handler.NewBlockRuleHandler(db, hub)
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(auth.ScopeBlockRulesRead))
+				r.Get("/block-rules", blockRuleHandler.List)
+				r.Get("/block-rules/effective", blockRuleHandler.Effective)
+				r.Post("/block-rules/test", blockRuleHandler.Test)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(auth.ScopeBlockRulesWrite))
+				r.Post("/block-rules", blockRuleHandler.Create)
+				r.Patch("/block-rules/{id}", blockRuleHandler.Update)
+				r.Delete("/block-rules/{id}", blockRuleHandler.Delete)
+			})
+
+			// Block lists
+			blockListHandler := handler.NewBlockListHandler(db, hub)
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(auth.ScopeBlockRulesRead))
+				r.Get("/block-lists", blockListHandler.List)
+				r.Get("/block-lists/shared", blockListHandler.Shared)
+				r.Get("/block-lists/{id}", blockListHandler.Get)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireScope(auth.ScopeBlockRulesWrite))
+				r.Post("/block-lists", blockListHandler.Create)
+				r.Patch("/block-lists/{id}", blockListHandler.Update)
+				r.Delete("/block-lists/{id}", blockListHandler.Delete)
+				r.Put("/block-lists/{id}/nests/{nestId}", blockListHandler.Publish)
+				r.Delete("/block-lists/{id}/nests/{nestId}", blockListHandler.Unpublish)
+				r.Put("/block-lists/{id}/subscription", blockListHandler.Subscribe)
+				r.Delete("/block-lists/{id}/subscription", blockListHandler.Unsubscribe)
+			})
+
+			// Conversations (DMs and groups)
+			conversationHandler := handler.NewConversationHandler(db)
+			messageHandler := handler.NewMessageHandler(db)
+			r.Route("/conversations", func(r chi.Router) {
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(auth.ScopeMessagesRead))
+					r.Get("/", conversationHandler.List)
+					r.Get("/{id}", conversationHandler.Get)
+					r.Get("/{id}/messages", messageHandler.ListMessages)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(auth.ScopeMessagesSend))
+					r.Post("/", conversationHandler.CreateDM)
+					r.Post("/group", conversationHandler.CreateGroup)
+					r.Post("/{id}/messages", messageHandler.SendMessage)
+				})
+			})
+
+			// Channel messages
+			r.Route("/channels", func(r chi.Router) {
+				r.With(middleware.RequireScope(auth.ScopeMessagesRead)).Get("/{id}/messages", messageHandler.ListChannelMessages)
+				r.With(middleware.RequireScope(auth.ScopeMessagesSend)).Post("/{id}/messages", messageHandler.SendChannelMessage)
+			})
+		})
+
+		// Protected routes that need an interactive login
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(keys, db))
+			r.Use(middleware.RequireSession)
 			r.Patch("/me", authHandler.UpdateMe)
 			r.Post("/me/avatar", authHandler.UploadAvatar)
 			r.Post("/auth/extension/code", authHandler.ExtensionCode)
+			r.Post("/auth/verify-email/resend", authHandler.ResendVerification)
+			r.Post("/me/password", authHandler.ChangePassword)
 
-			// Focus sessions
-			sessionHandler := handler.NewSessionHandler(db)
-			r.Post("/focus/sessions/start", sessionHandler.StartSession)
-			r.Post("/focus/sessions/stop", sessionHandler.StopSession)
-			r.Get("/focus/sessions", sessionHandler.ListSessions)
-			r.Get("/focus/sessions/active", sessionHandler.GetActiveSession)
+			// Personal access tokens
+			apiTokenHandler := handler.NewAPITokenHandler(db)
+			r.Get("/me/tokens", apiTokenHandler.List)
+			r.Post("/me/tokens", apiTokenHandler.Create)
+			r.Delete("/me/tokens/{id}", apiTokenHandler.Revoke)
 
-			// Block rules
-			blockRuleHandler := handler.NewBlockRuleHandler(db)
-			r.Get("/block-rules", blockRuleHandler.List)
-			r.Post("/block-rules", blockRuleHandler.Create)
-			r.Patch("/block-rules/{id}", blockRuleHandler.Update)
-			r.Delete("/block-rules/{id}", blockRuleHandler.Delete)
+			// Account deletion and data export
+			accountHandler := handler.NewAccountHandler(db, minioClient)
+			r.Delete("/me", accountHandler.RequestDeletion)
+			r.Post("/me/deletion/cancel", accountHandler.CancelDeletion)
+			r.Post("/me/export", accountHandler.RequestExport)
+			r.Get("/me/export", accountHandler.GetExport)
+
+			// Calendar feed URL
+			r.Post("/me/calendar-feed", feedHandler.RotateFeed)
+			r.Delete("/me/calendar-feed", feedHandler.DisableFeed)
+
+			// Two-factor authentication
+			r.Post("/me/mfa/totp/enroll", authHandler.EnrollTOTP)
+			r.Post("/me/mfa/totp/confirm", authHandler.ConfirmTOTP)
+			r.Post("/me/mfa/totp/disable", authHandler.DisableTOTP)
+			r.Post("/me/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+
+			// Linked provider identities
+			r.Get("/me/identities", oauthHandler.ListIdentities)
+			r.Post("/me/identities/{provider}/link", oauthHandler.StartLink)
+			r.Delete("/me/identities/{id}", oauthHandler.Unlink)
+
+			// Paired browser extensions
+			r.Get("/me/extensions", authHandler.ListExtensions)
+			r.Delete("/me/extensions/{id}", authHandler.RevokeExtension)
+
+			// Login sessions (signed-in devices)
+			loginSessionHandler := handler.NewLoginSessionHandler(db, hub)
+			r.Get("/auth/sessions", loginSessionHandler.List)
+			r.Post("/auth/sessions/revoke-others", loginSessionHandler.RevokeOthers)
+			r.Delete("/auth/sessions/{id}", loginSessionHandler.Revoke)
 
 			// Files (only if MinIO is connected)
 			if minioClient != nil {
@@ -165,20 +376,8 @@ func main() {
 			r.Patch("/me/status", statusHandler.UpdateStatus)
 			r.Get("/friends/online", statusHandler.GetOnlineFriends)
 
-			// Conversations (DMs and groups)
-			conversationHandler := handler.NewConversationHandler(db)
-			messageHandler := handler.NewMessageHandler(db)
-			r.Route("/conversations", func(r chi.Router) {
-				r.Get("/", conversationHandler.List)
-				r.Post("/", conversationHandler.CreateDM)
-				r.Post("/group", conversationHandler.CreateGroup)
-				r.Get("/{id}", conversationHandler.Get)
-				r.Get("/{id}/messages", messageHandler.ListMessages)
-				r.Post("/{id}/messages", messageHandler.SendMessage)
-			})
-
 			// Nests
-			nestHandler := handler.NewNestHandler(db)
+			nestHandler := handler.NewNestHandler(db, hub)
 			r.Route("/nests", func(r chi.Router) {
 				r.Get("/", nestHandler.List)
 				r.Post("/", nestHandler.Create)
@@ -186,12 +385,6 @@ func main() {
 				r.Post("/{id}/join", nestHandler.Join)
 				r.Post("/{id}/leave", nestHandler.Leave)
 			})
-
-			// Channel messages
-			r.Route("/channels", func(r chi.Router) {
-				r.Get("/{id}/messages", messageHandler.ListChannelMessages)
-				r.Post("/{id}/messages", messageHandler.SendChannelMessage)
-			})
 		})
 	}
 
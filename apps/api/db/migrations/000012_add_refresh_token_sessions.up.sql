@@ -0,0 +1,6 @@
+ALTER TABLE refresh_tokens ADD COLUMN session_id UUID;
+UPDATE refresh_tokens SET session_id = id WHERE session_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN session_id SET DEFAULT gen_random_uuid();
+ALTER TABLE refresh_tokens ALTER COLUMN session_id SET NOT NULL;
+
+CREATE INDEX idx_refresh_tokens_session ON refresh_tokens(user_id, session_id);
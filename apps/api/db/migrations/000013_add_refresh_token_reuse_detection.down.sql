@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS security_events;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS replaced_by;
@@ -0,0 +1,14 @@
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by UUID REFERENCES refresh_tokens(id) ON DELETE SET NULL;
+
+CREATE TABLE security_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES profiles(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    ip TEXT,
+    user_agent TEXT,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_security_events_user ON security_events(user_id, created_at DESC);
+CREATE INDEX idx_security_events_type ON security_events(type, created_at DESC);
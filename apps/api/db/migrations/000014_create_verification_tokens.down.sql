@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS verification_tokens;
+ALTER TABLE profiles DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,14 @@
+ALTER TABLE profiles ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+CREATE TABLE verification_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('email_verification', 'password_reset')),
+    token_hash TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_verification_tokens_user ON verification_tokens(user_id, purpose);
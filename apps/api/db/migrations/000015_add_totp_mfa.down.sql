@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS mfa_challenges;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+ALTER TABLE profiles DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE profiles DROP COLUMN IF EXISTS totp_enabled_at;
+ALTER TABLE profiles DROP COLUMN IF EXISTS totp_pending_secret;
+ALTER TABLE profiles DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,25 @@
+ALTER TABLE profiles ADD COLUMN totp_secret TEXT;
+ALTER TABLE profiles ADD COLUMN totp_pending_secret TEXT;
+ALTER TABLE profiles ADD COLUMN totp_enabled_at TIMESTAMPTZ;
+ALTER TABLE profiles ADD COLUMN totp_last_step BIGINT;
+
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    used_at TIMESTAMPTZ,
+    UNIQUE(user_id, code_hash)
+);
+
+CREATE TABLE mfa_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_mfa_challenges_user ON mfa_challenges(user_id);
@@ -0,0 +1,27 @@
+CREATE TABLE linked_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_login_at TIMESTAMPTZ,
+    UNIQUE(provider, subject)
+);
+
+CREATE INDEX idx_linked_identities_user ON linked_identities(user_id);
+
+CREATE TABLE oauth_states (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    state_hash TEXT NOT NULL UNIQUE,
+    provider TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    link_user_id UUID REFERENCES profiles(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES profiles(id) ON DELETE CASCADE,
+    login_code_hash TEXT UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    consumed_at TIMESTAMPTZ
+);
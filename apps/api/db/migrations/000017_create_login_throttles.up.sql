@@ -0,0 +1,8 @@
+CREATE TABLE login_throttles (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    blocked_until TIMESTAMPTZ
+);
+
+CREATE INDEX idx_login_throttles_last_failure ON login_throttles(last_failure_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS data_exports;
+DROP INDEX IF EXISTS idx_profiles_deletion_scheduled;
+ALTER TABLE profiles DROP COLUMN IF EXISTS deletion_scheduled_for;
@@ -0,0 +1,19 @@
+ALTER TABLE profiles ADD COLUMN deletion_scheduled_for TIMESTAMPTZ;
+
+CREATE INDEX idx_profiles_deletion_scheduled ON profiles(deletion_scheduled_for) WHERE deletion_scheduled_for IS NOT NULL;
+
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'processing', 'ready', 'failed')) DEFAULT 'pending',
+    object_key TEXT,
+    size_bytes BIGINT,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    processing_started_at TIMESTAMPTZ, -- lets a stuck export be picked up again
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_data_exports_user ON data_exports(user_id, created_at DESC);
+CREATE INDEX idx_data_exports_status ON data_exports(status);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS extension_devices;
+
+DELETE FROM extension_codes;
+
+ALTER TABLE extension_codes DROP COLUMN IF EXISTS code_challenge;
+ALTER TABLE extension_codes DROP COLUMN IF EXISTS code_hash;
+ALTER TABLE extension_codes ADD COLUMN code TEXT NOT NULL UNIQUE;
+CREATE INDEX IF NOT EXISTS idx_extension_codes_code ON extension_codes (code);
@@ -0,0 +1,18 @@
+DELETE FROM extension_codes;
+
+ALTER TABLE extension_codes DROP COLUMN code;
+ALTER TABLE extension_codes ADD COLUMN code_hash TEXT NOT NULL UNIQUE;
+ALTER TABLE extension_codes ADD COLUMN code_challenge TEXT NOT NULL;
+
+CREATE TABLE extension_devices (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    user_agent TEXT,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_extension_devices_user ON extension_devices(user_id, created_at DESC);
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_focus_sessions_one_running;
+DROP INDEX IF EXISTS idx_focus_sessions_phase_ends;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS phase_ends_at;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS phase_started_at;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS current_cycle;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS phase;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS cycles;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS long_break_every;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS long_break_seconds;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS short_break_seconds;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS focus_seconds;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS mode;
@@ -0,0 +1,28 @@
+ALTER TABLE focus_sessions ADD COLUMN mode TEXT NOT NULL DEFAULT 'open' CHECK (mode IN ('open', 'timed', 'pomodoro'));
+ALTER TABLE focus_sessions ADD COLUMN focus_seconds INT CHECK (focus_seconds > 0);
+ALTER TABLE focus_sessions ADD COLUMN short_break_seconds INT CHECK (short_break_seconds > 0);
+ALTER TABLE focus_sessions ADD COLUMN long_break_seconds INT CHECK (long_break_seconds > 0);
+ALTER TABLE focus_sessions ADD COLUMN long_break_every INT CHECK (long_break_every > 0);
+ALTER TABLE focus_sessions ADD COLUMN cycles INT CHECK (cycles > 0);
+ALTER TABLE focus_sessions ADD COLUMN phase TEXT NOT NULL DEFAULT 'focus' CHECK (phase IN ('focus', 'short_break', 'long_break'));
+ALTER TABLE focus_sessions ADD COLUMN current_cycle INT NOT NULL DEFAULT 1;
+ALTER TABLE focus_sessions ADD COLUMN phase_started_at TIMESTAMPTZ;
+ALTER TABLE focus_sessions ADD COLUMN phase_ends_at TIMESTAMPTZ;
+
+UPDATE focus_sessions SET phase_started_at = started_at;
+
+ALTER TABLE focus_sessions ALTER COLUMN phase_started_at SET NOT NULL;
+ALTER TABLE focus_sessions ALTER COLUMN phase_started_at SET DEFAULT now();
+
+CREATE INDEX idx_focus_sessions_phase_ends ON focus_sessions(phase_ends_at) WHERE status = 'active' AND phase_ends_at IS NOT NULL;
+
+-- At most one running session per user; close out any duplicates left by
+-- concurrent starts before enforcing it
+UPDATE focus_sessions SET status = 'completed', ended_at = COALESCE(ended_at, now()), phase_ends_at = NULL
+WHERE status = 'active' AND id NOT IN (
+    SELECT DISTINCT ON (user_id) id FROM focus_sessions
+    WHERE status = 'active'
+    ORDER BY user_id, started_at DESC
+);
+
+CREATE UNIQUE INDEX idx_focus_sessions_one_running ON focus_sessions(user_id) WHERE status = 'active';
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_focus_sessions_one_running;
+UPDATE focus_sessions SET status = 'active' WHERE status = 'paused';
+CREATE UNIQUE INDEX idx_focus_sessions_one_running ON focus_sessions(user_id) WHERE status = 'active';
+
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS phase_remaining_seconds;
+ALTER TABLE focus_sessions DROP CONSTRAINT IF EXISTS focus_sessions_status_check;
+ALTER TABLE focus_sessions ADD CONSTRAINT focus_sessions_status_check CHECK (status IN ('active', 'completed', 'canceled'));
+
+DROP TABLE IF EXISTS session_intervals;
@@ -0,0 +1,20 @@
+CREATE TABLE session_intervals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    session_id UUID NOT NULL REFERENCES focus_sessions(id) ON DELETE CASCADE,
+    phase TEXT NOT NULL DEFAULT 'focus' CHECK (phase IN ('focus', 'short_break', 'long_break')),
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_session_intervals_session ON session_intervals(session_id, started_at);
+CREATE UNIQUE INDEX idx_session_intervals_open ON session_intervals(session_id) WHERE ended_at IS NULL;
+
+INSERT INTO session_intervals (session_id, phase, started_at, ended_at)
+SELECT id, 'focus', started_at, ended_at FROM focus_sessions;
+
+ALTER TABLE focus_sessions DROP CONSTRAINT IF EXISTS focus_sessions_status_check;
+ALTER TABLE focus_sessions ADD CONSTRAINT focus_sessions_status_check CHECK (status IN ('active', 'paused', 'completed', 'canceled'));
+ALTER TABLE focus_sessions ADD COLUMN phase_remaining_seconds INT;
+
+DROP INDEX IF EXISTS idx_focus_sessions_one_running;
+CREATE UNIQUE INDEX idx_focus_sessions_one_running ON focus_sessions(user_id) WHERE status IN ('active', 'paused');
@@ -0,0 +1 @@
+ALTER TABLE profiles ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
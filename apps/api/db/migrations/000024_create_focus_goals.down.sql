@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS goal_results;
+DROP TABLE IF EXISTS focus_goals;
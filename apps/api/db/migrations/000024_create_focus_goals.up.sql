@@ -0,0 +1,24 @@
+CREATE TABLE focus_goals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    period TEXT NOT NULL CHECK (period IN ('daily', 'weekly')),
+    metric TEXT NOT NULL CHECK (metric IN ('minutes', 'sessions')),
+    target INT NOT NULL CHECK (target > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE(user_id, period, metric)
+);
+
+CREATE TABLE goal_results (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    goal_id UUID NOT NULL REFERENCES focus_goals(id) ON DELETE CASCADE,
+    period_start DATE NOT NULL,
+    target INT NOT NULL,
+    achieved INT NOT NULL DEFAULT 0,
+    met BOOLEAN NOT NULL DEFAULT false,
+    reached_at TIMESTAMPTZ,
+    finalized BOOLEAN NOT NULL DEFAULT false,
+    UNIQUE(goal_id, period_start)
+);
+
+CREATE INDEX idx_goal_results_goal ON goal_results(goal_id, period_start DESC);
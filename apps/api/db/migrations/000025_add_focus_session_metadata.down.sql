@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_focus_sessions_tags;
+
+ALTER TABLE focus_sessions
+    DROP COLUMN IF EXISTS task_url,
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS notes,
+    DROP COLUMN IF EXISTS label;
@@ -0,0 +1,7 @@
+ALTER TABLE focus_sessions
+    ADD COLUMN label TEXT,
+    ADD COLUMN notes TEXT,
+    ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN task_url TEXT;
+
+CREATE INDEX idx_focus_sessions_tags ON focus_sessions USING GIN (tags);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_focus_sessions_user_started;
+DROP INDEX IF EXISTS idx_focus_sessions_client_id;
+
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS synced_at;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS client_id;
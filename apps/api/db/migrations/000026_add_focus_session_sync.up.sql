@@ -0,0 +1,5 @@
+ALTER TABLE focus_sessions ADD COLUMN client_id UUID;
+ALTER TABLE focus_sessions ADD COLUMN synced_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX idx_focus_sessions_client_id ON focus_sessions(user_id, client_id) WHERE client_id IS NOT NULL;
+CREATE INDEX idx_focus_sessions_user_started ON focus_sessions(user_id, started_at);
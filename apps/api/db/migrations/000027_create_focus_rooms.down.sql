@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_focus_sessions_room;
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS room_id;
+
+DROP TABLE IF EXISTS focus_room_members;
+DROP TABLE IF EXISTS focus_rooms;
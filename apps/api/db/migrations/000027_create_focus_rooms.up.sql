@@ -0,0 +1,31 @@
+CREATE TABLE focus_rooms (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    host_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    nest_id UUID REFERENCES nests(id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('waiting', 'running', 'ended')) DEFAULT 'waiting',
+    mode TEXT NOT NULL DEFAULT 'open' CHECK (mode IN ('open', 'timed', 'pomodoro')),
+    focus_seconds INT CHECK (focus_seconds > 0),
+    short_break_seconds INT CHECK (short_break_seconds > 0),
+    long_break_seconds INT CHECK (long_break_seconds > 0),
+    long_break_every INT CHECK (long_break_every > 0),
+    cycles INT CHECK (cycles > 0),
+    started_at TIMESTAMPTZ,
+    ended_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE focus_room_members (
+    room_id UUID NOT NULL REFERENCES focus_rooms(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    left_at TIMESTAMPTZ,
+    PRIMARY KEY(room_id, user_id)
+);
+
+ALTER TABLE focus_sessions ADD COLUMN room_id UUID REFERENCES focus_rooms(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_focus_rooms_host ON focus_rooms(host_id) WHERE status <> 'ended';
+CREATE INDEX idx_focus_rooms_nest ON focus_rooms(nest_id) WHERE status <> 'ended';
+CREATE INDEX idx_focus_room_members_user ON focus_room_members(user_id);
+CREATE INDEX idx_focus_sessions_room ON focus_sessions(room_id) WHERE room_id IS NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS calendar_feed_token_hash;
+
+DROP TABLE IF EXISTS scheduled_focus_blocks;
@@ -0,0 +1,19 @@
+CREATE TABLE scheduled_focus_blocks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    title TEXT,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL CHECK (ends_at > starts_at),
+    source TEXT NOT NULL CHECK (source IN ('manual', 'ics')) DEFAULT 'manual',
+    external_uid TEXT,
+    status TEXT NOT NULL CHECK (status IN ('scheduled', 'started', 'skipped')) DEFAULT 'scheduled',
+    session_id UUID REFERENCES focus_sessions(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX idx_scheduled_focus_blocks_uid ON scheduled_focus_blocks(user_id, external_uid) WHERE external_uid IS NOT NULL;
+CREATE INDEX idx_scheduled_focus_blocks_user ON scheduled_focus_blocks(user_id, starts_at);
+CREATE INDEX idx_scheduled_focus_blocks_due ON scheduled_focus_blocks(starts_at) WHERE status = 'scheduled';
+
+ALTER TABLE profiles ADD COLUMN calendar_feed_token_hash TEXT UNIQUE;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_scheduled_focus_blocks_occurrence;
+DELETE FROM scheduled_focus_blocks WHERE source = 'schedule';
+ALTER TABLE scheduled_focus_blocks DROP CONSTRAINT IF EXISTS scheduled_focus_blocks_source_check;
+ALTER TABLE scheduled_focus_blocks ADD CONSTRAINT scheduled_focus_blocks_source_check
+    CHECK (source IN ('manual', 'ics'));
+ALTER TABLE scheduled_focus_blocks
+    DROP COLUMN IF EXISTS occurrence_date,
+    DROP COLUMN IF EXISTS schedule_id;
+
+DROP TABLE IF EXISTS focus_schedules;
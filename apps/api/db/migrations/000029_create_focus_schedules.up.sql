@@ -0,0 +1,25 @@
+CREATE TABLE focus_schedules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    name TEXT,
+    days TEXT[] NOT NULL CHECK (cardinality(days) > 0),
+    start_minute INT NOT NULL CHECK (start_minute >= 0 AND start_minute < 1440),
+    end_minute INT NOT NULL CHECK (end_minute >= 0 AND end_minute < 1440 AND end_minute <> start_minute),
+    timezone TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    materialized_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_focus_schedules_user ON focus_schedules(user_id);
+CREATE INDEX idx_focus_schedules_due ON focus_schedules(materialized_until) WHERE enabled;
+
+ALTER TABLE scheduled_focus_blocks
+    ADD COLUMN schedule_id UUID REFERENCES focus_schedules(id) ON DELETE SET NULL,
+    ADD COLUMN occurrence_date DATE;
+ALTER TABLE scheduled_focus_blocks DROP CONSTRAINT scheduled_focus_blocks_source_check;
+ALTER TABLE scheduled_focus_blocks ADD CONSTRAINT scheduled_focus_blocks_source_check
+    CHECK (source IN ('manual', 'ics', 'schedule'));
+
+CREATE UNIQUE INDEX idx_scheduled_focus_blocks_occurrence ON scheduled_focus_blocks(schedule_id, occurrence_date) WHERE schedule_id IS NOT NULL;
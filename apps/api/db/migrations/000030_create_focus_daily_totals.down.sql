@@ -0,0 +1,3 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS leaderboard_opt_out;
+
+DROP TABLE IF EXISTS focus_daily_totals;
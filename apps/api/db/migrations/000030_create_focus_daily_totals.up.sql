@@ -0,0 +1,11 @@
+CREATE TABLE focus_daily_totals (
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    focused_seconds BIGINT NOT NULL,
+    refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY(user_id, day)
+);
+
+CREATE INDEX idx_focus_daily_totals_day ON focus_daily_totals(day);
+
+ALTER TABLE profiles ADD COLUMN leaderboard_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
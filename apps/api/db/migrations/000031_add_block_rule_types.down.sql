@@ -0,0 +1,2 @@
+UPDATE block_rules SET pattern = btrim(pattern, '*') WHERE type = 'glob';
+ALTER TABLE block_rules DROP COLUMN IF EXISTS type;
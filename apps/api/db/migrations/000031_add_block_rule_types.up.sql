@@ -0,0 +1,9 @@
+ALTER TABLE block_rules ADD COLUMN type TEXT NOT NULL DEFAULT 'domain_subdomains'
+    CHECK (type IN ('domain', 'domain_subdomains', 'url_prefix', 'glob', 'regex', 'keyword'));
+
+-- Existing patterns were free text. Clients treated bare domains as the domain
+-- and its subdomains and matched anything else anywhere in the URL. A ? was
+-- literal then, so it's escaped before it becomes a glob wildcard.
+UPDATE block_rules SET pattern = regexp_replace(regexp_replace(btrim(pattern), '^[a-zA-Z]+://', ''), '^www\.', '');
+UPDATE block_rules SET pattern = lower(rtrim(pattern, '/')) WHERE rtrim(pattern, '/') ~ '^[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)+$';
+UPDATE block_rules SET type = 'glob', pattern = '*' || replace(replace(lower(pattern), '\', '\\'), '?', '\?') || '*' WHERE pattern !~ '^[a-z0-9-]+(\.[a-z0-9-]+)+$';
@@ -0,0 +1,8 @@
+ALTER TABLE block_rules
+    DROP CONSTRAINT IF EXISTS block_rules_window_check,
+    DROP COLUMN IF EXISTS schedule_id,
+    DROP COLUMN IF EXISTS window_timezone,
+    DROP COLUMN IF EXISTS window_end_minute,
+    DROP COLUMN IF EXISTS window_start_minute,
+    DROP COLUMN IF EXISTS window_days,
+    DROP COLUMN IF EXISTS active_when;
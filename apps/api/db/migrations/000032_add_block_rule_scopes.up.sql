@@ -0,0 +1,9 @@
+ALTER TABLE block_rules
+    ADD COLUMN active_when TEXT NOT NULL DEFAULT 'always' CHECK (active_when IN ('always', 'focus', 'window', 'schedule')),
+    ADD COLUMN window_days TEXT[],
+    ADD COLUMN window_start_minute INT CHECK (window_start_minute >= 0 AND window_start_minute < 1440),
+    ADD COLUMN window_end_minute INT CHECK (window_end_minute >= 0 AND window_end_minute < 1440),
+    ADD COLUMN window_timezone TEXT,
+    ADD COLUMN schedule_id UUID REFERENCES focus_schedules(id) ON DELETE SET NULL,
+    ADD CONSTRAINT block_rules_window_check CHECK (active_when <> 'window' OR
+        (window_days IS NOT NULL AND window_start_minute IS NOT NULL AND window_end_minute IS NOT NULL AND window_timezone IS NOT NULL));
@@ -0,0 +1,4 @@
+ALTER TABLE block_rules DROP COLUMN IF EXISTS list_id;
+DROP TABLE IF EXISTS block_list_subscriptions;
+DROP TABLE IF EXISTS block_list_nests;
+DROP TABLE IF EXISTS block_lists;
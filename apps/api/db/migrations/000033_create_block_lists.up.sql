@@ -0,0 +1,32 @@
+CREATE TABLE block_lists (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    shared_with_friends BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE block_list_nests (
+    list_id UUID NOT NULL REFERENCES block_lists(id) ON DELETE CASCADE,
+    nest_id UUID NOT NULL REFERENCES nests(id) ON DELETE CASCADE,
+    published_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY(list_id, nest_id)
+);
+
+CREATE TABLE block_list_subscriptions (
+    list_id UUID NOT NULL REFERENCES block_lists(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY(list_id, user_id)
+);
+
+ALTER TABLE block_rules ADD COLUMN list_id UUID REFERENCES block_lists(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_block_lists_owner ON block_lists(owner_id);
+CREATE INDEX idx_block_list_nests_nest ON block_list_nests(nest_id);
+CREATE INDEX idx_block_list_subscriptions_user ON block_list_subscriptions(user_id);
+CREATE INDEX idx_block_rules_list ON block_rules(list_id) WHERE list_id IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE focus_sessions DROP COLUMN IF EXISTS block_mode;
+ALTER TABLE block_rules DROP COLUMN IF EXISTS action;
@@ -0,0 +1,3 @@
+ALTER TABLE block_rules ADD COLUMN action TEXT NOT NULL DEFAULT 'block' CHECK (action IN ('block', 'allow'));
+
+ALTER TABLE focus_sessions ADD COLUMN block_mode TEXT NOT NULL DEFAULT 'blocklist' CHECK (block_mode IN ('blocklist', 'allowlist'));
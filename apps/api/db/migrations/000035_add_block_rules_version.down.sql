@@ -0,0 +1 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS block_rules_version;
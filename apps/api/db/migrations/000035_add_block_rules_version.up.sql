@@ -0,0 +1 @@
+ALTER TABLE profiles ADD COLUMN block_rules_version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,230 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// exportDatasets lists the tables bundled into an export, one JSON file each.
+// Secrets such as password and TOTP hashes are deliberately left out.
+var exportDatasets = []struct {
+	name  string
+	query string
+}{
+	{"profile.json", `
+		SELECT id, email, display_name, avatar_url, status, custom_status, email_verified_at, created_at, updated_at
+		FROM profiles WHERE id = $1`},
+	{"focus_sessions.json", `
+		SELECT * FROM focus_sessions WHERE user_id = $1 ORDER BY started_at`},
+	{"session_intervals.json", `
+		SELECT i.* FROM session_intervals i
+		JOIN focus_sessions s ON s.id = i.session_id
+		WHERE s.user_id = $1 ORDER BY i.started_at`},
+	{"focus_rooms.json", `
+		SELECT r.id, r.name, r.host_id = $1 AS hosted, r.status, r.started_at, r.ended_at,
+		       m.joined_at, m.left_at
+		FROM focus_room_members m
+		JOIN focus_rooms r ON r.id = m.room_id
+		WHERE m.user_id = $1 ORDER BY m.joined_at`},
+	{"focus_schedules.json", `
+		SELECT * FROM focus_schedules WHERE user_id = $1 ORDER BY created_at`},
+	{"scheduled_focus_blocks.json", `
+		SELECT * FROM scheduled_focus_blocks WHERE user_id = $1 ORDER BY starts_at`},
+	{"focus_goals.json", `
+		SELECT * FROM focus_goals WHERE user_id = $1 ORDER BY created_at`},
+	{"goal_results.json", `
+		SELECT r.* FROM goal_results r
+		JOIN focus_goals g ON g.id = r.goal_id
+		WHERE g.user_id = $1 ORDER BY r.period_start`},
+	{"block_rules.json", `
+		SELECT * FROM block_rules WHERE user_id = $1 ORDER BY created_at`},
+	{"block_lists.json", `
+		SELECT * FROM block_lists WHERE owner_id = $1 ORDER BY created_at`},
+	{"block_list_subscriptions.json", `
+		SELECT s.list_id, l.name, s.enabled, s.created_at
+		FROM block_list_subscriptions s
+		JOIN block_lists l ON l.id = s.list_id
+		WHERE s.user_id = $1 ORDER BY s.created_at`},
+	{"messages.json", `
+		SELECT m.id, m.conversation_id, m.content, m.created_at, m.updated_at
+		FROM messages m WHERE m.sender_id = $1 ORDER BY m.created_at`},
+	{"channel_messages.json", `
+		SELECT cm.id, cm.channel_id, nc.nest_id, cm.content, cm.created_at
+		FROM channel_messages cm
+		JOIN nest_channels nc ON nc.id = cm.channel_id
+		WHERE cm.sender_id = $1 ORDER BY cm.created_at`},
+	{"friendships.json", `
+		SELECT f.id, f.requester_id, f.addressee_id, f.status, f.created_at, f.updated_at,
+		       p.display_name AS other_display_name
+		FROM friendships f
+		JOIN profiles p ON p.id = CASE WHEN f.requester_id = $1 THEN f.addressee_id ELSE f.requester_id END
+		WHERE f.requester_id = $1 OR f.addressee_id = $1
+		ORDER BY f.created_at`},
+	{"files.json", `
+		SELECT id, object_key, filename, content_type, size_bytes, created_at
+		FROM files WHERE user_id = $1 ORDER BY created_at`},
+	{"linked_identities.json", `
+		SELECT id, provider, email, created_at, last_login_at
+		FROM linked_identities WHERE user_id = $1 ORDER BY created_at`},
+	{"security_events.json", `
+		SELECT id, type, ip, user_agent, details, created_at
+		FROM security_events WHERE user_id = $1 ORDER BY created_at`},
+}
+
+// buildExport writes the user's data to a zip archive, uploads it and returns
+// the object key and archive size
+func (w *Worker) buildExport(ctx context.Context, exportID, userID uuid.UUID) (string, int64, error) {
+	if w.minio == nil {
+		return "", 0, errors.New("file storage not available")
+	}
+
+	// Stage on disk: uploaded files can be far larger than we want to hold in memory
+	tmp, err := os.CreateTemp("", "wakeup-export-*.zip")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	for _, dataset := range exportDatasets {
+		if err := w.writeDataset(ctx, zw, dataset.name, dataset.query, userID); err != nil {
+			return "", 0, err
+		}
+	}
+	if err := w.writeObjects(ctx, zw, userID); err != nil {
+		return "", 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return "", 0, fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	objectKey := userID.String() + "/exports/" + exportID.String() + ".zip"
+	if _, err := w.minio.PutObject(ctx, objectKey, tmp, size, "application/zip"); err != nil {
+		return "", 0, fmt.Errorf("failed to upload archive: %w", err)
+	}
+	return objectKey, size, nil
+}
+
+// writeDataset dumps a query result as a JSON array of objects keyed by column name
+func (w *Worker) writeDataset(ctx context.Context, zw *zip.Writer, name, query string, userID uuid.UUID) error {
+	rows, err := w.db.Query(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to export %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", name, err)
+		}
+		record := make(map[string]interface{}, len(fields))
+		for i, field := range fields {
+			// pgx decodes uuid columns to raw bytes
+			if id, ok := values[i].([16]byte); ok {
+				values[i] = uuid.UUID(id).String()
+			}
+			record[field.Name] = values[i]
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export %s: %w", name, err)
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// writeObjects copies uploaded files and the avatar into the archive
+func (w *Worker) writeObjects(ctx context.Context, zw *zip.Writer, userID uuid.UUID) error {
+	rows, err := w.db.Query(ctx,
+		`SELECT id::text, object_key, filename FROM files WHERE user_id = $1
+		 UNION ALL
+		 SELECT 'avatar', avatar_url, avatar_url FROM profiles
+		 WHERE id = $1 AND avatar_url LIKE $1::text || '/%'`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to load files: %w", err)
+	}
+	defer rows.Close()
+
+	type object struct {
+		name, objectKey string
+	}
+	var objects []object
+	for rows.Next() {
+		var id, objectKey, filename string
+		if err := rows.Scan(&id, &objectKey, &filename); err != nil {
+			return fmt.Errorf("failed to load files: %w", err)
+		}
+		objects = append(objects, object{
+			name:      "files/" + id + "-" + path.Base(filename),
+			objectKey: objectKey,
+		})
+	}
+	rows.Close()
+
+	for _, o := range objects {
+		if !strings.HasPrefix(o.objectKey, userID.String()+"/") {
+			continue
+		}
+		if err := w.copyObject(ctx, zw, o.name, o.objectKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Worker) copyObject(ctx context.Context, zw *zip.Writer, name, objectKey string) error {
+	obj, err := w.minio.GetObject(ctx, objectKey)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", objectKey, err)
+	}
+	defer obj.Close()
+
+	// Metadata can outlive its object (e.g. an upload that never completed)
+	if _, err := obj.Stat(); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", objectKey, err)
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, obj); err != nil {
+		return fmt.Errorf("failed to read %s: %w", objectKey, err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"wakeup/api/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DeletionGracePeriod is how long a deletion request can be canceled before the account is purged
+	DeletionGracePeriod = 14 * 24 * time.Hour
+	// ExportRetention is how long a finished export archive stays downloadable
+	ExportRetention = 7 * 24 * time.Hour
+	// exportStaleAfter is how long an export can stay processing before it's
+	// assumed its worker died and another one picks it up
+	exportStaleAfter = 30 * time.Minute
+
+	pollInterval = time.Minute
+)
+
+// Worker builds requested data exports and purges accounts whose deletion
+// grace period has passed. Jobs are claimed with SKIP LOCKED so several API
+// instances can run a worker side by side.
+type Worker struct {
+	db    *pgxpool.Pool
+	minio *storage.MinioClient
+}
+
+func NewWorker(db *pgxpool.Pool, minio *storage.MinioClient) *Worker {
+	return &Worker{db: db, minio: minio}
+}
+
+// Run polls for work until ctx is canceled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.processExports(ctx)
+		w.expireExports(ctx)
+		w.purgeDeletedAccounts(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) processExports(ctx context.Context) {
+	for {
+		var exportID, userID uuid.UUID
+		err := w.db.QueryRow(ctx,
+			`UPDATE data_exports SET status = 'processing', processing_started_at = NOW()
+			 WHERE id = (
+			     SELECT id FROM data_exports
+			     WHERE status = 'pending'
+			        OR (status = 'processing' AND (processing_started_at IS NULL OR processing_started_at < $1))
+			     ORDER BY created_at
+			     LIMIT 1
+			     FOR UPDATE SKIP LOCKED
+			 )
+			 RETURNING id, user_id`,
+			time.Now().Add(-exportStaleAfter),
+		).Scan(&exportID, &userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to claim data export: %v", err)
+			return
+		}
+
+		objectKey, size, err := w.buildExport(ctx, exportID, userID)
+		if err != nil {
+			log.Printf("Data export %s failed: %v", exportID, err)
+			w.db.Exec(ctx,
+				`UPDATE data_exports SET status = 'failed', error = $2, completed_at = NOW() WHERE id = $1`,
+				exportID, err.Error(),
+			)
+			continue
+		}
+
+		_, err = w.db.Exec(ctx,
+			`UPDATE data_exports
+			 SET status = 'ready', object_key = $2, size_bytes = $3, completed_at = NOW(), expires_at = $4
+			 WHERE id = $1`,
+			exportID, objectKey, size, time.Now().Add(ExportRetention),
+		)
+		if err != nil {
+			log.Printf("Failed to mark data export %s ready: %v", exportID, err)
+		}
+	}
+}
+
+// expireExports removes archives that are past their retention window
+func (w *Worker) expireExports(ctx context.Context) {
+	rows, err := w.db.Query(ctx,
+		`SELECT id, object_key FROM data_exports
+		 WHERE status = 'ready' AND expires_at < NOW()`,
+	)
+	if err != nil {
+		log.Printf("Failed to load expired data exports: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type expired struct {
+		id        uuid.UUID
+		objectKey string
+	}
+	var exports []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.id, &e.objectKey); err != nil {
+			log.Printf("Failed to scan expired data export: %v", err)
+			return
+		}
+		exports = append(exports, e)
+	}
+	rows.Close()
+
+	for _, e := range exports {
+		if w.minio != nil {
+			if err := w.minio.DeleteObject(ctx, e.objectKey); err != nil {
+				log.Printf("Failed to delete export archive %s: %v", e.objectKey, err)
+				continue
+			}
+		}
+		w.db.Exec(ctx, `DELETE FROM data_exports WHERE id = $1`, e.id)
+	}
+}
+
+// purgeDeletedAccounts removes stored objects and then the profile row; every
+// other table holding user data cascades from profiles.
+func (w *Worker) purgeDeletedAccounts(ctx context.Context) {
+	rows, err := w.db.Query(ctx,
+		`SELECT id FROM profiles
+		 WHERE deletion_scheduled_for IS NOT NULL AND deletion_scheduled_for <= NOW()`,
+	)
+	if err != nil {
+		log.Printf("Failed to load accounts due for deletion: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var userIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("Failed to scan account due for deletion: %v", err)
+			return
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+
+	for _, userID := range userIDs {
+		if w.minio == nil {
+			// Nothing can be listed without storage; the account goes anyway
+			log.Printf("File storage not available, skipping stored objects for %s", userID)
+		} else if err := w.purgeObjects(ctx, userID); err != nil {
+			// Try again on the next poll rather than orphaning objects
+			log.Printf("Failed to delete stored objects for %s: %v", userID, err)
+			continue
+		}
+
+		// Re-check the schedule so a cancel that raced the purge wins
+		tag, err := w.db.Exec(ctx,
+			`DELETE FROM profiles
+			 WHERE id = $1 AND deletion_scheduled_for IS NOT NULL AND deletion_scheduled_for <= NOW()`,
+			userID,
+		)
+		if err != nil {
+			log.Printf("Failed to delete account %s: %v", userID, err)
+			continue
+		}
+		if tag.RowsAffected() > 0 {
+			log.Printf("Deleted account %s", userID)
+		}
+	}
+}
+
+// purgeObjects deletes everything the user stored in MinIO. Uploads, avatars
+// and export archives all live under the "<user_id>/" prefix.
+func (w *Worker) purgeObjects(ctx context.Context, userID uuid.UUID) error {
+	keys, err := w.minio.ListObjectKeys(ctx, userID.String()+"/")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := w.minio.DeleteObject(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
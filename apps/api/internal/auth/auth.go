@@ -20,8 +20,10 @@ var (
 
 type Claims struct {
 	UserID      uuid.UUID `json:"sub"`
+	SessionID   uuid.UUID `json:"sid"`
 	Email       string    `json:"email"`
 	DisplayName string    `json:"display_name"`
+	Scopes      []string  `json:"scp,omitempty"` // set for limited sessions such as paired extensions
 	jwt.RegisteredClaims
 }
 
@@ -37,12 +39,15 @@ func CheckPassword(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateAccessToken creates a signed JWT access token
-func GenerateAccessToken(userID uuid.UUID, email, displayName, secret string, expiry time.Duration) (string, error) {
+// GenerateAccessToken creates a JWT access token bound to a login session, signed
+// with the key set's active key. A nil scopes grants full access.
+func GenerateAccessToken(keys *KeySet, userID, sessionID uuid.UUID, email, displayName string, scopes []string, expiry time.Duration) (string, error) {
 	claims := &Claims{
 		UserID:      userID,
+		SessionID:   sessionID,
 		Email:       email,
 		DisplayName: displayName,
+		Scopes:      scopes,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -50,18 +55,15 @@ func GenerateAccessToken(userID uuid.UUID, email, displayName, secret string, ex
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.sign(claims)
 }
 
-// ValidateAccessToken validates a JWT and returns the claims
-func ValidateAccessToken(tokenString, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(secret), nil
-	})
+// ValidateAccessToken validates a JWT against any key in the key set and returns the claims
+func ValidateAccessToken(tokenString string, keys *KeySet) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.verificationKey,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+		jwt.WithIssuer("wakeup"),
+	)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySet holds the key used to sign access tokens and every key that is still
+// accepted for verification. Keeping retired keys around for longer than the access
+// token lifetime gives a rotation window in which old tokens stay valid.
+type KeySet struct {
+	signingKID    string
+	signingKey    crypto.Signer
+	signingMethod jwt.SigningMethod
+	publicKeys    map[string]crypto.PublicKey
+	hmacSecret    []byte
+	acceptHMAC    bool
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewHMACKeySet signs and verifies with a single shared HS256 secret
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{
+		signingMethod: jwt.SigningMethodHS256,
+		publicKeys:    map[string]crypto.PublicKey{},
+		hmacSecret:    []byte(secret),
+		acceptHMAC:    true,
+	}
+}
+
+// LoadKeySet reads every <kid>.pem in dir. Private keys (RSA or Ed25519) and public
+// keys are all trusted for verification; activeKID picks the private key that signs
+// new tokens. When acceptHMAC is set, HS256 tokens signed with hmacSecret are still
+// accepted, which covers the switch-over from the shared secret.
+func LoadKeySet(dir, activeKID, hmacSecret string, acceptHMAC bool) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	keys := &KeySet{
+		publicKeys: map[string]crypto.PublicKey{},
+		hmacSecret: []byte(hmacSecret),
+		acceptHMAC: acceptHMAC,
+	}
+
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", kid, err)
+		}
+
+		private, public, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %w", kid, err)
+		}
+		keys.publicKeys[kid] = public
+
+		if kid == activeKID {
+			if private == nil {
+				return nil, fmt.Errorf("active key %s has no private key", kid)
+			}
+			keys.signingKID = kid
+			keys.signingKey = private
+			keys.signingMethod = signingMethodFor(private)
+		}
+	}
+
+	if keys.signingKey == nil {
+		return nil, fmt.Errorf("active key %q not found in %s", activeKID, dir)
+	}
+
+	return keys, nil
+}
+
+// parseKey decodes a PEM block into a signer (nil for public-only keys) and its public key
+func parseKey(data []byte) (crypto.Signer, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok || signingMethodFor(signer) == nil {
+			return nil, nil, errors.New("unsupported private key type")
+		}
+		return signer, signer.Public(), nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, key.Public(), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch key.(type) {
+		case *rsa.PublicKey, ed25519.PublicKey:
+			return nil, key, nil
+		}
+		return nil, nil, errors.New("unsupported public key type")
+	}
+
+	return nil, nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+func signingMethodFor(key crypto.Signer) jwt.SigningMethod {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA
+	}
+	return nil
+}
+
+// sign signs claims with the active key, tagging the token with its kid
+func (k *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signingMethod, claims)
+	if k.signingKey == nil {
+		return token.SignedString(k.hmacSecret)
+	}
+	token.Header["kid"] = k.signingKID
+	return token.SignedString(k.signingKey)
+}
+
+// verificationKey is the jwt.Keyfunc that picks the key a token claims to be signed with
+func (k *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if !k.acceptHMAC || len(k.hmacSecret) == 0 {
+			return nil, ErrInvalidToken
+		}
+		return k.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.publicKeys[kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	// The alg header must match the key type, otherwise a token could pick its own algorithm
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+			return key, nil
+		}
+	case ed25519.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); ok {
+			return key, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+// JWKS returns the public verification keys, sorted by kid. HS256 secrets are never published.
+func (k *KeySet) JWKS() JWKSet {
+	kids := make([]string, 0, len(k.publicKeys))
+	for kid := range k.publicKeys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, kid := range kids {
+		switch key := k.publicKeys[kid].(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     kid,
+				Use:       "sig",
+				Algorithm: "RS256",
+				N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     kid,
+				Use:       "sig",
+				Algorithm: "EdDSA",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(key),
+			})
+		}
+	}
+	return set
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// writePrivateKey stores key as <dir>/<kid>.pem in PKCS#8 form
+func writePrivateKey(t *testing.T, dir, kid string, key any) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid, "PRIVATE KEY", der)
+}
+
+// writePublicKey stores only the public half, as for a retired key
+func writePublicKey(t *testing.T, dir, kid string, key any) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid, "PUBLIC KEY", der)
+}
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func loadKeySet(t *testing.T, dir, activeKID string) *KeySet {
+	t.Helper()
+	keys, err := LoadKeySet(dir, activeKID, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func issueToken(t *testing.T, keys *KeySet, userID uuid.UUID) string {
+	t.Helper()
+	token, err := GenerateAccessToken(keys, userID, uuid.New(), "ada@example.com", "Ada", nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestKeySetSignAndVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		key  any
+		alg  string
+	}{
+		{"RS256", newRSAKey(t), "RS256"},
+		{"EdDSA", newEd25519Key(t), "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePrivateKey(t, dir, "k1", tt.key)
+			keys := loadKeySet(t, dir, "k1")
+
+			userID := uuid.New()
+			token := issueToken(t, keys, userID)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Method.Alg() != tt.alg {
+				t.Errorf("alg = %s, want %s", parsed.Method.Alg(), tt.alg)
+			}
+			if parsed.Header["kid"] != "k1" {
+				t.Errorf("kid = %v, want k1", parsed.Header["kid"])
+			}
+
+			claims, err := ValidateAccessToken(token, keys)
+			if err != nil {
+				t.Fatalf("ValidateAccessToken: %v", err)
+			}
+			if claims.UserID != userID {
+				t.Errorf("UserID = %s, want %s", claims.UserID, userID)
+			}
+		})
+	}
+}
+
+func TestKeySetRotationOverlap(t *testing.T) {
+	oldKey := newEd25519Key(t)
+	newKey := newRSAKey(t)
+
+	// Before the rotation the old key signs
+	before := t.TempDir()
+	writePrivateKey(t, before, "2025-01", oldKey)
+	token := issueToken(t, loadKeySet(t, before, "2025-01"), uuid.New())
+
+	// After it the new key signs and the old one is only kept as a public key
+	after := t.TempDir()
+	writePublicKey(t, after, "2025-01", oldKey.Public())
+	writePrivateKey(t, after, "2025-02", newKey)
+	keys := loadKeySet(t, after, "2025-02")
+
+	if _, err := ValidateAccessToken(token, keys); err != nil {
+		t.Errorf("token signed by the retired key: %v", err)
+	}
+	if _, err := ValidateAccessToken(issueToken(t, keys, uuid.New()), keys); err != nil {
+		t.Errorf("token signed by the active key: %v", err)
+	}
+}
+
+func TestKeySetRejectsUnknownKID(t *testing.T) {
+	other := t.TempDir()
+	writePrivateKey(t, other, "other", newEd25519Key(t))
+	token := issueToken(t, loadKeySet(t, other, "other"), uuid.New())
+
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "k1", newEd25519Key(t))
+	if _, err := ValidateAccessToken(token, loadKeySet(t, dir, "k1")); err != ErrInvalidToken {
+		t.Errorf("unknown kid: err = %v, want ErrInvalidToken", err)
+	}
+
+	// A known kid doesn't help a token signed by a different key
+	forged := t.TempDir()
+	writePrivateKey(t, forged, "k1", newEd25519Key(t))
+	token = issueToken(t, loadKeySet(t, forged, "k1"), uuid.New())
+	if _, err := ValidateAccessToken(token, loadKeySet(t, dir, "k1")); err != ErrInvalidToken {
+		t.Errorf("wrong key for kid: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestKeySetHMACOnlyWhenAccepted(t *testing.T) {
+	token := issueToken(t, NewHMACKeySet("secret"), uuid.New())
+
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "k1", newEd25519Key(t))
+
+	rejecting, err := LoadKeySet(dir, "k1", "secret", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateAccessToken(token, rejecting); err != ErrInvalidToken {
+		t.Errorf("HS256 not accepted: err = %v, want ErrInvalidToken", err)
+	}
+
+	accepting, err := LoadKeySet(dir, "k1", "secret", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateAccessToken(token, accepting); err != nil {
+		t.Errorf("HS256 accepted during switch-over: %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	edKey := newEd25519Key(t)
+
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "b-rsa", rsaKey)
+	writePublicKey(t, dir, "a-ed", edKey.Public())
+	set := loadKeySet(t, dir, "b-rsa").JWKS()
+
+	if len(set.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(set.Keys))
+	}
+
+	ed := set.Keys[0]
+	if ed.KeyID != "a-ed" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(ed.X)
+	if err != nil || !ed25519.PublicKey(x).Equal(edKey.Public()) {
+		t.Errorf("Ed25519 x = %q does not encode the public key", ed.X)
+	}
+
+	rs := set.Keys[1]
+	if rs.KeyID != "b-rsa" || rs.KeyType != "RSA" || rs.Algorithm != "RS256" || rs.Use != "sig" {
+		t.Errorf("RSA JWK = %+v", rs)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(rs.N)
+	if err != nil || string(n) != string(rsaKey.N.Bytes()) {
+		t.Errorf("RSA n = %q does not encode the modulus", rs.N)
+	}
+	if rs.E != "AQAB" {
+		t.Errorf("RSA e = %q, want AQAB", rs.E)
+	}
+
+	if hmac := NewHMACKeySet("secret").JWKS(); len(hmac.Keys) != 0 {
+		t.Errorf("HS256 secret published: %+v", hmac.Keys)
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key from RFC 6238 appendix B, base32-encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The RFC lists 8-digit codes; ours are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/30); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / 30
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		at       time.Time
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current code", rfc6238Secret, "050471", now, step, true},
+		{"spaces are ignored", rfc6238Secret, " 050 471 ", now, step, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", now, step, true},
+		{"previous period", rfc6238Secret, "050471", now.Add(30 * time.Second), step, true},
+		{"next period", rfc6238Secret, "050471", now.Add(-30 * time.Second), step, true},
+		{"two periods late", rfc6238Secret, "050471", now.Add(60 * time.Second), 0, false},
+		{"wrong code", rfc6238Secret, "050472", now, 0, false},
+		{"too short", rfc6238Secret, "05047", now, 0, false},
+		{"too long", rfc6238Secret, "0504711", now, 0, false},
+		{"invalid secret", "not base32!", "050471", now, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, tt.at)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP = (%d, %v), want (%d, %v)", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not base32: %v", secret, err)
+	}
+	if len(key) != 20 {
+		t.Errorf("key is %d bytes, want 20", len(key))
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"abcde-fghij", "abcde-fghij"},
+		{"ABCDE-FGHIJ", "abcde-fghij"},
+		{"abcdefghij", "abcde-fghij"},
+		{" abcde fghij ", "abcde-fghij"},
+		{"abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package blocking
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Rule is a block rule as the matcher sees it; Pattern must be normalized
+type Rule struct {
+	ID      uuid.UUID
+	Type    string
+	Pattern string
+}
+
+// Page is what a rule is matched against
+type Page struct {
+	URL   string
+	Title string
+}
+
+// Matcher matches pages against a compiled rule set
+type Matcher struct {
+	rules    []Rule
+	compiled []func(p parsedPage) bool
+}
+
+type parsedPage struct {
+	host  string // lowercase punycode
+	key   string // host without www., path and query
+	bare  string // the URL without its scheme, lowercased
+	full  string
+	title string // lowercased
+}
+
+// Compile prepares rules for matching. Rules are tried in the order given.
+func Compile(rules []Rule) (*Matcher, error) {
+	m := &Matcher{rules: rules}
+	for _, rule := range rules {
+		match, err := compileRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		m.compiled = append(m.compiled, match)
+	}
+	return m, nil
+}
+
+func compileRule(rule Rule) (func(p parsedPage) bool, error) {
+	pattern := rule.Pattern
+	switch rule.Type {
+	case TypeDomain:
+		return func(p parsedPage) bool { return p.host == pattern }, nil
+	case TypeDomainSubdomains:
+		suffix := "." + pattern
+		return func(p parsedPage) bool { return p.host == pattern || strings.HasSuffix(p.host, suffix) }, nil
+	case TypeURLPrefix:
+		return func(p parsedPage) bool { return strings.HasPrefix(p.key, pattern) }, nil
+	case TypeGlob:
+		re, err := regexp.Compile("^" + globToRegexp(pattern) + "$")
+		if err != nil {
+			return nil, err
+		}
+		return func(p parsedPage) bool { return re.MatchString(p.bare) }, nil
+	case TypeRegex:
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(p parsedPage) bool { return re.MatchString(p.full) }, nil
+	case TypeKeyword:
+		keyword := strings.ToLower(pattern)
+		return func(p parsedPage) bool { return p.title != "" && strings.Contains(p.title, keyword) }, nil
+	}
+	return nil, errors.New("unknown rule type " + rule.Type)
+}
+
+// globToRegexp translates a glob where * is any run of characters and ? is
+// one character. A backslash makes the next character literal, e.g. \? for
+// the start of a query string.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	escaped := false
+	for _, part := range strings.SplitAfter(glob, "") {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(part))
+			escaped = false
+		case part == "\\":
+			escaped = true
+		case part == "*":
+			b.WriteString(".*")
+		case part == "?":
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+	if escaped {
+		b.WriteString(regexp.QuoteMeta("\\"))
+	}
+	return b.String()
+}
+
+// Match returns the rules that match page, in rule order. A URL that can't be
+// parsed only matches keyword rules.
+func (m *Matcher) Match(page Page) []Rule {
+	p := parsedPage{full: page.URL, title: strings.ToLower(page.Title)}
+	if u, err := url.Parse(strings.TrimSpace(page.URL)); err == nil && u.Host != "" {
+		if host, err := normalizeHost(u.Hostname()); err == nil {
+			p.host = host
+			p.key = pageKey(host, u)
+		}
+		p.bare = strings.ToLower(stripScheme(page.URL))
+	}
+
+	var matched []Rule
+	for i, match := range m.compiled {
+		if (p.host != "" || m.rules[i].Type == TypeKeyword) && match(p) {
+			matched = append(matched, m.rules[i])
+		}
+	}
+	return matched
+}
@@ -0,0 +1,80 @@
+package blocking
+
+import "testing"
+
+// mustRule normalizes pattern for use in a test rule set
+func mustRule(t *testing.T, ruleType, pattern string) Rule {
+	t.Helper()
+	normalized, err := Normalize(ruleType, pattern)
+	if err != nil {
+		t.Fatalf("Normalize(%q, %q): %v", ruleType, pattern, err)
+	}
+	return Rule{Type: ruleType, Pattern: normalized}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		ruleType string
+		pattern  string
+		page     Page
+		want     bool
+	}{
+		{"domain exact", TypeDomain, "example.com", Page{URL: "https://example.com/a"}, true},
+		{"domain skips subdomains", TypeDomain, "example.com", Page{URL: "https://news.example.com/"}, false},
+		{"domain is case-insensitive", TypeDomain, "example.com", Page{URL: "HTTPS://EXAMPLE.COM/"}, true},
+		{"subdomains match the domain", TypeDomainSubdomains, "example.com", Page{URL: "https://example.com/"}, true},
+		{"subdomains match www", TypeDomainSubdomains, "example.com", Page{URL: "http://www.example.com/"}, true},
+		{"subdomains match deep", TypeDomainSubdomains, "example.com", Page{URL: "https://a.b.example.com/"}, true},
+		{"subdomains need a dot", TypeDomainSubdomains, "example.com", Page{URL: "https://notexample.com/"}, false},
+		{"subdomains match punycode", TypeDomainSubdomains, "bücher.de", Page{URL: "https://xn--bcher-kva.de/"}, true},
+		{"prefix matches below", TypeURLPrefix, "reddit.com/r/all", Page{URL: "https://www.reddit.com/r/all/top"}, true},
+		{"prefix ignores other paths", TypeURLPrefix, "reddit.com/r/all", Page{URL: "https://reddit.com/r/golang"}, false},
+		{"prefix with query", TypeURLPrefix, "youtube.com/watch?v=abc", Page{URL: "https://youtube.com/watch?v=abc&t=1"}, true},
+		{"glob star", TypeGlob, "*.example.com/*", Page{URL: "https://news.example.com/today"}, true},
+		{"glob is anchored", TypeGlob, "example.com/a", Page{URL: "https://example.com/a/b"}, false},
+		{"glob question mark", TypeGlob, "example.com/?", Page{URL: "https://example.com/x"}, true},
+		{"glob escaped question mark", TypeGlob, `*watch\?v=*`, Page{URL: "https://youtube.com/watch?v=1"}, true},
+		{"glob escaped is literal", TypeGlob, `*watch\?v=*`, Page{URL: "https://youtube.com/watchXv=1"}, false},
+		{"legacy glob", TypeGlob, LegacyGlob("reddit.com/r/all"), Page{URL: "https://old.reddit.com/r/all/top"}, true},
+		{"regex", TypeRegex, `example\.com/(a|b)$`, Page{URL: "https://example.com/b"}, true},
+		{"regex is case-insensitive", TypeRegex, `EXAMPLE`, Page{URL: "https://example.com/"}, true},
+		{"keyword in title", TypeKeyword, "Poker", Page{URL: "https://example.com/", Title: "Online poker night"}, true},
+		{"keyword ignores URL", TypeKeyword, "poker", Page{URL: "https://poker.com/"}, false},
+		{"unparsable URL", TypeDomain, "example.com", Page{URL: "::not a url"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Compile([]Rule{mustRule(t, tt.ruleType, tt.pattern)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(m.Match(tt.page)) > 0; got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchReturnsRulesInOrder(t *testing.T) {
+	rules := []Rule{
+		mustRule(t, TypeKeyword, "news"),
+		mustRule(t, TypeDomain, "other.com"),
+		mustRule(t, TypeDomainSubdomains, "example.com"),
+	}
+	m, err := Compile(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := m.Match(Page{URL: "https://www.example.com/", Title: "Daily news"})
+	if len(got) != 2 || got[0] != rules[0] || got[1] != rules[2] {
+		t.Errorf("Match = %v, want [%v %v]", got, rules[0], rules[2])
+	}
+}
+
+func TestCompileRejectsUnknownType(t *testing.T) {
+	if _, err := Compile([]Rule{{Type: "wildcard", Pattern: "x"}}); err == nil {
+		t.Error("Compile accepted an unknown rule type")
+	}
+}
@@ -0,0 +1,99 @@
+package blocking
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Rule actions
+const (
+	// ActionBlock blocks the pages a rule matches
+	ActionBlock = "block"
+	// ActionAllow lets pages through: as an exception to block rules, and as
+	// the allowlist in allowlist mode
+	ActionAllow = "allow"
+)
+
+// Blocking modes
+const (
+	// ModeBlocklist blocks pages matching a block rule
+	ModeBlocklist = "blocklist"
+	// ModeAllowlist blocks every page that no allow rule matches. Clients
+	// switch to it while a deep-focus session is in a focus phase.
+	ModeAllowlist = "allowlist"
+)
+
+// Modes lists the blocking modes
+var Modes = []string{ModeBlocklist, ModeAllowlist}
+
+// ValidMode reports whether m is a known blocking mode
+func ValidMode(m string) bool {
+	return slices.Contains(Modes, m)
+}
+
+// ValidAction reports whether a is a known rule action
+func ValidAction(a string) bool {
+	return a == ActionBlock || a == ActionAllow
+}
+
+// Policy decides whether pages are blocked, given a mode and the block and
+// allow rules in effect
+type Policy struct {
+	mode  string
+	block *Matcher
+	allow *Matcher
+}
+
+// Decision is the outcome of checking a page against a Policy
+type Decision struct {
+	Blocked bool
+	// Block rules that matched. In allowlist mode a page can be blocked
+	// without any.
+	Matches []Rule
+	// Allow rules that matched; any of them lets the page through
+	Allowed []Rule
+}
+
+// NewPolicy compiles the block and allow rules for mode
+func NewPolicy(mode string, block, allow []Rule) (*Policy, error) {
+	blockMatcher, err := Compile(block)
+	if err != nil {
+		return nil, err
+	}
+	allowMatcher, err := Compile(allow)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{mode: mode, block: blockMatcher, allow: allowMatcher}, nil
+}
+
+// Check decides whether page is blocked. Allow rules take precedence over
+// block rules. Allowlist mode only blocks web pages, leaving the browser's own
+// pages alone.
+func (p *Policy) Check(page Page) Decision {
+	d := Decision{Matches: p.block.Match(page), Allowed: p.allow.Match(page)}
+	if len(d.Allowed) > 0 {
+		return d
+	}
+	if p.mode == ModeAllowlist {
+		u, err := url.Parse(strings.TrimSpace(page.URL))
+		d.Blocked = err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https")
+		return d
+	}
+	d.Blocked = len(d.Matches) > 0
+	return d
+}
+
+// CheckAction validates a rule's action for its type. Allow rules have to
+// match URLs; a keyword in the title can't vouch for a page.
+func CheckAction(action, ruleType string) error {
+	if !ValidAction(action) {
+		return errors.New("action must be block or allow")
+	}
+	if action == ActionAllow && ruleType == TypeKeyword {
+		return errors.New("allow rules can't be keywords")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package blocking
+
+import "testing"
+
+func TestPolicyCheck(t *testing.T) {
+	block := []Rule{mustRule(t, TypeDomainSubdomains, "youtube.com")}
+	allow := []Rule{
+		mustRule(t, TypeURLPrefix, "youtube.com/playlist?list=focus"),
+		mustRule(t, TypeDomainSubdomains, "docs.example.com"),
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		url         string
+		wantBlocked bool
+		wantMatches int
+		wantAllowed int
+	}{
+		{"blocklist blocks a match", ModeBlocklist, "https://youtube.com/watch?v=1", true, 1, 0},
+		{"blocklist lets others through", ModeBlocklist, "https://example.com/", false, 0, 0},
+		{"allow beats block", ModeBlocklist, "https://www.youtube.com/playlist?list=focus", false, 1, 1},
+		{"allowlist blocks unlisted pages", ModeAllowlist, "https://example.com/", true, 0, 0},
+		{"allowlist lets allowed pages through", ModeAllowlist, "https://docs.example.com/guide", false, 0, 1},
+		{"allowlist still reports block matches", ModeAllowlist, "https://youtube.com/", true, 1, 0},
+		{"allowlist ignores browser pages", ModeAllowlist, "chrome://newtab", false, 0, 0},
+		{"allowlist ignores local files", ModeAllowlist, "file:///home/me/notes.txt", false, 0, 0},
+		{"allowlist ignores unparsable URLs", ModeAllowlist, "::nonsense", false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPolicy(tt.mode, block, allow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := p.Check(Page{URL: tt.url})
+			if d.Blocked != tt.wantBlocked || len(d.Matches) != tt.wantMatches || len(d.Allowed) != tt.wantAllowed {
+				t.Errorf("Check = {Blocked:%v Matches:%d Allowed:%d}, want {Blocked:%v Matches:%d Allowed:%d}",
+					d.Blocked, len(d.Matches), len(d.Allowed), tt.wantBlocked, tt.wantMatches, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestCheckAction(t *testing.T) {
+	tests := []struct {
+		action, ruleType string
+		wantErr          bool
+	}{
+		{ActionBlock, TypeDomain, false},
+		{ActionBlock, TypeKeyword, false},
+		{ActionAllow, TypeURLPrefix, false},
+		{ActionAllow, TypeKeyword, true},
+		{"ignore", TypeDomain, true},
+		{"", TypeDomain, true},
+	}
+	for _, tt := range tests {
+		if err := CheckAction(tt.action, tt.ruleType); (err != nil) != tt.wantErr {
+			t.Errorf("CheckAction(%q, %q) error = %v, want error %v", tt.action, tt.ruleType, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidMode(t *testing.T) {
+	for _, mode := range Modes {
+		if !ValidMode(mode) {
+			t.Errorf("ValidMode(%q) = false", mode)
+		}
+	}
+	if ValidMode("whitelist") {
+		t.Error(`ValidMode("whitelist") = true`)
+	}
+}
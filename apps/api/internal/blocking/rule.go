@@ -0,0 +1,175 @@
+// Package blocking defines the block rule types shared by the API, the browser
+// extension and the mobile app, normalizes their patterns and matches them
+// against pages.
+package blocking
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// Rule types
+const (
+	// TypeDomain matches one host exactly, e.g. news.example.com
+	TypeDomain = "domain"
+	// TypeDomainSubdomains matches a domain and all of its subdomains
+	TypeDomainSubdomains = "domain_subdomains"
+	// TypeURLPrefix matches URLs starting with host and path, e.g.
+	// reddit.com/r/all, regardless of scheme and a leading www.
+	TypeURLPrefix = "url_prefix"
+	// TypeGlob matches the URL without its scheme against a pattern where *
+	// stands for any run of characters and ? for one character; a backslash
+	// escapes either
+	TypeGlob = "glob"
+	// TypeRegex matches the full URL against an RE2 regular expression
+	TypeRegex = "regex"
+	// TypeKeyword matches pages whose title contains a keyword
+	TypeKeyword = "keyword"
+)
+
+// Types lists the rule types in the order clients should offer them
+var Types = []string{TypeDomainSubdomains, TypeDomain, TypeURLPrefix, TypeGlob, TypeRegex, TypeKeyword}
+
+const (
+	maxPatternLength = 2048
+	maxRegexLength   = 512
+	minKeywordLength = 2
+)
+
+var lookup = idna.New(idna.MapForLookup(), idna.Transitional(false), idna.StrictDomainName(true))
+
+// ValidType reports whether t is a known rule type
+func ValidType(t string) bool {
+	return slices.Contains(Types, t)
+}
+
+// InferType picks a type for a pattern sent without one, the way older
+// clients did: bare domains block the domain and its subdomains, anything
+// else is matched anywhere in the URL
+func InferType(pattern string) string {
+	host := stripScheme(strings.TrimSpace(pattern))
+	host = strings.TrimSuffix(host, "/")
+	if host != "" && !strings.ContainsAny(host, "/*?") {
+		if _, err := normalizeHost(host); err == nil {
+			return TypeDomainSubdomains
+		}
+	}
+	return TypeGlob
+}
+
+// LegacyGlob turns a pattern an older client meant to match anywhere in the
+// URL into a glob, the same way migration 000031 converted stored ones: the
+// scheme and www. go, ? and backslashes are escaped and the result is wrapped
+// in *.
+func LegacyGlob(pattern string) string {
+	glob := strings.TrimPrefix(stripScheme(strings.TrimSpace(pattern)), "www.")
+	glob = strings.NewReplacer(`\`, `\\`, "?", `\?`).Replace(glob)
+	return "*" + glob + "*"
+}
+
+// Normalize validates pattern for ruleType and returns the form it's stored
+// and matched in. Domains are lowercased and converted to punycode, URL
+// prefixes and globs lose their scheme, and keywords are trimmed.
+func Normalize(ruleType, pattern string) (string, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return "", errors.New("pattern is required")
+	}
+	if len(pattern) > maxPatternLength {
+		return "", errors.New("pattern must be at most 2048 characters")
+	}
+
+	switch ruleType {
+	case TypeDomain, TypeDomainSubdomains:
+		host := stripScheme(pattern)
+		if i := strings.IndexAny(host, "/?#"); i >= 0 {
+			host = host[:i]
+		}
+		if ruleType == TypeDomainSubdomains {
+			host = strings.TrimPrefix(host, "*.")
+		}
+		host, err := normalizeHost(host)
+		if err != nil {
+			return "", err
+		}
+		if ruleType == TypeDomainSubdomains {
+			host = strings.TrimPrefix(host, "www.")
+		}
+		return host, nil
+
+	case TypeURLPrefix:
+		u, err := url.Parse("https://" + stripScheme(pattern))
+		if err != nil || u.Host == "" {
+			return "", errors.New("invalid URL prefix")
+		}
+		host, err := normalizeHost(u.Host)
+		if err != nil {
+			return "", err
+		}
+		return pageKey(host, u), nil
+
+	case TypeGlob:
+		glob := strings.ToLower(stripScheme(pattern))
+		if strings.Trim(glob, "*?") == "" {
+			return "", errors.New("glob must contain more than wildcards")
+		}
+		return glob, nil
+
+	case TypeRegex:
+		if len(pattern) > maxRegexLength {
+			return "", errors.New("regex must be at most 512 characters")
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return "", fmt.Errorf("invalid regex: %v", err)
+		}
+		return pattern, nil
+
+	case TypeKeyword:
+		if utf8.RuneCountInString(pattern) < minKeywordLength {
+			return "", errors.New("keyword must be at least 2 characters")
+		}
+		return pattern, nil
+	}
+	return "", fmt.Errorf("unknown rule type %q", ruleType)
+}
+
+// normalizeHost lowercases a host name and converts it to punycode
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h // ports don't matter for blocking
+	}
+	ascii, err := lookup.ToASCII(host)
+	if err != nil || ascii == "" {
+		return "", errors.New("invalid domain")
+	}
+	if !strings.Contains(ascii, ".") && ascii != "localhost" {
+		return "", errors.New("invalid domain")
+	}
+	return ascii, nil
+}
+
+// stripScheme removes a leading http:// or https:// (or any other scheme)
+func stripScheme(s string) string {
+	if i := strings.Index(s, "://"); i >= 0 && !strings.ContainsAny(s[:i], "/.*?") {
+		return s[i+3:]
+	}
+	return s
+}
+
+// pageKey is what URL prefixes are compared against: the host without www.,
+// then the path and query
+func pageKey(host string, u *url.URL) string {
+	key := strings.TrimPrefix(host, "www.") + u.EscapedPath()
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
@@ -0,0 +1,79 @@
+package blocking
+
+import "testing"
+
+func TestInferType(t *testing.T) {
+	tests := []struct {
+		pattern, want string
+	}{
+		{"example.com", TypeDomainSubdomains},
+		{"https://www.example.com/", TypeDomainSubdomains},
+		{"Bücher.de", TypeDomainSubdomains},
+		{"reddit.com/r/all", TypeGlob},
+		{"youtube.com/watch?v=", TypeGlob},
+		{"*.example.com", TypeGlob},
+		{"casino", TypeGlob},
+	}
+	for _, tt := range tests {
+		if got := InferType(tt.pattern); got != tt.want {
+			t.Errorf("InferType(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestLegacyGlob(t *testing.T) {
+	tests := []struct {
+		pattern, want string
+	}{
+		{"reddit.com/r/all", "*reddit.com/r/all*"},
+		{"https://www.youtube.com/watch?v=", `*youtube.com/watch\?v=*`},
+		{` casino `, "*casino*"},
+		{`a\b`, `*a\\b*`},
+	}
+	for _, tt := range tests {
+		if got := LegacyGlob(tt.pattern); got != tt.want {
+			t.Errorf("LegacyGlob(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		ruleType string
+		pattern  string
+		want     string
+		wantErr  bool
+	}{
+		{"domain lowercased", TypeDomain, "News.Example.COM", "news.example.com", false},
+		{"domain keeps www", TypeDomain, "https://www.example.com/path", "www.example.com", false},
+		{"domain drops port", TypeDomain, "example.com:8080", "example.com", false},
+		{"domain punycode", TypeDomain, "bücher.de", "xn--bcher-kva.de", false},
+		{"domain needs a dot", TypeDomain, "intranet", "", true},
+		{"localhost is allowed", TypeDomain, "localhost", "localhost", false},
+		{"subdomains drop www", TypeDomainSubdomains, "www.example.com", "example.com", false},
+		{"subdomains drop wildcard", TypeDomainSubdomains, "*.example.com", "example.com", false},
+		{"url prefix", TypeURLPrefix, "https://www.Reddit.com/r/all", "reddit.com/r/all", false},
+		{"url prefix keeps query", TypeURLPrefix, "youtube.com/watch?v=abc", "youtube.com/watch?v=abc", false},
+		{"url prefix needs host", TypeURLPrefix, "/r/all", "", true},
+		{"glob drops scheme", TypeGlob, "https://*.Example.com/*", "*.example.com/*", false},
+		{"glob of wildcards", TypeGlob, "*?*", "", true},
+		{"regex kept", TypeRegex, `^https?://(www\.)?example\.com/`, `^https?://(www\.)?example\.com/`, false},
+		{"invalid regex", TypeRegex, "(", "", true},
+		{"keyword trimmed", TypeKeyword, "  poker ", "poker", false},
+		{"keyword too short", TypeKeyword, "x", "", true},
+		{"empty pattern", TypeDomain, "   ", "", true},
+		{"unknown type", "wildcard", "example.com", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.ruleType, tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Normalize(%q, %q) error = %v, want error %v", tt.ruleType, tt.pattern, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q, %q) = %q, want %q", tt.ruleType, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"time"
 )
 
@@ -11,12 +12,42 @@ type Config struct {
 	JWTSecret          string
 	AccessTokenExpiry  time.Duration
 	RefreshTokenExpiry time.Duration
+	// Asymmetric signing: when JWTKeysDir is set, tokens are signed with <JWTActiveKeyID>.pem
+	// from that directory and every other key there still verifies (the rotation window)
+	JWTKeysDir     string
+	JWTActiveKeyID string
+	JWTAcceptHS256 bool // keep accepting JWT_SECRET tokens while switching over
+	// Login throttling backend: "memory" (single instance) or "postgres" (shared)
+	RateLimitBackend string
+	// Proxies (addresses or CIDR ranges) whose X-Forwarded-For header is believed
+	TrustedProxies []string
 	// MinIO settings
 	MinioEndpoint  string
 	MinioAccessKey string
 	MinioSecretKey string
 	MinioBucket    string
 	MinioUseSSL    bool
+	// Mail settings
+	AppURL       string // base URL of the web app, used to build links in emails
+	MailDriver   string // "smtp" or "log"
+	MailFrom     string
+	MailDir      string // log driver only: directory to write .eml files to
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// OAuth / OIDC login
+	APIURL             string   // public base URL of this API, used for provider callbacks
+	OAuthRedirectURLs  []string // prefixes clients may ask to be sent back to after login
+	GoogleClientID     string
+	GoogleClientSecret string
+	GitHubClientID     string
+	GitHubClientSecret string
+	OIDCName           string // generic provider, e.g. a company IdP or a local mock
+	OIDCIssuer         string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCScopes         []string
 }
 
 func Load() *Config {
@@ -26,12 +57,40 @@ func Load() *Config {
 		JWTSecret:          getEnv("JWT_SECRET", "dev-secret-change-in-production"),
 		AccessTokenExpiry:  15 * time.Minute,
 		RefreshTokenExpiry: 30 * 24 * time.Hour, // 30 days
+		// Signing keys default to HS256 with JWT_SECRET
+		JWTKeysDir:     getEnv("JWT_KEYS_DIR", ""),
+		JWTActiveKeyID: getEnv("JWT_ACTIVE_KEY_ID", ""),
+		JWTAcceptHS256: getEnv("JWT_ACCEPT_HS256", "false") == "true",
+		// Login throttling
+		RateLimitBackend: getEnv("RATE_LIMIT_BACKEND", "memory"),
+		TrustedProxies:   getEnvList("TRUSTED_PROXIES", ""),
 		// MinIO defaults for local dev
 		MinioEndpoint:  getEnv("MINIO_ENDPOINT", "localhost:9000"),
 		MinioAccessKey: getEnv("MINIO_ACCESS_KEY", "wakeup"),
 		MinioSecretKey: getEnv("MINIO_SECRET_KEY", "wakeup_dev"),
 		MinioBucket:    getEnv("MINIO_BUCKET", "wakeup-files"),
 		MinioUseSSL:    getEnv("MINIO_USE_SSL", "false") == "true",
+		// Mail defaults log to stdout so local dev needs no SMTP server
+		AppURL:       getEnv("APP_URL", "http://localhost:3000"),
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "Wakeup <no-reply@wakeup.local>"),
+		MailDir:      getEnv("MAIL_DIR", ""),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		// OAuth providers are only enabled when their client id is set
+		APIURL:             getEnv("API_URL", "http://localhost:8080"),
+		OAuthRedirectURLs:  getEnvList("OAUTH_REDIRECT_URLS", getEnv("APP_URL", "http://localhost:3000")),
+		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
+		OIDCName:           getEnv("OIDC_NAME", "oidc"),
+		OIDCIssuer:         getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:       getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCScopes:         getEnvList("OIDC_SCOPES", "openid,email,profile"),
 	}
 }
 
@@ -41,3 +100,14 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvList reads a comma-separated list, skipping empty entries
+func getEnvList(key, fallback string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,256 @@
+package focus
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// EventGoalReached is sent the first time a goal is met in a period
+	EventGoalReached = "goal.reached"
+
+	goalTrackerInterval = time.Minute
+)
+
+// goalsSQL lists goals with the owner's time zone and the date_trunc unit and
+// length of their period
+const goalsSQL = `
+	SELECT g.id, g.user_id, g.period, g.metric, g.target, g.created_at, g.updated_at,
+	       p.timezone AS tz,
+	       CASE g.period WHEN 'daily' THEN 'day' ELSE 'week' END AS unit,
+	       CASE g.period WHEN 'daily' THEN interval '1 day' ELSE interval '1 week' END AS step
+	FROM focus_goals g
+	JOIN profiles p ON p.id = g.user_id`
+
+// goalAchievedSQL is progress towards goal g over the local-time period
+// starting at period_start: net focus minutes, or completed sessions
+const goalAchievedSQL = `
+	CASE g.metric
+	WHEN 'minutes' THEN (
+	    SELECT (COALESCE(SUM(EXTRACT(EPOCH FROM COALESCE(i.ended_at, NOW()) - i.started_at)), 0) / 60)::int
+	    FROM session_intervals i
+	    JOIN focus_sessions s ON s.id = i.session_id
+	    WHERE s.user_id = g.user_id AND s.status <> 'canceled' AND i.phase = 'focus'
+	      AND i.started_at AT TIME ZONE g.tz >= period_start
+	      AND i.started_at AT TIME ZONE g.tz < period_start + g.step)
+	ELSE (
+	    SELECT COUNT(*)::int
+	    FROM focus_sessions s
+	    WHERE s.user_id = g.user_id AND s.status = 'completed'
+	      AND s.ended_at AT TIME ZONE g.tz >= period_start
+	      AND s.ended_at AT TIME ZONE g.tz < period_start + g.step)
+	END`
+
+// GoalTracker keeps goal_results up to date. The current period is evaluated
+// whenever a session changes and, for users with a running session, once a
+// minute so minute goals are announced as they are reached. Past periods are
+// finalized in the background so days without any focus show up as missed.
+type GoalTracker struct {
+	db  *pgxpool.Pool
+	hub *ws.Hub
+}
+
+func NewGoalTracker(db *pgxpool.Pool, hub *ws.Hub) *GoalTracker {
+	return &GoalTracker{db: db, hub: hub}
+}
+
+// Progress returns the user's goals with their progress in the current period
+func (t *GoalTracker) Progress(ctx context.Context, userID uuid.UUID) ([]model.FocusGoal, error) {
+	rows, err := t.db.Query(ctx,
+		`SELECT g.id, g.period, g.metric, g.target, g.created_at, g.updated_at,
+		        period_start::date, `+goalAchievedSQL+`
+		 FROM (`+goalsSQL+`) g
+		 CROSS JOIN LATERAL (SELECT date_trunc(g.unit, NOW() AT TIME ZONE g.tz) AS period_start) current
+		 WHERE g.user_id = $1
+		 ORDER BY g.period, g.metric`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []model.FocusGoal{}
+	for rows.Next() {
+		var g model.FocusGoal
+		var periodStart time.Time
+		progress := &model.GoalProgress{}
+		if err := rows.Scan(&g.ID, &g.Period, &g.Metric, &g.Target, &g.CreatedAt, &g.UpdatedAt,
+			&periodStart, &progress.Achieved); err != nil {
+			return nil, err
+		}
+		progress.PeriodStart = periodStart.Format("2006-01-02")
+		progress.Met = progress.Achieved >= g.Target
+		g.Progress = progress
+		goals = append(goals, g)
+	}
+	return goals, rows.Err()
+}
+
+// Evaluate records the user's progress for the current period and announces
+// goals that were just reached. Failures are logged; the caller has already
+// done its real work.
+func (t *GoalTracker) Evaluate(ctx context.Context, userID uuid.UUID) {
+	// The running period follows the goal's current target. reached_at only
+	// equals NOW() (the transaction time) for goals this statement met for
+	// the first time.
+	rows, err := t.db.Query(ctx,
+		`INSERT INTO goal_results (goal_id, period_start, target, achieved, met, reached_at)
+		 SELECT id, period_start::date, target, achieved, achieved >= target,
+		        CASE WHEN achieved >= target THEN NOW() END
+		 FROM (
+		     SELECT g.id, g.target, period_start, `+goalAchievedSQL+` AS achieved
+		     FROM (`+goalsSQL+`) g
+		     CROSS JOIN LATERAL (SELECT date_trunc(g.unit, NOW() AT TIME ZONE g.tz) AS period_start) current
+		     WHERE g.user_id = $1
+		 ) progress
+		 ON CONFLICT (goal_id, period_start) DO UPDATE
+		 SET target = EXCLUDED.target,
+		     achieved = EXCLUDED.achieved,
+		     met = EXCLUDED.met,
+		     reached_at = COALESCE(goal_results.reached_at, EXCLUDED.reached_at)
+		 RETURNING goal_id, reached_at = NOW()`,
+		userID,
+	)
+	if err != nil {
+		log.Printf("Failed to evaluate goals for %s: %v", userID, err)
+		return
+	}
+
+	var reached []uuid.UUID
+	for rows.Next() {
+		var goalID uuid.UUID
+		var justReached *bool
+		if err := rows.Scan(&goalID, &justReached); err != nil {
+			log.Printf("Failed to scan goal result: %v", err)
+			break
+		}
+		if justReached != nil && *justReached {
+			reached = append(reached, goalID)
+		}
+	}
+	rows.Close()
+
+	if len(reached) == 0 || t.hub == nil {
+		return
+	}
+
+	goals, err := t.Progress(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load goals for %s: %v", userID, err)
+		return
+	}
+	for _, goal := range goals {
+		for _, id := range reached {
+			if goal.ID == id {
+				t.hub.Broadcast([]uuid.UUID{userID}, ws.Event{Type: EventGoalReached, Data: goal})
+			}
+		}
+	}
+}
+
+// Recompute refreshes the user's finalized results from since onwards, for
+// when sessions are recorded after the fact
+func (t *GoalTracker) Recompute(ctx context.Context, userID uuid.UUID, since time.Time) error {
+	_, err := t.db.Exec(ctx,
+		`UPDATE goal_results
+		 SET achieved = progress.achieved, met = progress.achieved >= goal_results.target
+		 FROM (
+		     SELECT r.id, `+goalAchievedSQL+` AS achieved
+		     FROM goal_results r
+		     JOIN (`+goalsSQL+`) g ON g.id = r.goal_id
+		     WHERE g.user_id = $1 AND r.finalized
+		       AND r.period_start >= date_trunc(g.unit, $2::timestamptz AT TIME ZONE g.tz)
+		 ) progress
+		 WHERE goal_results.id = progress.id`,
+		userID, since,
+	)
+	return err
+}
+
+// Run re-evaluates running sessions and finalizes finished periods until ctx
+// is canceled
+func (t *GoalTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(goalTrackerInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.evaluateActive(ctx); err != nil {
+			log.Printf("Failed to evaluate goals of active sessions: %v", err)
+		}
+		if err := t.finalize(ctx); err != nil {
+			log.Printf("Failed to finalize goal results: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evaluateActive evaluates the goals of every user focusing right now
+func (t *GoalTracker) evaluateActive(ctx context.Context) error {
+	rows, err := t.db.Query(ctx,
+		`SELECT DISTINCT s.user_id
+		 FROM focus_sessions s
+		 JOIN focus_goals g ON g.user_id = s.user_id AND g.metric = 'minutes'
+		 WHERE s.status = 'active' AND s.phase = 'focus'`,
+	)
+	if err != nil {
+		return err
+	}
+	var users []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range users {
+		t.Evaluate(ctx, id)
+	}
+	return nil
+}
+
+// finalize writes the final result of every period that has ended since the
+// last finalized one (or since the goal was created), keeping the target that
+// applied while the period was running
+func (t *GoalTracker) finalize(ctx context.Context) error {
+	_, err := t.db.Exec(ctx,
+		`INSERT INTO goal_results (goal_id, period_start, target, achieved, met, reached_at, finalized)
+		 SELECT id, period_start::date, target, achieved, achieved >= target, NULL, true
+		 FROM (
+		     SELECT g.id, g.target, period_start, `+goalAchievedSQL+` AS achieved
+		     FROM (`+goalsSQL+`) g
+		     CROSS JOIN LATERAL generate_series(
+		         COALESCE(
+		             (SELECT MAX(r.period_start) + g.step FROM goal_results r WHERE r.goal_id = g.id AND r.finalized),
+		             date_trunc(g.unit, g.created_at AT TIME ZONE g.tz)
+		         ),
+		         date_trunc(g.unit, NOW() AT TIME ZONE g.tz) - g.step,
+		         g.step
+		     ) AS period_start
+		 ) progress
+		 ON CONFLICT (goal_id, period_start) DO UPDATE
+		 SET achieved = EXCLUDED.achieved,
+		     met = EXCLUDED.achieved >= goal_results.target,
+		     finalized = true`,
+	)
+	return err
+}
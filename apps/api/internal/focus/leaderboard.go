@@ -0,0 +1,82 @@
+package focus
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	rollupInterval = 5 * time.Minute
+	// rollupDays is how many recent days are recomputed on each refresh. It
+	// covers the longest leaderboard period (a month) plus time zone slack.
+	rollupDays = 32
+	// rollupRetentionDays is how long daily totals are kept
+	rollupRetentionDays = 90
+)
+
+// rollupSQL recomputes focus_daily_totals for recent days: net focus time of
+// non-canceled sessions per user and local day (in the user's own time zone),
+// with running intervals counted up to now. Days that no longer have any
+// focus time, e.g. because their session was canceled, are removed. The
+// oldest day is left out since the window only covers part of it.
+const rollupSQL = `
+	WITH totals AS (
+	    SELECT s.user_id,
+	           (i.started_at AT TIME ZONE p.timezone)::date AS day,
+	           SUM(EXTRACT(EPOCH FROM COALESCE(i.ended_at, NOW()) - i.started_at))::bigint AS secs
+	    FROM session_intervals i
+	    JOIN focus_sessions s ON s.id = i.session_id
+	    JOIN profiles p ON p.id = s.user_id
+	    WHERE s.status <> 'canceled' AND i.phase = 'focus'
+	      AND i.started_at >= NOW() - make_interval(days => $1)
+	    GROUP BY 1, 2
+	), recent AS (
+	    SELECT * FROM totals WHERE day >= (NOW() - make_interval(days => $1 - 1))::date
+	), upserted AS (
+	    INSERT INTO focus_daily_totals (user_id, day, focused_seconds, refreshed_at)
+	    SELECT user_id, day, secs, NOW() FROM recent
+	    ON CONFLICT (user_id, day) DO UPDATE
+	    SET focused_seconds = EXCLUDED.focused_seconds, refreshed_at = EXCLUDED.refreshed_at
+	)
+	DELETE FROM focus_daily_totals t
+	WHERE t.day < (NOW() - make_interval(days => $2))::date
+	   OR (t.day >= (NOW() - make_interval(days => $1 - 1))::date
+	       AND NOT EXISTS (SELECT 1 FROM recent r WHERE r.user_id = t.user_id AND r.day = t.day))`
+
+// LeaderboardRollup keeps focus_daily_totals, the per-day focus time the
+// leaderboard ranks friends by, up to date. Refreshes are idempotent, so
+// several API instances can each run one.
+type LeaderboardRollup struct {
+	db *pgxpool.Pool
+}
+
+func NewLeaderboardRollup(db *pgxpool.Pool) *LeaderboardRollup {
+	return &LeaderboardRollup{db: db}
+}
+
+// Run refreshes the rollup until ctx is canceled
+func (l *LeaderboardRollup) Run(ctx context.Context) {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.Refresh(ctx); err != nil {
+			log.Printf("Failed to refresh focus leaderboard totals: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh recomputes the daily totals of the last month
+func (l *LeaderboardRollup) Refresh(ctx context.Context) error {
+	_, err := l.db.Exec(ctx, rollupSQL, rollupDays, rollupRetentionDays)
+	return err
+}
@@ -0,0 +1,128 @@
+package focus
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"wakeup/api/internal/model"
+)
+
+// Limits on what a session can be annotated with
+const (
+	maxLabelLength   = 100
+	maxNotesLength   = 5000
+	maxTags          = 20
+	maxTagLength     = 32
+	maxTaskURLLength = 2048
+)
+
+// Metadata is what a session is annotated with, normalized for storage
+type Metadata struct {
+	Label   *string
+	Notes   *string
+	Tags    []string
+	TaskURL *string
+}
+
+// MetadataFromRequest validates the metadata a session is started with
+func MetadataFromRequest(req model.StartSessionRequest) (Metadata, error) {
+	return Metadata{Tags: []string{}}.Apply(model.UpdateSessionRequest{
+		Label:   &req.Label,
+		Notes:   &req.Notes,
+		Tags:    &req.Tags,
+		TaskURL: &req.TaskURL,
+	})
+}
+
+// Apply returns m with the fields present in req validated and replaced
+func (m Metadata) Apply(req model.UpdateSessionRequest) (Metadata, error) {
+	var err error
+	if req.Label != nil {
+		if m.Label, err = normalizeLabel(*req.Label); err != nil {
+			return Metadata{}, err
+		}
+	}
+	if req.Notes != nil {
+		if m.Notes, err = normalizeNotes(*req.Notes); err != nil {
+			return Metadata{}, err
+		}
+	}
+	if req.Tags != nil {
+		if m.Tags, err = normalizeTags(*req.Tags); err != nil {
+			return Metadata{}, err
+		}
+	}
+	if req.TaskURL != nil {
+		if m.TaskURL, err = normalizeTaskURL(*req.TaskURL); err != nil {
+			return Metadata{}, err
+		}
+	}
+	return m, nil
+}
+
+// Args returns the metadata as focus_sessions column values, in the order
+// label, notes, tags, task_url
+func (m Metadata) Args() []interface{} {
+	return []interface{}{m.Label, m.Notes, m.Tags, m.TaskURL}
+}
+
+// normalizeLabel trims a session label; an empty label clears it
+func normalizeLabel(label string) (*string, error) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(label) > maxLabelLength {
+		return nil, errors.New("label must be at most 100 characters")
+	}
+	return &label, nil
+}
+
+// normalizeNotes trims session notes; empty notes clear them
+func normalizeNotes(notes string) (*string, error) {
+	notes = strings.TrimSpace(notes)
+	if notes == "" {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return nil, errors.New("notes must be at most 5000 characters")
+	}
+	return &notes, nil
+}
+
+// normalizeTags lowercases and trims tags, dropping blanks and duplicates, so
+// "Writing" and "writing " are counted together in stats
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, errors.New("tags must be at most 32 characters")
+		}
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, errors.New("a session can have at most 20 tags")
+	}
+	return normalized, nil
+}
+
+// normalizeTaskURL checks that a task link is an absolute http(s) URL; an
+// empty link clears it
+func normalizeTaskURL(raw string) (*string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(raw) > maxTaskURLLength {
+		return nil, errors.New("task_url must be an http or https URL")
+	}
+	return &raw, nil
+}
@@ -0,0 +1,146 @@
+package focus
+
+import (
+	"errors"
+
+	"wakeup/api/internal/model"
+)
+
+// Session modes
+const (
+	ModeOpen     = "open"     // runs until stopped
+	ModeTimed    = "timed"    // a single focus phase of fixed length
+	ModePomodoro = "pomodoro" // focus phases separated by breaks
+)
+
+// Phases of a running session
+const (
+	PhaseFocus      = "focus"
+	PhaseShortBreak = "short_break"
+	PhaseLongBreak  = "long_break"
+)
+
+const maxPhaseMinutes = 8 * 60
+
+// Plan is the timer configuration a session is started with, in seconds
+type Plan struct {
+	Mode              string
+	FocusSeconds      int
+	ShortBreakSeconds int
+	LongBreakSeconds  int
+	LongBreakEvery    int
+	Cycles            int
+}
+
+// Presets are named plans clients can start without spelling out every interval
+var Presets = map[string]Plan{
+	"pomodoro": {
+		Mode:              ModePomodoro,
+		FocusSeconds:      25 * 60,
+		ShortBreakSeconds: 5 * 60,
+		LongBreakSeconds:  15 * 60,
+		LongBreakEvery:    4,
+		Cycles:            8,
+	},
+	"long_pomodoro": {
+		Mode:              ModePomodoro,
+		FocusSeconds:      50 * 60,
+		ShortBreakSeconds: 10 * 60,
+		LongBreakSeconds:  30 * 60,
+		LongBreakEvery:    2,
+		Cycles:            4,
+	},
+	"deep_work": {
+		Mode:         ModeTimed,
+		FocusSeconds: 90 * 60,
+		Cycles:       1,
+	},
+}
+
+// PlanFromRequest resolves a start request into a plan. A request naming no
+// preset and no focus length starts an open-ended session. Explicit fields
+// override the preset's values.
+func PlanFromRequest(req model.StartSessionRequest) (Plan, error) {
+	var plan Plan
+	if req.Preset != "" {
+		preset, ok := Presets[req.Preset]
+		if !ok {
+			return Plan{}, errors.New("unknown preset")
+		}
+		plan = preset
+	} else if req.FocusMinutes == nil {
+		return Plan{Mode: ModeOpen}, nil
+	}
+
+	minutes := []struct {
+		value *int
+		dest  *int
+	}{
+		{req.FocusMinutes, &plan.FocusSeconds},
+		{req.ShortBreakMinutes, &plan.ShortBreakSeconds},
+		{req.LongBreakMinutes, &plan.LongBreakSeconds},
+	}
+	for _, m := range minutes {
+		if m.value == nil {
+			continue
+		}
+		if *m.value < 1 || *m.value > maxPhaseMinutes {
+			return Plan{}, errors.New("durations must be between 1 and 480 minutes")
+		}
+		*m.dest = *m.value * 60
+	}
+	if req.Cycles != nil {
+		if *req.Cycles < 1 || *req.Cycles > 24 {
+			return Plan{}, errors.New("cycles must be between 1 and 24")
+		}
+		plan.Cycles = *req.Cycles
+	}
+	if req.LongBreakEvery != nil {
+		if *req.LongBreakEvery < 1 {
+			return Plan{}, errors.New("long_break_every must be at least 1")
+		}
+		plan.LongBreakEvery = *req.LongBreakEvery
+	}
+
+	if plan.Cycles == 0 {
+		plan.Cycles = 1
+	}
+	if plan.Cycles == 1 {
+		plan = Plan{Mode: ModeTimed, FocusSeconds: plan.FocusSeconds, Cycles: 1}
+		return plan, nil
+	}
+
+	// Several cycles need breaks between them; fill in whatever was left out
+	plan.Mode = ModePomodoro
+	if plan.ShortBreakSeconds == 0 {
+		plan.ShortBreakSeconds = Presets["pomodoro"].ShortBreakSeconds
+	}
+	if plan.LongBreakSeconds == 0 {
+		plan.LongBreakSeconds = plan.ShortBreakSeconds
+	}
+	if plan.LongBreakEvery == 0 {
+		plan.LongBreakEvery = plan.Cycles
+	}
+	return plan, nil
+}
+
+// nullable maps a zero plan value to NULL
+func nullable(v int) *int {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+// Args returns the plan as focus_sessions column values, in the order
+// mode, focus_seconds, short_break_seconds, long_break_seconds, long_break_every, cycles
+func (p Plan) Args() []interface{} {
+	return []interface{}{
+		p.Mode,
+		nullable(p.FocusSeconds),
+		nullable(p.ShortBreakSeconds),
+		nullable(p.LongBreakSeconds),
+		nullable(p.LongBreakEvery),
+		nullable(p.Cycles),
+	}
+}
@@ -0,0 +1,133 @@
+package focus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"wakeup/api/internal/model"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestPlanFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     model.StartSessionRequest
+		want    Plan
+		wantErr bool
+	}{
+		{
+			name: "open-ended",
+			req:  model.StartSessionRequest{},
+			want: Plan{Mode: ModeOpen},
+		},
+		{
+			name: "preset",
+			req:  model.StartSessionRequest{Preset: "pomodoro"},
+			want: Presets["pomodoro"],
+		},
+		{
+			name: "timed preset",
+			req:  model.StartSessionRequest{Preset: "deep_work"},
+			want: Plan{Mode: ModeTimed, FocusSeconds: 90 * 60, Cycles: 1},
+		},
+		{
+			name: "preset with overrides",
+			req:  model.StartSessionRequest{Preset: "pomodoro", FocusMinutes: intPtr(30), Cycles: intPtr(2)},
+			want: Plan{Mode: ModePomodoro, FocusSeconds: 30 * 60, ShortBreakSeconds: 5 * 60, LongBreakSeconds: 15 * 60, LongBreakEvery: 4, Cycles: 2},
+		},
+		{
+			name: "one cycle of a preset is timed",
+			req:  model.StartSessionRequest{Preset: "pomodoro", Cycles: intPtr(1)},
+			want: Plan{Mode: ModeTimed, FocusSeconds: 25 * 60, Cycles: 1},
+		},
+		{
+			name: "focus length alone is timed",
+			req:  model.StartSessionRequest{FocusMinutes: intPtr(45)},
+			want: Plan{Mode: ModeTimed, FocusSeconds: 45 * 60, Cycles: 1},
+		},
+		{
+			name: "cycles fill in breaks",
+			req:  model.StartSessionRequest{FocusMinutes: intPtr(20), Cycles: intPtr(3)},
+			want: Plan{Mode: ModePomodoro, FocusSeconds: 20 * 60, ShortBreakSeconds: 5 * 60, LongBreakSeconds: 5 * 60, LongBreakEvery: 3, Cycles: 3},
+		},
+		{
+			name: "long break defaults to the short one",
+			req:  model.StartSessionRequest{FocusMinutes: intPtr(20), ShortBreakMinutes: intPtr(3), Cycles: intPtr(4), LongBreakEvery: intPtr(2)},
+			want: Plan{Mode: ModePomodoro, FocusSeconds: 20 * 60, ShortBreakSeconds: 3 * 60, LongBreakSeconds: 3 * 60, LongBreakEvery: 2, Cycles: 4},
+		},
+		{name: "unknown preset", req: model.StartSessionRequest{Preset: "marathon"}, wantErr: true},
+		{name: "zero minutes", req: model.StartSessionRequest{FocusMinutes: intPtr(0)}, wantErr: true},
+		{name: "too many minutes", req: model.StartSessionRequest{FocusMinutes: intPtr(481)}, wantErr: true},
+		{name: "break too long", req: model.StartSessionRequest{FocusMinutes: intPtr(25), ShortBreakMinutes: intPtr(500)}, wantErr: true},
+		{name: "zero cycles", req: model.StartSessionRequest{FocusMinutes: intPtr(25), Cycles: intPtr(0)}, wantErr: true},
+		{name: "too many cycles", req: model.StartSessionRequest{FocusMinutes: intPtr(25), Cycles: intPtr(25)}, wantErr: true},
+		{name: "long break every zero", req: model.StartSessionRequest{Preset: "pomodoro", LongBreakEvery: intPtr(0)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PlanFromRequest(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PlanFromRequest error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("PlanFromRequest = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanArgs(t *testing.T) {
+	got := Plan{Mode: ModeTimed, FocusSeconds: 600, Cycles: 1}.Args()
+	want := []interface{}{ModeTimed, intPtr(600), (*int)(nil), (*int)(nil), (*int)(nil), intPtr(1)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Args = %v, want %v", got, want)
+	}
+}
+
+func TestNext(t *testing.T) {
+	pomodoro := func(phase string, cycle int) *model.FocusSession {
+		return &model.FocusSession{
+			Mode:              ModePomodoro,
+			FocusSeconds:      intPtr(25 * 60),
+			ShortBreakSeconds: intPtr(5 * 60),
+			LongBreakSeconds:  intPtr(15 * 60),
+			LongBreakEvery:    intPtr(2),
+			Cycles:            intPtr(4),
+			Phase:             phase,
+			CurrentCycle:      cycle,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		session *model.FocusSession
+		want    Transition
+	}{
+		{"focus to short break", pomodoro(PhaseFocus, 1), Transition{Phase: PhaseShortBreak, Cycle: 1, Duration: 5 * time.Minute}},
+		{"focus to long break", pomodoro(PhaseFocus, 2), Transition{Phase: PhaseLongBreak, Cycle: 2, Duration: 15 * time.Minute}},
+		{"short break to focus", pomodoro(PhaseShortBreak, 1), Transition{Phase: PhaseFocus, Cycle: 2, Duration: 25 * time.Minute}},
+		{"long break to focus", pomodoro(PhaseLongBreak, 2), Transition{Phase: PhaseFocus, Cycle: 3, Duration: 25 * time.Minute}},
+		{"last cycle is done", pomodoro(PhaseFocus, 4), Transition{Done: true}},
+		{
+			"timed session is done",
+			&model.FocusSession{Mode: ModeTimed, FocusSeconds: intPtr(3600), Cycles: intPtr(1), Phase: PhaseFocus, CurrentCycle: 1},
+			Transition{Done: true},
+		},
+		{
+			"no long breaks",
+			&model.FocusSession{Mode: ModePomodoro, FocusSeconds: intPtr(600), ShortBreakSeconds: intPtr(120), Cycles: intPtr(3), Phase: PhaseFocus, CurrentCycle: 2},
+			Transition{Phase: PhaseShortBreak, Cycle: 2, Duration: 2 * time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Next(tt.session); got != tt.want {
+				t.Errorf("Next = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package focus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"wakeup/api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// scheduleHorizon is how far ahead a schedule's occurrences are kept as
+// scheduled blocks. The scheduler tops it up as time passes.
+const scheduleHorizon = 7 * 24 * time.Hour
+
+// Weekdays in the order schedules list them, with their RRULE BYDAY codes
+var weekdayCodes = []string{"MO", "TU", "WE", "TH", "FR", "SA", "SU"}
+
+// Shorthands accepted in place of individual days
+var dayShorthands = map[string][]string{
+	"WEEKDAYS": {"MO", "TU", "WE", "TH", "FR"},
+	"WEEKENDS": {"SA", "SU"},
+	"DAILY":    weekdayCodes,
+}
+
+// ErrOccurrenceStarted rejects skipping an occurrence whose session already began
+var ErrOccurrenceStarted = errors.New("occurrence has already started")
+
+// OccurrenceError rejects a date that doesn't name an occurrence that can be
+// skipped or restored
+type OccurrenceError string
+
+func (e OccurrenceError) Error() string {
+	return string(e)
+}
+
+// Recurrence is a validated weekly window, ready for storage. Schedules and
+// time-scoped block rules are both stored as one.
+type Recurrence struct {
+	Name        *string
+	Days        []string
+	StartMinute int
+	EndMinute   int
+	Timezone    string
+}
+
+// RecurrenceFromRequest validates a schedule. timezone is used when the
+// request doesn't name one.
+func RecurrenceFromRequest(req model.UpsertScheduleRequest, timezone string) (Recurrence, error) {
+	name, err := normalizeLabel(req.Name)
+	if err != nil {
+		return Recurrence{}, errors.New("name must be at most 100 characters")
+	}
+	rec, err := WeeklyWindow(req.Days, req.StartTime, req.EndTime, req.Timezone, timezone)
+	if err != nil {
+		return Recurrence{}, err
+	}
+	if rec.length() > maxPhaseMinutes {
+		return Recurrence{}, errors.New("schedules can be at most 8 hours long")
+	}
+	rec.Name = name
+	return rec, nil
+}
+
+// WeeklyWindow validates a time window repeating on some days of the week,
+// e.g. weekdays 09:00-17:00. defaultTimezone is used when timezone is empty.
+func WeeklyWindow(weekdays []string, startTime, endTime, timezone, defaultTimezone string) (Recurrence, error) {
+	var rec Recurrence
+	var err error
+	days := map[string]bool{}
+	for _, day := range weekdays {
+		day = strings.ToUpper(strings.TrimSpace(day))
+		if expanded, ok := dayShorthands[day]; ok {
+			for _, d := range expanded {
+				days[d] = true
+			}
+			continue
+		}
+		if !slices.Contains(weekdayCodes, day) {
+			return Recurrence{}, fmt.Errorf("unknown day %q", day)
+		}
+		days[day] = true
+	}
+	if len(days) == 0 {
+		return Recurrence{}, errors.New("at least one day is required")
+	}
+	for _, code := range weekdayCodes {
+		if days[code] {
+			rec.Days = append(rec.Days, code)
+		}
+	}
+
+	if rec.StartMinute, err = parseClock(startTime); err != nil {
+		return Recurrence{}, errors.New("start_time must be HH:MM")
+	}
+	if rec.EndMinute, err = parseClock(endTime); err != nil {
+		return Recurrence{}, errors.New("end_time must be HH:MM")
+	}
+	if rec.length() == 0 {
+		return Recurrence{}, errors.New("end_time must differ from start_time")
+	}
+
+	rec.Timezone = defaultTimezone
+	if timezone != "" {
+		rec.Timezone = timezone
+	}
+	if _, err := time.LoadLocation(rec.Timezone); err != nil || rec.Timezone == "Local" {
+		return Recurrence{}, errors.New("invalid timezone")
+	}
+	return rec, nil
+}
+
+// length is how many minutes each occurrence lasts
+func (rec Recurrence) length() int {
+	return (rec.EndMinute - rec.StartMinute + 24*60) % (24 * 60)
+}
+
+// FormatClock formats minutes after midnight as HH:MM
+func FormatClock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+// ActiveAt reports whether t falls within one of the window's occurrences,
+// and when that next changes
+func (rec Recurrence) ActiveAt(t time.Time) (bool, time.Time, error) {
+	loc, err := time.LoadLocation(rec.Timezone)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	// An occurrence from yesterday may still be running past midnight
+	active := false
+	var next time.Time
+	day := t.In(loc).AddDate(0, 0, -1)
+	for i := 0; i < 9; i, day = i+1, day.AddDate(0, 0, 1) {
+		if !rec.occursOn(day) {
+			continue
+		}
+		start, end := rec.occurrence(day, loc)
+		if !start.After(t) && end.After(t) {
+			active = true
+		}
+		for _, boundary := range []time.Time{start, end} {
+			if boundary.After(t) && (next.IsZero() || boundary.Before(next)) {
+				next = boundary
+			}
+		}
+	}
+	return active, next, nil
+}
+
+// parseClock reads an HH:MM time of day as minutes after midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// occursOn reports whether the schedule has an occurrence starting on date's weekday
+func (rec Recurrence) occursOn(date time.Time) bool {
+	code := weekdayCodes[(int(date.Weekday())+6)%7]
+	return slices.Contains(rec.Days, code)
+}
+
+// occurrence returns the start and end of the occurrence starting on the
+// given local date. An end time before the start time falls on the next day.
+func (rec Recurrence) occurrence(date time.Time, loc *time.Location) (time.Time, time.Time) {
+	y, m, d := date.Date()
+	start := time.Date(y, m, d, rec.StartMinute/60, rec.StartMinute%60, 0, 0, loc)
+	endDay := d
+	if rec.EndMinute <= rec.StartMinute {
+		endDay++
+	}
+	end := time.Date(y, m, endDay, rec.EndMinute/60, rec.EndMinute%60, 0, 0, loc)
+	return start, end
+}
+
+// Args returns the recurrence as focus_schedules column values, in the order
+// name, days, start_minute, end_minute, timezone
+func (rec Recurrence) Args() []interface{} {
+	return []interface{}{rec.Name, rec.Days, rec.StartMinute, rec.EndMinute, rec.Timezone}
+}
+
+// ScheduleColumns is the focus_schedules select list matching ScanSchedule
+const ScheduleColumns = `id, name, days, start_minute, end_minute, timezone, enabled, created_at, updated_at`
+
+// ScanSchedule scans a row selected with ScheduleColumns
+func ScanSchedule(row pgx.Row, s *model.FocusSchedule) error {
+	var startMinute, endMinute int
+	err := row.Scan(&s.ID, &s.Name, &s.Days, &startMinute, &endMinute, &s.Timezone, &s.Enabled, &s.CreatedAt, &s.UpdatedAt)
+	s.StartTime, s.EndTime = FormatClock(startMinute), FormatClock(endMinute)
+	return err
+}
+
+// LoadSchedule loads a schedule with its upcoming occurrences
+func LoadSchedule(ctx context.Context, db Querier, scheduleID uuid.UUID) (model.FocusSchedule, error) {
+	var schedule model.FocusSchedule
+	err := ScanSchedule(db.QueryRow(ctx,
+		`SELECT `+ScheduleColumns+` FROM focus_schedules WHERE id = $1`,
+		scheduleID,
+	), &schedule)
+	if err != nil {
+		return schedule, err
+	}
+
+	rows, err := db.Query(ctx,
+		`SELECT `+BlockColumns+`
+		 FROM scheduled_focus_blocks
+		 WHERE schedule_id = $1 AND ends_at > NOW()
+		 ORDER BY starts_at`,
+		scheduleID,
+	)
+	if err != nil {
+		return schedule, err
+	}
+	defer rows.Close()
+
+	schedule.Upcoming = []model.ScheduledBlock{}
+	for rows.Next() {
+		var b model.ScheduledBlock
+		if err := ScanBlock(rows, &b); err != nil {
+			return schedule, err
+		}
+		schedule.Upcoming = append(schedule.Upcoming, b)
+	}
+	return schedule, rows.Err()
+}
+
+// loadRecurrence locks a schedule and reads its rule
+func loadRecurrence(ctx context.Context, tx pgx.Tx, scheduleID uuid.UUID) (rec Recurrence, userID uuid.UUID, enabled bool, materializedUntil *time.Time, err error) {
+	err = tx.QueryRow(ctx,
+		`SELECT user_id, name, days, start_minute, end_minute, timezone, enabled, materialized_until
+		 FROM focus_schedules WHERE id = $1
+		 FOR UPDATE`,
+		scheduleID,
+	).Scan(&userID, &rec.Name, &rec.Days, &rec.StartMinute, &rec.EndMinute, &rec.Timezone, &enabled, &materializedUntil)
+	return
+}
+
+// MaterializeSchedule creates scheduled blocks for the schedule's occurrences
+// starting within the horizon that don't have one yet, and records how far it
+// got so occurrences whose block was deleted aren't brought back. Occurrences
+// that were skipped keep their skip but pick up the schedule's current times.
+func MaterializeSchedule(ctx context.Context, tx pgx.Tx, scheduleID uuid.UUID, now time.Time) error {
+	rec, userID, enabled, materializedUntil, err := loadRecurrence(ctx, tx, scheduleID)
+	if err != nil || !enabled {
+		return err
+	}
+	loc, err := time.LoadLocation(rec.Timezone)
+	if err != nil {
+		return err
+	}
+
+	until := now.Add(scheduleHorizon)
+	// Start a day early to catch an occurrence from yesterday still running past midnight
+	day := now.In(loc).AddDate(0, 0, -1)
+	for ; ; day = day.AddDate(0, 0, 1) {
+		if !rec.occursOn(day) {
+			if day.After(until) {
+				break
+			}
+			continue
+		}
+		start, end := rec.occurrence(day, loc)
+		if !start.Before(until) {
+			break
+		}
+		if !end.After(now) || (materializedUntil != nil && start.Before(*materializedUntil)) {
+			continue
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO scheduled_focus_blocks (user_id, title, starts_at, ends_at, source, schedule_id, occurrence_date)
+			 VALUES ($1, $2, $3, $4, 'schedule', $5, $6)
+			 ON CONFLICT (schedule_id, occurrence_date) WHERE schedule_id IS NOT NULL DO UPDATE
+			 SET title = EXCLUDED.title, starts_at = EXCLUDED.starts_at, ends_at = EXCLUDED.ends_at, updated_at = NOW()
+			 WHERE scheduled_focus_blocks.status = 'skipped'`,
+			userID, rec.Name, start, end, scheduleID, day.Format("2006-01-02"),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE focus_schedules SET materialized_until = $2 WHERE id = $1`,
+		scheduleID, until,
+	)
+	return err
+}
+
+// ResetSchedule drops the schedule's blocks that haven't started yet and
+// materializes them again, after its rule changed or it was turned on or off
+func ResetSchedule(ctx context.Context, tx pgx.Tx, scheduleID uuid.UUID, now time.Time) error {
+	_, err := tx.Exec(ctx,
+		`DELETE FROM scheduled_focus_blocks
+		 WHERE schedule_id = $1 AND status = 'scheduled' AND starts_at > $2`,
+		scheduleID, now,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE focus_schedules SET materialized_until = NULL WHERE id = $1`,
+		scheduleID,
+	)
+	if err != nil {
+		return err
+	}
+	return MaterializeSchedule(ctx, tx, scheduleID, now)
+}
+
+// SkipOccurrence marks the occurrence starting on date (YYYY-MM-DD in the
+// schedule's time zone) as skipped, creating its block if the occurrence is
+// beyond the horizon. Skipping twice is a no-op.
+func SkipOccurrence(ctx context.Context, tx pgx.Tx, scheduleID uuid.UUID, date string, now time.Time) error {
+	rec, userID, _, _, err := loadRecurrence(ctx, tx, scheduleID)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(rec.Timezone)
+	if err != nil {
+		return err
+	}
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return OccurrenceError("date must be YYYY-MM-DD")
+	}
+	if !rec.occursOn(day) {
+		return OccurrenceError("the schedule has no occurrence on that date")
+	}
+	start, end := rec.occurrence(day, loc)
+	if !end.After(now) {
+		return OccurrenceError("occurrence is already over")
+	}
+	if start.After(now.AddDate(1, 0, 0)) {
+		return OccurrenceError("occurrences can be skipped at most a year ahead")
+	}
+
+	var status string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO scheduled_focus_blocks (user_id, title, starts_at, ends_at, source, status, schedule_id, occurrence_date)
+		 VALUES ($1, $2, $3, $4, 'schedule', 'skipped', $5, $6)
+		 ON CONFLICT (schedule_id, occurrence_date) WHERE schedule_id IS NOT NULL DO UPDATE
+		 SET status = 'skipped', updated_at = NOW()
+		 WHERE scheduled_focus_blocks.status <> 'started'
+		 RETURNING status`,
+		userID, rec.Name, start, end, scheduleID, date,
+	).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOccurrenceStarted
+	}
+	return err
+}
+
+// UnskipOccurrence schedules a skipped occurrence again, if it isn't over.
+// It reports whether there was such an occurrence.
+func UnskipOccurrence(ctx context.Context, tx pgx.Tx, scheduleID uuid.UUID, date string) (bool, error) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return false, OccurrenceError("date must be YYYY-MM-DD")
+	}
+	result, err := tx.Exec(ctx,
+		`UPDATE scheduled_focus_blocks SET status = 'scheduled', updated_at = NOW()
+		 WHERE schedule_id = $1 AND occurrence_date = $2 AND status = 'skipped' AND ends_at > NOW()`,
+		scheduleID, date,
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// extendSchedules tops up the horizon of one batch of enabled schedules
+func (s *Scheduler) extendSchedules(ctx context.Context) (int, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT id FROM focus_schedules
+		 WHERE enabled AND (materialized_until IS NULL OR materialized_until < $1)
+		 LIMIT $2
+		 FOR UPDATE SKIP LOCKED`,
+		time.Now().Add(scheduleHorizon-time.Hour), schedulerBatch,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var due []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, id)
+	}
+	rows.Close()
+
+	now := time.Now()
+	for _, id := range due {
+		if err := MaterializeSchedule(ctx, tx, id, now); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), tx.Commit(ctx)
+}
@@ -0,0 +1,181 @@
+package focus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"wakeup/api/internal/model"
+)
+
+func TestRecurrenceFromRequest(t *testing.T) {
+	name := "Deep work"
+	tests := []struct {
+		name    string
+		req     model.UpsertScheduleRequest
+		want    Recurrence
+		wantErr bool
+	}{
+		{
+			name: "days are sorted and deduplicated",
+			req:  model.UpsertScheduleRequest{Name: name, Days: []string{"fr", " MO ", "FR"}, StartTime: "09:00", EndTime: "12:30"},
+			want: Recurrence{Name: &name, Days: []string{"MO", "FR"}, StartMinute: 9 * 60, EndMinute: 12*60 + 30, Timezone: "UTC"},
+		},
+		{
+			name: "shorthands",
+			req:  model.UpsertScheduleRequest{Days: []string{"WEEKENDS", "MO"}, StartTime: "08:00", EndTime: "09:00", Timezone: "Europe/Berlin"},
+			want: Recurrence{Days: []string{"MO", "SA", "SU"}, StartMinute: 8 * 60, EndMinute: 9 * 60, Timezone: "Europe/Berlin"},
+		},
+		{
+			name: "past midnight",
+			req:  model.UpsertScheduleRequest{Days: []string{"DAILY"}, StartTime: "22:00", EndTime: "06:00"},
+			want: Recurrence{Days: weekdayCodes, StartMinute: 22 * 60, EndMinute: 6 * 60, Timezone: "UTC"},
+		},
+		{name: "no days", req: model.UpsertScheduleRequest{StartTime: "09:00", EndTime: "10:00"}, wantErr: true},
+		{name: "unknown day", req: model.UpsertScheduleRequest{Days: []string{"MON"}, StartTime: "09:00", EndTime: "10:00"}, wantErr: true},
+		{name: "bad start", req: model.UpsertScheduleRequest{Days: []string{"MO"}, StartTime: "9am", EndTime: "10:00"}, wantErr: true},
+		{name: "bad end", req: model.UpsertScheduleRequest{Days: []string{"MO"}, StartTime: "09:00", EndTime: "24:00"}, wantErr: true},
+		{name: "empty window", req: model.UpsertScheduleRequest{Days: []string{"MO"}, StartTime: "09:00", EndTime: "09:00"}, wantErr: true},
+		{name: "longer than 8 hours", req: model.UpsertScheduleRequest{Days: []string{"MO"}, StartTime: "09:00", EndTime: "17:01"}, wantErr: true},
+		{name: "bad timezone", req: model.UpsertScheduleRequest{Days: []string{"MO"}, StartTime: "09:00", EndTime: "10:00", Timezone: "Mars/Olympus"}, wantErr: true},
+		{name: "local timezone", req: model.UpsertScheduleRequest{Days: []string{"MO"}, StartTime: "09:00", EndTime: "10:00", Timezone: "Local"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RecurrenceFromRequest(tt.req, "UTC")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RecurrenceFromRequest error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RecurrenceFromRequest = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceOccurrence(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end int
+		date       time.Time
+		wantStart  time.Time
+		wantLength time.Duration
+	}{
+		{
+			name: "same day", start: 9 * 60, end: 17 * 60,
+			date:      time.Date(2026, 10, 19, 0, 0, 0, 0, berlin),
+			wantStart: time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC), wantLength: 8 * time.Hour,
+		},
+		{
+			name: "past midnight", start: 22 * 60, end: 6 * 60,
+			date:      time.Date(2026, 10, 19, 0, 0, 0, 0, berlin),
+			wantStart: time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC), wantLength: 8 * time.Hour,
+		},
+		{
+			// Clocks go forward at 02:00 on 29 March 2026
+			name: "across spring forward", start: 1 * 60, end: 4 * 60,
+			date:      time.Date(2026, 3, 29, 0, 0, 0, 0, berlin),
+			wantStart: time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC), wantLength: 2 * time.Hour,
+		},
+		{
+			// Clocks go back at 03:00 on 25 October 2026
+			name: "overnight across fall back", start: 22 * 60, end: 6 * 60,
+			date:      time.Date(2026, 10, 24, 0, 0, 0, 0, berlin),
+			wantStart: time.Date(2026, 10, 24, 20, 0, 0, 0, time.UTC), wantLength: 9 * time.Hour,
+		},
+		{
+			name: "end of month", start: 23 * 60, end: 30,
+			date:      time.Date(2026, 10, 31, 0, 0, 0, 0, berlin),
+			wantStart: time.Date(2026, 10, 31, 22, 0, 0, 0, time.UTC), wantLength: 90 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := Recurrence{Days: weekdayCodes, StartMinute: tt.start, EndMinute: tt.end, Timezone: "Europe/Berlin"}
+			start, end := rec.occurrence(tt.date, berlin)
+			if !start.Equal(tt.wantStart) {
+				t.Errorf("start = %v, want %v", start.UTC(), tt.wantStart)
+			}
+			if got := end.Sub(start); got != tt.wantLength {
+				t.Errorf("length = %v, want %v", got, tt.wantLength)
+			}
+		})
+	}
+}
+
+func TestRecurrenceOccursOn(t *testing.T) {
+	rec := Recurrence{Days: []string{"MO", "SU"}}
+	tests := []struct {
+		date time.Time
+		want bool
+	}{
+		{time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), true},  // Monday
+		{time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC), false}, // Tuesday
+		{time.Date(2026, 10, 25, 12, 0, 0, 0, time.UTC), true},  // Sunday
+	}
+	for _, tt := range tests {
+		if got := rec.occursOn(tt.date); got != tt.want {
+			t.Errorf("occursOn(%s) = %v, want %v", tt.date.Weekday(), got, tt.want)
+		}
+	}
+}
+
+func TestRecurrenceActiveAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, berlin)
+	}
+	weekdays := Recurrence{Days: []string{"MO", "TU", "WE", "TH", "FR"}, StartMinute: 9 * 60, EndMinute: 17 * 60, Timezone: "Europe/Berlin"}
+	nights := Recurrence{Days: []string{"SA"}, StartMinute: 22 * 60, EndMinute: 6 * 60, Timezone: "Europe/Berlin"}
+
+	tests := []struct {
+		name       string
+		rec        Recurrence
+		t          time.Time
+		wantActive bool
+		wantNext   time.Time
+	}{
+		{"before the window", weekdays, at(10, 19, 8, 0), false, at(10, 19, 9, 0)},
+		{"at the start", weekdays, at(10, 19, 9, 0), true, at(10, 19, 17, 0)},
+		{"inside", weekdays, at(10, 19, 12, 30), true, at(10, 19, 17, 0)},
+		{"at the end", weekdays, at(10, 19, 17, 0), false, at(10, 20, 9, 0)},
+		{"friday evening waits for monday", weekdays, at(10, 23, 18, 0), false, at(10, 26, 9, 0)},
+		{"before an overnight window", nights, at(10, 24, 21, 0), false, at(10, 24, 22, 0)},
+		{"overnight before midnight", nights, at(10, 24, 23, 0), true, at(10, 25, 6, 0)},
+		// Sunday isn't a day of the schedule; Saturday's occurrence runs into it
+		{"overnight after midnight", nights, at(10, 25, 1, 0), true, at(10, 25, 6, 0)},
+		// 03:30 CET, after the clocks went back at 03:00 CEST; the night is an hour longer
+		{"overnight after fall back", nights, time.Date(2026, 10, 25, 2, 30, 0, 0, time.UTC), true, at(10, 25, 6, 0)},
+		{"last minute of a long night", nights, time.Date(2026, 10, 25, 4, 59, 0, 0, time.UTC), true, at(10, 25, 6, 0)},
+		{"after an overnight window", nights, at(10, 25, 7, 0), false, at(10, 31, 22, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, next, err := tt.rec.ActiveAt(tt.t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if active != tt.wantActive {
+				t.Errorf("active = %v, want %v", active, tt.wantActive)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("next = %v, want %v", next.In(berlin), tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestRecurrenceActiveAtInvalidTimezone(t *testing.T) {
+	rec := Recurrence{Days: weekdayCodes, StartMinute: 0, EndMinute: 60, Timezone: "Mars/Olympus"}
+	if _, _, err := rec.ActiveAt(time.Now()); err == nil {
+		t.Error("ActiveAt accepted an unknown time zone")
+	}
+}
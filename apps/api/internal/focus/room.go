@@ -0,0 +1,209 @@
+package focus
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"wakeup/api/internal/database"
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// EventRoomUpdated is sent to a room's participants whenever someone joins or
+// leaves, or the room's timer starts, changes phase or ends
+const EventRoomUpdated = "focus.room_updated"
+
+// ErrSessionRunning is returned when the user already has a running or paused
+// session of their own
+var ErrSessionRunning = errors.New("a focus session is already running")
+
+// Querier is satisfied by both *pgxpool.Pool and pgx.Tx
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// RoomColumns is the focus_rooms select list matching ScanRoom
+const RoomColumns = `id, name, host_id, nest_id, status,
+	mode, focus_seconds, short_break_seconds, long_break_seconds, long_break_every, cycles,
+	started_at, ended_at, created_at`
+
+// ScanRoom scans a row selected with RoomColumns
+func ScanRoom(row pgx.Row, room *model.FocusRoom) error {
+	return row.Scan(&room.ID, &room.Name, &room.HostID, &room.NestID, &room.Status,
+		&room.Mode, &room.FocusSeconds, &room.ShortBreakSeconds, &room.LongBreakSeconds, &room.LongBreakEvery, &room.Cycles,
+		&room.StartedAt, &room.EndedAt, &room.CreatedAt)
+}
+
+// LoadRoom loads a room with its current participants
+func LoadRoom(ctx context.Context, db Querier, roomID uuid.UUID) (model.FocusRoom, error) {
+	var room model.FocusRoom
+	err := ScanRoom(db.QueryRow(ctx,
+		`SELECT `+RoomColumns+` FROM focus_rooms WHERE id = $1`,
+		roomID,
+	), &room)
+	if err != nil {
+		return room, err
+	}
+
+	// Each participant's latest session in the room, if the room has started
+	rows, err := db.Query(ctx,
+		`SELECT m.user_id, p.display_name, m.joined_at,
+		        s.id, s.status, s.phase, s.current_cycle, s.phase_ends_at, s.phase_remaining_seconds
+		 FROM focus_room_members m
+		 JOIN profiles p ON p.id = m.user_id
+		 LEFT JOIN LATERAL (
+		     SELECT * FROM focus_sessions
+		     WHERE room_id = m.room_id AND user_id = m.user_id
+		     ORDER BY started_at DESC
+		     LIMIT 1
+		 ) s ON true
+		 WHERE m.room_id = $1 AND m.left_at IS NULL
+		 ORDER BY m.joined_at`,
+		roomID,
+	)
+	if err != nil {
+		return room, err
+	}
+	defer rows.Close()
+
+	room.Participants = []model.FocusRoomParticipant{}
+	for rows.Next() {
+		var p model.FocusRoomParticipant
+		if err := rows.Scan(&p.UserID, &p.DisplayName, &p.JoinedAt,
+			&p.SessionID, &p.SessionStatus, &p.Phase, &p.CurrentCycle, &p.PhaseEndsAt, &p.PhaseRemainingSeconds); err != nil {
+			return room, err
+		}
+		room.Participants = append(room.Participants, p)
+	}
+	return room, rows.Err()
+}
+
+// BroadcastRoom sends the room's current state to its participants and to
+// extra, e.g. someone who just left. Failures are only logged.
+func BroadcastRoom(ctx context.Context, db Querier, hub *ws.Hub, roomID uuid.UUID, extra ...uuid.UUID) {
+	if hub == nil {
+		return
+	}
+	room, err := LoadRoom(ctx, db, roomID)
+	if err != nil {
+		log.Printf("Failed to load focus room %s: %v", roomID, err)
+		return
+	}
+	recipients := extra
+	for _, p := range room.Participants {
+		recipients = append(recipients, p.UserID)
+	}
+	hub.Broadcast(recipients, ws.Event{Type: EventRoomUpdated, Data: room})
+}
+
+// StartRoomSession starts userID's session in a room whose timer starts now.
+// It returns ErrSessionRunning if userID has meanwhile started one elsewhere.
+func StartRoomSession(ctx context.Context, tx pgx.Tx, room model.FocusRoom, userID uuid.UUID, now time.Time) (uuid.UUID, error) {
+	var phaseEndsAt *time.Time
+	if room.FocusSeconds != nil {
+		t := now.Add(time.Duration(*room.FocusSeconds) * time.Second)
+		phaseEndsAt = &t
+	}
+
+	var sessionID uuid.UUID
+	err := tx.QueryRow(ctx,
+		`INSERT INTO focus_sessions (user_id, room_id, status, started_at, phase_started_at, phase_ends_at,
+		     mode, focus_seconds, short_break_seconds, long_break_seconds, long_break_every, cycles)
+		 VALUES ($1, $2, 'active', $3, $3, $4, $5, $6, $7, $8, $9, $10)
+		 ON CONFLICT (user_id) WHERE status IN ('active', 'paused') DO NOTHING
+		 RETURNING id`,
+		userID, room.ID, now, phaseEndsAt,
+		room.Mode, room.FocusSeconds, room.ShortBreakSeconds, room.LongBreakSeconds, room.LongBreakEvery, room.Cycles,
+	).Scan(&sessionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrSessionRunning
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return sessionID, OpenInterval(ctx, tx, sessionID, PhaseFocus, now)
+}
+
+// JoinRoomSession starts userID's session in a running room, lined up with the
+// phase the room is currently in. It returns pgx.ErrNoRows if nobody in the
+// room is still running, and ErrSessionRunning if userID has meanwhile
+// started a session elsewhere.
+func JoinRoomSession(ctx context.Context, tx pgx.Tx, roomID, userID uuid.UUID, now time.Time) (uuid.UUID, error) {
+	var sessionID uuid.UUID
+	var phase string
+	err := tx.QueryRow(ctx,
+		`INSERT INTO focus_sessions (user_id, room_id, status, started_at,
+		     mode, focus_seconds, short_break_seconds, long_break_seconds, long_break_every, cycles,
+		     phase, current_cycle, phase_started_at, phase_ends_at)
+		 SELECT $2, room_id, 'active', $3,
+		        mode, focus_seconds, short_break_seconds, long_break_seconds, long_break_every, cycles,
+		        phase, current_cycle, phase_started_at, phase_ends_at
+		 FROM focus_sessions
+		 WHERE room_id = $1 AND status = 'active'
+		 ORDER BY started_at
+		 LIMIT 1
+		 RETURNING id, phase`,
+		roomID, userID, now,
+	).Scan(&sessionID, &phase)
+	if database.IsUniqueViolation(err) {
+		return uuid.Nil, ErrSessionRunning
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return sessionID, OpenInterval(ctx, tx, sessionID, phase, now)
+}
+
+// EndRoomSessions completes every running session in the room
+func EndRoomSessions(ctx context.Context, tx pgx.Tx, roomID uuid.UUID, now time.Time) ([]model.FocusSession, error) {
+	_, err := tx.Exec(ctx,
+		`UPDATE session_intervals SET ended_at = GREATEST($2, started_at)
+		 WHERE ended_at IS NULL
+		   AND session_id IN (SELECT id FROM focus_sessions WHERE room_id = $1 AND status IN ('active', 'paused'))`,
+		roomID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx,
+		`UPDATE focus_sessions
+		 SET ended_at = $2, status = 'completed', phase_ends_at = NULL, phase_remaining_seconds = NULL
+		 WHERE room_id = $1 AND status IN ('active', 'paused')
+		 RETURNING `+SessionColumns,
+		roomID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []model.FocusSession
+	for rows.Next() {
+		var session model.FocusSession
+		if err := ScanSession(rows, &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// SettleRoom ends a running room once none of its sessions are running any more
+func SettleRoom(ctx context.Context, tx pgx.Tx, roomID uuid.UUID) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE focus_rooms SET status = 'ended', ended_at = NOW()
+		 WHERE id = $1 AND status = 'running'
+		   AND NOT EXISTS (
+		       SELECT 1 FROM focus_sessions WHERE room_id = $1 AND status IN ('active', 'paused')
+		   )`,
+		roomID,
+	)
+	return err
+}
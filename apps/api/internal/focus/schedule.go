@@ -0,0 +1,191 @@
+package focus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// EventBlockStarted is sent when a scheduled block starts its session
+	EventBlockStarted = "focus.block_started"
+	// EventBlockSkipped is sent when a block's time came but it couldn't start
+	EventBlockSkipped = "focus.block_skipped"
+)
+
+// minBlockSeconds is the shortest session a block is still started as; a
+// block found with less time left is skipped
+const minBlockSeconds = 60
+
+// maxBlockDuration caps a single scheduled block, matching the longest phase a
+// timed session can have
+const maxBlockDuration = maxPhaseMinutes * time.Minute
+
+// BlockColumns is the scheduled_focus_blocks select list matching ScanBlock
+const BlockColumns = `id, title, starts_at, ends_at, source, external_uid, status, session_id,
+	schedule_id, occurrence_date::text, created_at`
+
+// ScanBlock scans a row selected with BlockColumns
+func ScanBlock(row pgx.Row, b *model.ScheduledBlock) error {
+	return row.Scan(&b.ID, &b.Title, &b.StartsAt, &b.EndsAt, &b.Source, &b.ExternalUID, &b.Status, &b.SessionID,
+		&b.ScheduleID, &b.OccurrenceDate, &b.CreatedAt)
+}
+
+// ValidateBlock checks a block's title and times and returns the title
+// normalized for storage
+func ValidateBlock(title string, startsAt, endsAt time.Time) (*string, error) {
+	if startsAt.IsZero() || endsAt.IsZero() {
+		return nil, errors.New("starts_at and ends_at are required")
+	}
+	if !endsAt.After(startsAt) {
+		return nil, errors.New("ends_at must be after starts_at")
+	}
+	if endsAt.Sub(startsAt) > maxBlockDuration {
+		return nil, errors.New("blocks can be at most 8 hours long")
+	}
+	if !endsAt.After(time.Now()) {
+		return nil, errors.New("block is already over")
+	}
+	normalized, err := normalizeLabel(title)
+	if err != nil {
+		return nil, errors.New("title must be at most 100 characters")
+	}
+	return normalized, nil
+}
+
+// startDueBlocks turns one batch of scheduled blocks whose start time has come
+// into timed sessions running until the block's end, so they also stop on
+// their own. Blocks are skipped when their owner is already in a session or
+// the block is (nearly) over.
+func (s *Scheduler) startDueBlocks(ctx context.Context) (int, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT id, user_id, title, ends_at
+		 FROM scheduled_focus_blocks
+		 WHERE status = 'scheduled' AND starts_at <= NOW()
+		 ORDER BY starts_at
+		 LIMIT $1
+		 FOR UPDATE SKIP LOCKED`,
+		schedulerBatch,
+	)
+	if err != nil {
+		return 0, err
+	}
+	type dueBlock struct {
+		id, userID uuid.UUID
+		title      *string
+		endsAt     time.Time
+	}
+	var due []dueBlock
+	for rows.Next() {
+		var b dueBlock
+		if err := rows.Scan(&b.id, &b.userID, &b.title, &b.endsAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, b)
+	}
+	rows.Close()
+
+	now := time.Now()
+	var events []ws.Event
+	var users [][]uuid.UUID
+	for _, b := range due {
+		seconds := int(b.endsAt.Sub(now) / time.Second)
+		sessionID, err := startBlockSession(ctx, tx, b.userID, b.title, seconds, now)
+		if errors.Is(err, errBlockSkipped) {
+			var block model.ScheduledBlock
+			err = ScanBlock(tx.QueryRow(ctx,
+				`UPDATE scheduled_focus_blocks SET status = 'skipped', updated_at = NOW()
+				 WHERE id = $1
+				 RETURNING `+BlockColumns,
+				b.id,
+			), &block)
+			if err != nil {
+				return 0, err
+			}
+			events = append(events, ws.Event{Type: EventBlockSkipped, Data: model.FocusBlockEvent{Block: block}})
+			users = append(users, []uuid.UUID{b.userID})
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var block model.ScheduledBlock
+		err = ScanBlock(tx.QueryRow(ctx,
+			`UPDATE scheduled_focus_blocks SET status = 'started', session_id = $2, updated_at = NOW()
+			 WHERE id = $1
+			 RETURNING `+BlockColumns,
+			b.id, sessionID,
+		), &block)
+		if err != nil {
+			return 0, err
+		}
+		var session model.FocusSession
+		err = ScanSession(tx.QueryRow(ctx,
+			`SELECT `+SessionColumns+` FROM focus_sessions WHERE id = $1`,
+			sessionID,
+		), &session)
+		if err != nil {
+			return 0, err
+		}
+		events = append(events,
+			PhaseChangedEvent(session, ""),
+			ws.Event{Type: EventBlockStarted, Data: model.FocusBlockEvent{Block: block, Session: &session}},
+		)
+		users = append(users, []uuid.UUID{b.userID}, []uuid.UUID{b.userID})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	if s.hub != nil {
+		for i, event := range events {
+			s.hub.Broadcast(users[i], event)
+		}
+	}
+	return len(due), nil
+}
+
+var errBlockSkipped = errors.New("block skipped")
+
+// startBlockSession starts a timed session of the given length for userID,
+// or returns errBlockSkipped if that isn't possible
+func startBlockSession(ctx context.Context, tx pgx.Tx, userID uuid.UUID, title *string, seconds int, now time.Time) (uuid.UUID, error) {
+	if seconds < minBlockSeconds {
+		return uuid.Nil, errBlockSkipped
+	}
+
+	plan := Plan{Mode: ModeTimed, FocusSeconds: seconds, Cycles: 1}
+	args := append([]interface{}{userID, now, now.Add(time.Duration(seconds) * time.Second), title}, plan.Args()...)
+	var sessionID uuid.UUID
+	err := tx.QueryRow(ctx,
+		`INSERT INTO focus_sessions (user_id, status, started_at, phase_started_at, phase_ends_at, label,
+		     mode, focus_seconds, short_break_seconds, long_break_seconds, long_break_every, cycles)
+		 VALUES ($1, 'active', $2, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 ON CONFLICT (user_id) WHERE status IN ('active', 'paused') DO NOTHING
+		 RETURNING id`,
+		args...,
+	).Scan(&sessionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The user already has a running session
+		return uuid.Nil, errBlockSkipped
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return sessionID, OpenInterval(ctx, tx, sessionID, PhaseFocus, now)
+}
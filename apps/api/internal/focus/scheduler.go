@@ -0,0 +1,210 @@
+package focus
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// EventPhaseChanged is sent whenever a session starts, changes phase or ends
+	EventPhaseChanged = "focus.phase_changed"
+
+	schedulerInterval = time.Second
+	schedulerBatch    = 100
+)
+
+// PhaseChangedEvent builds the ws event announcing a session's new state
+func PhaseChangedEvent(session model.FocusSession, previousPhase string) ws.Event {
+	return ws.Event{
+		Type: EventPhaseChanged,
+		Data: model.FocusPhaseChangedEvent{Session: session, PreviousPhase: previousPhase},
+	}
+}
+
+// Scheduler advances timed and pomodoro sessions whose current phase has run
+// out, keeps the upcoming occurrences of recurring schedules in place as
+// scheduled focus blocks, and starts those blocks when they begin. Due rows
+// are locked with SKIP LOCKED so several API instances can each run one.
+type Scheduler struct {
+	db    *pgxpool.Pool
+	hub   *ws.Hub
+	goals *GoalTracker
+}
+
+func NewScheduler(db *pgxpool.Pool, hub *ws.Hub, goals *GoalTracker) *Scheduler {
+	return &Scheduler{db: db, hub: hub, goals: goals}
+}
+
+// Run polls for due sessions until ctx is canceled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			n, err := s.advanceDue(ctx)
+			if err != nil {
+				log.Printf("Failed to advance focus sessions: %v", err)
+				break
+			}
+			if n < schedulerBatch {
+				break
+			}
+		}
+		for {
+			n, err := s.extendSchedules(ctx)
+			if err != nil {
+				log.Printf("Failed to extend focus schedules: %v", err)
+				break
+			}
+			if n < schedulerBatch {
+				break
+			}
+		}
+		for {
+			n, err := s.startDueBlocks(ctx)
+			if err != nil {
+				log.Printf("Failed to start scheduled focus blocks: %v", err)
+				break
+			}
+			if n < schedulerBatch {
+				break
+			}
+		}
+	}
+}
+
+// advanceDue moves one batch of due sessions on and returns how many it handled
+func (s *Scheduler) advanceDue(ctx context.Context) (int, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT `+SessionColumns+`
+		 FROM focus_sessions
+		 WHERE status = 'active' AND phase_ends_at <= NOW()
+		 ORDER BY phase_ends_at
+		 LIMIT $1
+		 FOR UPDATE SKIP LOCKED`,
+		schedulerBatch,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var due []model.FocusSession
+	for rows.Next() {
+		var session model.FocusSession
+		if err := ScanSession(rows, &session); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, session)
+	}
+	rows.Close()
+
+	var events []ws.Event
+	var users [][]uuid.UUID
+	rooms := map[uuid.UUID]bool{}
+	for i := range due {
+		previousPhase := due[i].Phase
+		updated, err := advance(ctx, tx, &due[i])
+		if err != nil {
+			return 0, err
+		}
+		events = append(events, PhaseChangedEvent(updated, previousPhase))
+		users = append(users, []uuid.UUID{updated.UserID})
+		if updated.RoomID != nil {
+			rooms[*updated.RoomID] = true
+		}
+	}
+	for roomID := range rooms {
+		if err := SettleRoom(ctx, tx, roomID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	if s.hub != nil {
+		for i, event := range events {
+			s.hub.Broadcast(users[i], event)
+		}
+	}
+	for roomID := range rooms {
+		BroadcastRoom(ctx, s.db, s.hub, roomID)
+	}
+	for _, session := range due {
+		s.goals.Evaluate(ctx, session.UserID)
+	}
+	return len(due), nil
+}
+
+// advance steps a due session through as many phases as have elapsed (the
+// scheduler may have been down) and stores the result. Each phase is timed
+// from the end of the previous one so the schedule doesn't drift.
+func advance(ctx context.Context, tx pgx.Tx, session *model.FocusSession) (model.FocusSession, error) {
+	now := time.Now()
+	phaseEnd := *session.PhaseEndsAt
+
+	for {
+		if err := CloseInterval(ctx, tx, session.ID, phaseEnd); err != nil {
+			return model.FocusSession{}, err
+		}
+
+		next := Next(session)
+		if next.Done {
+			var updated model.FocusSession
+			err := ScanSession(tx.QueryRow(ctx,
+				`UPDATE focus_sessions
+				 SET status = 'completed', ended_at = $2, phase_ends_at = $2,
+				     phase = $3, current_cycle = $4, phase_started_at = $5
+				 WHERE id = $1
+				 RETURNING `+SessionColumns,
+				session.ID, phaseEnd, session.Phase, session.CurrentCycle, session.PhaseStartedAt,
+			), &updated)
+			return updated, err
+		}
+
+		if err := OpenInterval(ctx, tx, session.ID, next.Phase, phaseEnd); err != nil {
+			return model.FocusSession{}, err
+		}
+
+		session.Phase = next.Phase
+		session.CurrentCycle = next.Cycle
+		session.PhaseStartedAt = phaseEnd
+		phaseEnd = phaseEnd.Add(next.Duration)
+		session.PhaseEndsAt = &phaseEnd
+		if phaseEnd.After(now) {
+			break
+		}
+	}
+
+	var updated model.FocusSession
+	err := ScanSession(tx.QueryRow(ctx,
+		`UPDATE focus_sessions
+		 SET phase = $2, current_cycle = $3, phase_started_at = $4, phase_ends_at = $5
+		 WHERE id = $1
+		 RETURNING `+SessionColumns,
+		session.ID, session.Phase, session.CurrentCycle, session.PhaseStartedAt, session.PhaseEndsAt,
+	), &updated)
+	return updated, err
+}
@@ -0,0 +1,86 @@
+package focus
+
+import (
+	"context"
+	"time"
+
+	"wakeup/api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// SessionColumns is the focus_sessions select list matching ScanSession. It can
+// be used both after FROM focus_sessions and in RETURNING clauses.
+const SessionColumns = `id, user_id, started_at, ended_at, status, created_at,
+	mode, focus_seconds, short_break_seconds, long_break_seconds, long_break_every, cycles,
+	phase, current_cycle, phase_started_at, phase_ends_at, phase_remaining_seconds,
+	(SELECT COALESCE(SUM(EXTRACT(EPOCH FROM COALESCE(i.ended_at, NOW()) - i.started_at)), 0)::int
+	 FROM session_intervals i
+	 WHERE i.session_id = focus_sessions.id AND i.phase = 'focus'),
+	label, notes, tags, task_url, client_id, synced_at, room_id, block_mode`
+
+// ScanSession scans a row selected with SessionColumns
+func ScanSession(row pgx.Row, s *model.FocusSession) error {
+	return row.Scan(&s.ID, &s.UserID, &s.StartedAt, &s.EndedAt, &s.Status, &s.CreatedAt,
+		&s.Mode, &s.FocusSeconds, &s.ShortBreakSeconds, &s.LongBreakSeconds, &s.LongBreakEvery, &s.Cycles,
+		&s.Phase, &s.CurrentCycle, &s.PhaseStartedAt, &s.PhaseEndsAt, &s.PhaseRemainingSeconds,
+		&s.FocusedSeconds, &s.Label, &s.Notes, &s.Tags, &s.TaskURL,
+		&s.ClientID, &s.SyncedAt, &s.RoomID, &s.BlockMode)
+}
+
+// OpenInterval records that the session's timer is running in phase from at
+func OpenInterval(ctx context.Context, tx pgx.Tx, sessionID uuid.UUID, phase string, at time.Time) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO session_intervals (session_id, phase, started_at) VALUES ($1, $2, $3)`,
+		sessionID, phase, at,
+	)
+	return err
+}
+
+// CloseInterval ends the session's running interval, if any, at at
+func CloseInterval(ctx context.Context, tx pgx.Tx, sessionID uuid.UUID, at time.Time) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE session_intervals SET ended_at = GREATEST($2, started_at)
+		 WHERE session_id = $1 AND ended_at IS NULL`,
+		sessionID, at,
+	)
+	return err
+}
+
+// Transition is the state a session moves to when its current phase runs out
+type Transition struct {
+	Done     bool // the last focus phase finished; the session is complete
+	Phase    string
+	Cycle    int
+	Duration time.Duration
+}
+
+// Next works out what follows the session's current phase. Breaks always lead
+// into the next focus phase; a focus phase leads into a break unless it was
+// the last cycle, with every LongBreakEvery-th break being a long one.
+func Next(s *model.FocusSession) Transition {
+	cycles := 1
+	if s.Cycles != nil {
+		cycles = *s.Cycles
+	}
+
+	if s.Phase != PhaseFocus {
+		return Transition{Phase: PhaseFocus, Cycle: s.CurrentCycle + 1, Duration: seconds(s.FocusSeconds)}
+	}
+	if s.Mode != ModePomodoro || s.CurrentCycle >= cycles {
+		return Transition{Done: true}
+	}
+
+	if s.LongBreakEvery != nil && s.CurrentCycle%*s.LongBreakEvery == 0 {
+		return Transition{Phase: PhaseLongBreak, Cycle: s.CurrentCycle, Duration: seconds(s.LongBreakSeconds)}
+	}
+	return Transition{Phase: PhaseShortBreak, Cycle: s.CurrentCycle, Duration: seconds(s.ShortBreakSeconds)}
+}
+
+func seconds(v *int) time.Duration {
+	if v == nil {
+		return 0
+	}
+	return time.Duration(*v) * time.Second
+}
@@ -0,0 +1,86 @@
+package focus
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"wakeup/api/internal/model"
+)
+
+// Limits on sessions uploaded by offline clients
+const (
+	MaxSyncBatch = 100
+
+	maxSyncAge      = 30 * 24 * time.Hour // older sessions would rewrite settled history
+	maxSyncDuration = 24 * time.Hour
+	syncClockSkew   = 5 * time.Minute // allowed for client clocks running ahead
+)
+
+// Interval is a stretch of a session's timer running in one phase
+type Interval struct {
+	Phase     string
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// SyncIntervals validates a client-recorded session and returns its intervals
+// in order. A session without intervals is a single focus interval.
+func SyncIntervals(s model.SyncSession, now time.Time) ([]Interval, error) {
+	if s.Status != "" && s.Status != "completed" && s.Status != "canceled" {
+		return nil, errors.New("status must be completed or canceled")
+	}
+	if !s.EndedAt.After(s.StartedAt) {
+		return nil, errors.New("ended_at must be after started_at")
+	}
+	if s.EndedAt.After(now.Add(syncClockSkew)) {
+		return nil, errors.New("session ends in the future")
+	}
+	if s.StartedAt.Before(now.Add(-maxSyncAge)) {
+		return nil, errors.New("session is older than 30 days")
+	}
+	if s.EndedAt.Sub(s.StartedAt) > maxSyncDuration {
+		return nil, errors.New("session is longer than 24 hours")
+	}
+
+	if len(s.Intervals) == 0 {
+		return []Interval{{Phase: PhaseFocus, StartedAt: s.StartedAt, EndedAt: s.EndedAt}}, nil
+	}
+
+	intervals := make([]Interval, 0, len(s.Intervals))
+	for _, i := range s.Intervals {
+		if i.Phase != PhaseFocus && i.Phase != PhaseShortBreak && i.Phase != PhaseLongBreak {
+			return nil, errors.New("invalid interval phase")
+		}
+		if !i.EndedAt.After(i.StartedAt) {
+			return nil, errors.New("interval ended_at must be after started_at")
+		}
+		if i.StartedAt.Before(s.StartedAt) || i.EndedAt.After(s.EndedAt) {
+			return nil, errors.New("intervals must lie within the session")
+		}
+		intervals = append(intervals, Interval{Phase: i.Phase, StartedAt: i.StartedAt, EndedAt: i.EndedAt})
+	}
+
+	slices.SortFunc(intervals, func(a, b Interval) int { return a.StartedAt.Compare(b.StartedAt) })
+	for n := 1; n < len(intervals); n++ {
+		if intervals[n].StartedAt.Before(intervals[n-1].EndedAt) {
+			return nil, errors.New("intervals must not overlap")
+		}
+	}
+	return intervals, nil
+}
+
+// ClipIntervals drops whatever of intervals lies at or after at
+func ClipIntervals(intervals []Interval, at time.Time) []Interval {
+	clipped := []Interval{}
+	for _, i := range intervals {
+		if !i.StartedAt.Before(at) {
+			break
+		}
+		if i.EndedAt.After(at) {
+			i.EndedAt = at
+		}
+		clipped = append(clipped, i)
+	}
+	return clipped
+}
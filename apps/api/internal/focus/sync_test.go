@@ -0,0 +1,135 @@
+package focus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"wakeup/api/internal/model"
+)
+
+func TestSyncIntervals(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name    string
+		session model.SyncSession
+		want    []Interval
+		wantErr bool
+	}{
+		{
+			name:    "no intervals is one focus interval",
+			session: model.SyncSession{StartedAt: at(-60), EndedAt: at(-30)},
+			want:    []Interval{{Phase: PhaseFocus, StartedAt: at(-60), EndedAt: at(-30)}},
+		},
+		{
+			name: "intervals are sorted",
+			session: model.SyncSession{StartedAt: at(-60), EndedAt: at(-25), Status: "completed", Intervals: []model.SyncInterval{
+				{Phase: PhaseShortBreak, StartedAt: at(-35), EndedAt: at(-30)},
+				{Phase: PhaseFocus, StartedAt: at(-60), EndedAt: at(-35)},
+				{Phase: PhaseFocus, StartedAt: at(-30), EndedAt: at(-25)},
+			}},
+			want: []Interval{
+				{Phase: PhaseFocus, StartedAt: at(-60), EndedAt: at(-35)},
+				{Phase: PhaseShortBreak, StartedAt: at(-35), EndedAt: at(-30)},
+				{Phase: PhaseFocus, StartedAt: at(-30), EndedAt: at(-25)},
+			},
+		},
+		{
+			name: "gaps are pauses",
+			session: model.SyncSession{StartedAt: at(-60), EndedAt: at(-10), Status: "canceled", Intervals: []model.SyncInterval{
+				{Phase: PhaseFocus, StartedAt: at(-60), EndedAt: at(-50)},
+				{Phase: PhaseFocus, StartedAt: at(-20), EndedAt: at(-10)},
+			}},
+			want: []Interval{
+				{Phase: PhaseFocus, StartedAt: at(-60), EndedAt: at(-50)},
+				{Phase: PhaseFocus, StartedAt: at(-20), EndedAt: at(-10)},
+			},
+		},
+		{
+			name:    "client clock slightly ahead",
+			session: model.SyncSession{StartedAt: at(-30), EndedAt: at(4)},
+			want:    []Interval{{Phase: PhaseFocus, StartedAt: at(-30), EndedAt: at(4)}},
+		},
+		{name: "unknown status", session: model.SyncSession{StartedAt: at(-60), EndedAt: at(-30), Status: "active"}, wantErr: true},
+		{name: "ends before it starts", session: model.SyncSession{StartedAt: at(-30), EndedAt: at(-60)}, wantErr: true},
+		{name: "zero length", session: model.SyncSession{StartedAt: at(-30), EndedAt: at(-30)}, wantErr: true},
+		{name: "ends in the future", session: model.SyncSession{StartedAt: at(-30), EndedAt: at(10)}, wantErr: true},
+		{name: "too old", session: model.SyncSession{StartedAt: now.AddDate(0, 0, -31), EndedAt: now.AddDate(0, 0, -31).Add(time.Hour)}, wantErr: true},
+		{name: "too long", session: model.SyncSession{StartedAt: at(-25 * 60), EndedAt: at(-10)}, wantErr: true},
+		{
+			name: "invalid phase",
+			session: model.SyncSession{StartedAt: at(-60), EndedAt: at(-30), Intervals: []model.SyncInterval{
+				{Phase: "nap", StartedAt: at(-60), EndedAt: at(-30)},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "empty interval",
+			session: model.SyncSession{StartedAt: at(-60), EndedAt: at(-30), Intervals: []model.SyncInterval{
+				{Phase: PhaseFocus, StartedAt: at(-40), EndedAt: at(-40)},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "interval outside the session",
+			session: model.SyncSession{StartedAt: at(-60), EndedAt: at(-30), Intervals: []model.SyncInterval{
+				{Phase: PhaseFocus, StartedAt: at(-70), EndedAt: at(-40)},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "overlapping intervals",
+			session: model.SyncSession{StartedAt: at(-60), EndedAt: at(-30), Intervals: []model.SyncInterval{
+				{Phase: PhaseFocus, StartedAt: at(-60), EndedAt: at(-40)},
+				{Phase: PhaseShortBreak, StartedAt: at(-45), EndedAt: at(-30)},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SyncIntervals(tt.session, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SyncIntervals error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SyncIntervals = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClipIntervals(t *testing.T) {
+	base := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	intervals := []Interval{
+		{Phase: PhaseFocus, StartedAt: at(0), EndedAt: at(25)},
+		{Phase: PhaseShortBreak, StartedAt: at(25), EndedAt: at(30)},
+		{Phase: PhaseFocus, StartedAt: at(30), EndedAt: at(55)},
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want []Interval
+	}{
+		{"after the end", at(60), intervals},
+		{"at the end", at(55), intervals},
+		{"inside an interval", at(40), []Interval{intervals[0], intervals[1], {Phase: PhaseFocus, StartedAt: at(30), EndedAt: at(40)}}},
+		{"on a boundary", at(25), []Interval{intervals[0]}},
+		{"at the start", at(0), []Interval{}},
+		{"before the start", at(-10), []Interval{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClipIntervals(intervals, tt.at); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ClipIntervals = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if intervals[2].EndedAt != at(55) {
+		t.Error("ClipIntervals modified its input")
+	}
+}
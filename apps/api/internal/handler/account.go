@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"wakeup/api/internal/account"
+	"wakeup/api/internal/auth"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const securityEventAccountDeletionRequested = "account_deletion_requested"
+
+type AccountHandler struct {
+	db    *pgxpool.Pool
+	minio *storage.MinioClient
+}
+
+func NewAccountHandler(db *pgxpool.Pool, minio *storage.MinioClient) *AccountHandler {
+	return &AccountHandler{db: db, minio: minio}
+}
+
+// RequestDeletion schedules the account for deletion after a grace period.
+// The user can keep signing in and cancel until then.
+func (h *AccountHandler) RequestDeletion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash string
+	err := h.db.QueryRow(r.Context(),
+		`SELECT password_hash FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&passwordHash)
+	if err != nil {
+		writeError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	// Accounts created through a social login have no password to confirm
+	if passwordHash != "" && !auth.CheckPassword(req.Password, passwordHash) {
+		writeError(w, "invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	var resp model.AccountDeletionResponse
+	err = h.db.QueryRow(r.Context(),
+		`UPDATE profiles
+		 SET deletion_scheduled_for = COALESCE(deletion_scheduled_for, $2), updated_at = NOW()
+		 WHERE id = $1
+		 RETURNING deletion_scheduled_for`,
+		userID, time.Now().Add(account.DeletionGracePeriod),
+	).Scan(&resp.DeletionScheduledFor)
+	if err != nil {
+		writeError(w, "failed to schedule deletion", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(r.Context(), h.db, r, &userID, securityEventAccountDeletionRequested, map[string]interface{}{
+		"deletion_scheduled_for": resp.DeletionScheduledFor,
+	})
+
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// CancelDeletion withdraws a pending deletion request
+func (h *AccountHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tag, err := h.db.Exec(r.Context(),
+		`UPDATE profiles SET deletion_scheduled_for = NULL, updated_at = NOW()
+		 WHERE id = $1 AND deletion_scheduled_for IS NOT NULL`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to cancel deletion", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		writeError(w, "no deletion pending", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequestExport queues a data export; the archive is built in the background
+func (h *AccountHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if h.minio == nil {
+		writeError(w, "file storage not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Only one export in flight per user
+	var inFlight bool
+	err := h.db.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM data_exports WHERE user_id = $1 AND status IN ('pending', 'processing'))`,
+		userID,
+	).Scan(&inFlight)
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if inFlight {
+		writeError(w, "an export is already in progress", http.StatusConflict)
+		return
+	}
+
+	var export model.DataExport
+	err = h.db.QueryRow(r.Context(),
+		`INSERT INTO data_exports (user_id) VALUES ($1)
+		 RETURNING id, status, created_at`,
+		userID,
+	).Scan(&export.ID, &export.Status, &export.CreatedAt)
+	if err != nil {
+		writeError(w, "failed to create export", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, export)
+}
+
+// GetExport returns the most recent export, with a download link once it is ready
+func (h *AccountHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var export model.DataExport
+	var objectKey *string
+	err := h.db.QueryRow(r.Context(),
+		`SELECT id, status, object_key, size_bytes, error, created_at, completed_at, expires_at
+		 FROM data_exports WHERE user_id = $1
+		 ORDER BY created_at DESC
+		 LIMIT 1`,
+		userID,
+	).Scan(&export.ID, &export.Status, &objectKey, &export.SizeBytes, &export.Error,
+		&export.CreatedAt, &export.CompletedAt, &export.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "no export found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	if export.Status == "ready" && objectKey != nil && h.minio != nil {
+		downloadURL, err := h.minio.PresignGetURL(r.Context(), *objectKey, 1*time.Hour)
+		if err != nil {
+			writeError(w, "failed to generate download URL", http.StatusInternalServerError)
+			return
+		}
+		export.DownloadURL = &downloadURL
+	}
+
+	writeJSON(w, http.StatusOK, export)
+}
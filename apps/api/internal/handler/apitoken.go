@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"wakeup/api/internal/auth"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const securityEventAPITokenCreated = "api_token_created"
+
+// apiTokenPrefixLength is how much of a token is kept in clear so users can
+// tell their tokens apart
+const apiTokenPrefixLength = len(auth.APITokenPrefix) + 6
+
+// APITokenHandler manages personal access tokens for scripts and integrations
+type APITokenHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewAPITokenHandler(db *pgxpool.Pool) *APITokenHandler {
+	return &APITokenHandler{db: db}
+}
+
+func (h *APITokenHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(r.Context(),
+		`SELECT id, name, token_prefix, scopes, created_at, expires_at, last_used_at
+		 FROM personal_access_tokens
+		 WHERE user_id = $1 AND revoked_at IS NULL
+		 ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch tokens", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tokens := []model.APIToken{}
+	for rows.Next() {
+		var t model.APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.TokenPrefix, &t.Scopes, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt); err != nil {
+			writeError(w, "failed to scan token", http.StatusInternalServerError)
+			return
+		}
+		tokens = append(tokens, t)
+	}
+
+	writeJSON(w, http.StatusOK, model.APITokensResponse{Tokens: tokens})
+}
+
+func (h *APITokenHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		writeError(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			writeError(w, "unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 || *req.ExpiresInDays > 365 {
+			writeError(w, "expires_in_days must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token, err := auth.GenerateAPIToken()
+	if err != nil {
+		writeError(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	resp := model.CreateAPITokenResponse{Token: token}
+	err = h.db.QueryRow(r.Context(),
+		`INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, name, token_prefix, scopes, created_at, expires_at`,
+		userID, req.Name, auth.HashRefreshToken(token), token[:apiTokenPrefixLength], req.Scopes, expiresAt,
+	).Scan(&resp.ID, &resp.Name, &resp.TokenPrefix, &resp.Scopes, &resp.CreatedAt, &resp.ExpiresAt)
+	if err != nil {
+		writeError(w, "failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	recordSecurityEvent(r.Context(), h.db, r, &userID, securityEventAPITokenCreated, map[string]interface{}{
+		"token_id": resp.ID,
+		"scopes":   resp.Scopes,
+	})
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (h *APITokenHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid token id", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.db.Exec(r.Context(),
+		`UPDATE personal_access_tokens SET revoked_at = NOW()
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		tokenID, userID,
+	)
+	if err != nil {
+		writeError(w, "failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		writeError(w, "token not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
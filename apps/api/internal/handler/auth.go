@@ -4,27 +4,37 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"wakeup/api/internal/auth"
 	"wakeup/api/internal/config"
+	"wakeup/api/internal/mail"
 	"wakeup/api/internal/middleware"
 	"wakeup/api/internal/model"
+	"wakeup/api/internal/ratelimit"
 	"wakeup/api/internal/storage"
+	"wakeup/api/internal/ws"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type AuthHandler struct {
-	db    *pgxpool.Pool
-	cfg   *config.Config
-	minio *storage.MinioClient
+	db     *pgxpool.Pool
+	cfg    *config.Config
+	minio  *storage.MinioClient
+	hub    *ws.Hub
+	mailer mail.Mailer
+	keys   *auth.KeySet
+	limits ratelimit.Limits
 }
 
-func NewAuthHandler(db *pgxpool.Pool, cfg *config.Config, minio *storage.MinioClient) *AuthHandler {
-	return &AuthHandler{db: db, cfg: cfg, minio: minio}
+func NewAuthHandler(db *pgxpool.Pool, cfg *config.Config, minio *storage.MinioClient, hub *ws.Hub, mailer mail.Mailer, keys *auth.KeySet, limits ratelimit.Limits) *AuthHandler {
+	return &AuthHandler{db: db, cfg: cfg, minio: minio, hub: hub, mailer: mailer, keys: keys, limits: limits}
 }
 
 // resolveAvatarURL replaces an object_key stored in avatar_url with an API proxy URL
@@ -47,6 +57,11 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 
+	if err := validatePassword(req.Password); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Check if email already exists
 	var exists bool
 	err := h.db.QueryRow(r.Context(), "SELECT EXISTS(SELECT 1 FROM profiles WHERE email = $1)", req.Email).Scan(&exists)
@@ -80,12 +95,18 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate tokens
-	accessToken, refreshToken, err := h.generateTokens(r.Context(), &profile, r)
+	accessToken, refreshToken, err := h.generateTokens(r.Context(), &profile, r, nil)
 	if err != nil {
 		writeError(w, "failed to generate tokens", http.StatusInternalServerError)
 		return
 	}
 
+	// Signing in works right away, but reaching other users waits for verification
+	// (see requireVerifiedEmail). The link can be resent via /auth/verify-email/resend
+	if err := h.sendVerificationEmail(r.Context(), profile.ID, profile.Email); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", profile.Email, err)
+	}
+
 	h.resolveAvatarURL(r, &profile)
 	writeJSON(w, http.StatusCreated, model.AuthResponse{
 		AccessToken:  accessToken,
@@ -103,26 +124,46 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 
+	// Back off repeated failures per IP and per account
+	if h.loginBlocked(w, r, req.Email) {
+		return
+	}
+
 	// Find profile
 	var profile model.Profile
+	var totpEnabledAt *time.Time
 	err := h.db.QueryRow(r.Context(),
-		`SELECT id, email, password_hash, display_name, avatar_url, created_at, updated_at
+		`SELECT id, email, password_hash, display_name, avatar_url, totp_enabled_at, created_at, updated_at
 		 FROM profiles WHERE email = $1`,
 		req.Email,
-	).Scan(&profile.ID, &profile.Email, &profile.PasswordHash, &profile.DisplayName, &profile.AvatarURL, &profile.CreatedAt, &profile.UpdatedAt)
+	).Scan(&profile.ID, &profile.Email, &profile.PasswordHash, &profile.DisplayName, &profile.AvatarURL, &totpEnabledAt, &profile.CreatedAt, &profile.UpdatedAt)
 	if err != nil {
+		h.recordLoginFailure(r, nil, req.Email, "unknown_email")
 		writeError(w, "invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
 	// Check password
 	if !auth.CheckPassword(req.Password, profile.PasswordHash) {
+		h.recordLoginFailure(r, &profile.ID, req.Email, "wrong_password")
 		writeError(w, "invalid email or password", http.StatusUnauthorized)
 		return
 	}
+	h.resetLoginFailures(r, req.Email)
+
+	// Two-factor accounts get a challenge to redeem at /auth/login/mfa instead of tokens
+	if totpEnabledAt != nil {
+		challenge, err := h.createMFAChallenge(r.Context(), profile.ID)
+		if err != nil {
+			writeError(w, "failed to create mfa challenge", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, challenge)
+		return
+	}
 
 	// Generate tokens
-	accessToken, refreshToken, err := h.generateTokens(r.Context(), &profile, r)
+	accessToken, refreshToken, err := h.generateTokens(r.Context(), &profile, r, nil)
 	if err != nil {
 		writeError(w, "failed to generate tokens", http.StatusInternalServerError)
 		return
@@ -145,23 +186,37 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	tokenHash := auth.HashRefreshToken(req.RefreshToken)
 
-	// Find and validate refresh token
-	var userID string
-	var expiresAt time.Time
-	err := h.db.QueryRow(r.Context(),
-		`SELECT user_id, expires_at FROM refresh_tokens
-		 WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()`,
-		tokenHash,
-	).Scan(&userID, &expiresAt)
+	// Rotate in one transaction: the presented token is locked, so a concurrent
+	// refresh with it waits and then finds it revoked, and the token can't end up
+	// revoked without a successor or replaced_by unset
+	tx, err := h.db.Begin(r.Context())
 	if err != nil {
-		writeError(w, "invalid or expired refresh token", http.StatusUnauthorized)
+		writeError(w, "database error", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback(r.Context())
 
-	// Revoke old token
-	_, err = h.db.Exec(r.Context(),
-		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE token_hash = $1`,
+	var tokenID, userID, sessionID uuid.UUID
+	err = tx.QueryRow(r.Context(),
+		`SELECT id, user_id, session_id FROM refresh_tokens
+		 WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		 FOR UPDATE`,
 		tokenHash,
+	).Scan(&tokenID, &userID, &sessionID)
+	if err == pgx.ErrNoRows {
+		tx.Rollback(r.Context())
+		h.detectRefreshTokenReuse(r, tokenHash)
+		writeError(w, "invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to revoke old token", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(r.Context(),
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = $1`,
+		tokenID,
 	)
 	if err != nil {
 		writeError(w, "failed to revoke old token", http.StatusInternalServerError)
@@ -170,7 +225,7 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	// Get user profile
 	var profile model.Profile
-	err = h.db.QueryRow(r.Context(),
+	err = tx.QueryRow(r.Context(),
 		`SELECT id, email, display_name, avatar_url, created_at, updated_at
 		 FROM profiles WHERE id = $1`,
 		userID,
@@ -180,13 +235,29 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate new tokens
-	accessToken, refreshToken, err := h.generateTokens(r.Context(), &profile, r)
+	// Generate new tokens, keeping the rotated token in the same login session
+	accessToken, refreshToken, err := h.issueTokens(r.Context(), tx, &profile, r, &sessionID)
 	if err != nil {
 		writeError(w, "failed to generate tokens", http.StatusInternalServerError)
 		return
 	}
 
+	// Link the old token to its successor so replaying it later is recognised as reuse
+	_, err = tx.Exec(r.Context(),
+		`UPDATE refresh_tokens SET replaced_by = (SELECT id FROM refresh_tokens WHERE token_hash = $1)
+		 WHERE id = $2`,
+		auth.HashRefreshToken(refreshToken), tokenID,
+	)
+	if err != nil {
+		writeError(w, "failed to rotate token", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to rotate token", http.StatusInternalServerError)
+		return
+	}
+
 	h.resolveAvatarURL(r, &profile)
 	writeJSON(w, http.StatusOK, model.AuthResponse{
 		AccessToken:  accessToken,
@@ -195,6 +266,42 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// detectRefreshTokenReuse handles a refresh token that could not be consumed. If it
+// was already rotated, someone is replaying an old token: either the legitimate
+// client or an attacker holds a stolen copy, and we can't tell which, so the whole
+// login session is revoked.
+func (h *AuthHandler) detectRefreshTokenReuse(r *http.Request, tokenHash string) {
+	var tokenID, userID, sessionID uuid.UUID
+	err := h.db.QueryRow(r.Context(),
+		`SELECT id, user_id, session_id FROM refresh_tokens
+		 WHERE token_hash = $1 AND replaced_by IS NOT NULL`,
+		tokenHash,
+	).Scan(&tokenID, &userID, &sessionID)
+	if err != nil {
+		return
+	}
+
+	result, err := h.db.Exec(r.Context(),
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND session_id = $2 AND revoked_at IS NULL`,
+		userID, sessionID,
+	)
+	if err != nil {
+		log.Printf("Failed to revoke session %s after refresh token reuse: %v", sessionID, err)
+		return
+	}
+
+	recordSecurityEvent(r.Context(), h.db, r, &userID, securityEventRefreshTokenReuse, map[string]interface{}{
+		"session_id":     sessionID.String(),
+		"token_id":       tokenID.String(),
+		"tokens_revoked": result.RowsAffected(),
+	})
+
+	if h.hub != nil {
+		h.hub.DisconnectSessions(userID, []uuid.UUID{sessionID}, sessionRevokedEvent(sessionID))
+	}
+}
+
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	var req model.LogoutRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -205,15 +312,23 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	tokenHash := auth.HashRefreshToken(req.RefreshToken)
 
 	// Revoke token
-	_, err := h.db.Exec(r.Context(),
-		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE token_hash = $1`,
+	var userID, sessionID uuid.UUID
+	err := h.db.QueryRow(r.Context(),
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE token_hash = $1 AND revoked_at IS NULL
+		 RETURNING user_id, session_id`,
 		tokenHash,
-	)
-	if err != nil {
+	).Scan(&userID, &sessionID)
+	if err != nil && err != pgx.ErrNoRows {
 		writeError(w, "failed to revoke token", http.StatusInternalServerError)
 		return
 	}
 
+	// Drop any WebSocket connections that belong to the logged-out session
+	if err == nil && h.hub != nil {
+		h.hub.DisconnectSessions(userID, []uuid.UUID{sessionID}, sessionRevokedEvent(sessionID))
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -226,10 +341,10 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 
 	var profile model.Profile
 	err := h.db.QueryRow(r.Context(),
-		`SELECT id, email, display_name, avatar_url, created_at, updated_at
+		`SELECT id, email, display_name, avatar_url, email_verified_at, deletion_scheduled_for, timezone, leaderboard_opt_out, created_at, updated_at
 		 FROM profiles WHERE id = $1`,
 		userID,
-	).Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.AvatarURL, &profile.CreatedAt, &profile.UpdatedAt)
+	).Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.AvatarURL, &profile.EmailVerifiedAt, &profile.DeletionScheduledFor, &profile.Timezone, &profile.LeaderboardOptOut, &profile.CreatedAt, &profile.UpdatedAt)
 	if err != nil {
 		writeError(w, "user not found", http.StatusNotFound)
 		return
@@ -268,11 +383,27 @@ func (h *AuthHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
 		argIdx++
 	}
 	if req.Email != nil {
-		setClauses = append(setClauses, fmt.Sprintf("email = $%d", argIdx))
+		// A new address has to be verified again
+		setClauses = append(setClauses, fmt.Sprintf("email = $%d", argIdx), "email_verified_at = NULL")
 		args = append(args, *req.Email)
 		argIdx++
 	}
 
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" || *req.Timezone == "Local" {
+			writeError(w, "invalid timezone", http.StatusBadRequest)
+			return
+		}
+		setClauses = append(setClauses, fmt.Sprintf("timezone = $%d", argIdx))
+		args = append(args, *req.Timezone)
+		argIdx++
+	}
+	if req.LeaderboardOptOut != nil {
+		setClauses = append(setClauses, fmt.Sprintf("leaderboard_opt_out = $%d", argIdx))
+		args = append(args, *req.LeaderboardOptOut)
+		argIdx++
+	}
+
 	if len(args) == 0 {
 		writeError(w, "no fields to update", http.StatusBadRequest)
 		return
@@ -280,19 +411,25 @@ func (h *AuthHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
 
 	args = append(args, userID)
 	query := fmt.Sprintf(
-		"UPDATE profiles SET %s WHERE id = $%d RETURNING id, email, display_name, avatar_url, created_at, updated_at",
+		"UPDATE profiles SET %s WHERE id = $%d RETURNING id, email, display_name, avatar_url, email_verified_at, deletion_scheduled_for, timezone, leaderboard_opt_out, created_at, updated_at",
 		strings.Join(setClauses, ", "),
 		argIdx,
 	)
 
 	var profile model.Profile
 	err := h.db.QueryRow(r.Context(), query, args...).
-		Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.AvatarURL, &profile.CreatedAt, &profile.UpdatedAt)
+		Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.AvatarURL, &profile.EmailVerifiedAt, &profile.DeletionScheduledFor, &profile.Timezone, &profile.LeaderboardOptOut, &profile.CreatedAt, &profile.UpdatedAt)
 	if err != nil {
 		writeError(w, "failed to update profile", http.StatusInternalServerError)
 		return
 	}
 
+	if req.Email != nil {
+		if err := h.sendVerificationEmail(r.Context(), profile.ID, profile.Email); err != nil {
+			log.Printf("Failed to send verification email to %s: %v", profile.Email, err)
+		}
+	}
+
 	h.resolveAvatarURL(r, &profile)
 	writeJSON(w, http.StatusOK, profile)
 }
@@ -356,19 +493,20 @@ func (h *AuthHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, profile)
 }
 
-func (h *AuthHandler) generateTokens(ctx context.Context, profile *model.Profile, r *http.Request) (string, string, error) {
-	// Generate access token
-	accessToken, err := auth.GenerateAccessToken(
-		profile.ID,
-		profile.Email,
-		profile.DisplayName,
-		h.cfg.JWTSecret,
-		h.cfg.AccessTokenExpiry,
-	)
-	if err != nil {
-		return "", "", err
-	}
+// generateTokens issues an access/refresh token pair. A nil sessionID starts a
+// new login session; otherwise the refresh token joins the given session.
+func (h *AuthHandler) generateTokens(ctx context.Context, profile *model.Profile, r *http.Request, sessionID *uuid.UUID) (string, string, error) {
+	return h.issueTokens(ctx, h.db, profile, r, sessionID)
+}
+
+// tokenQuerier is satisfied by both the pool and a transaction
+type tokenQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
 
+// issueTokens is generateTokens storing the refresh token through q, so Refresh
+// can rotate inside its transaction
+func (h *AuthHandler) issueTokens(ctx context.Context, q tokenQuerier, profile *model.Profile, r *http.Request, sessionID *uuid.UUID) (string, string, error) {
 	// Generate refresh token
 	refreshToken, err := auth.GenerateRefreshToken()
 	if err != nil {
@@ -380,16 +518,41 @@ func (h *AuthHandler) generateTokens(ctx context.Context, profile *model.Profile
 
 	// Get request metadata
 	userAgent := r.UserAgent()
-	ip := r.RemoteAddr
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		ip = strings.Split(forwarded, ",")[0]
-	}
+	ip := clientIP(r)
 
 	// Store refresh token
-	_, err = h.db.Exec(ctx,
-		`INSERT INTO refresh_tokens (user_id, token_hash, expires_at, user_agent, ip)
-		 VALUES ($1, $2, $3, $4, $5)`,
-		profile.ID, tokenHash, expiresAt, userAgent, ip,
+	var storedSessionID uuid.UUID
+	err = q.QueryRow(ctx,
+		`INSERT INTO refresh_tokens (user_id, token_hash, expires_at, user_agent, ip, session_id)
+		 VALUES ($1, $2, $3, $4, $5, COALESCE($6::uuid, gen_random_uuid()))
+		 RETURNING session_id`,
+		profile.ID, tokenHash, expiresAt, userAgent, ip, sessionID,
+	).Scan(&storedSessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Paired extensions only get the scopes they were registered with
+	var scopes []string
+	err = h.db.QueryRow(ctx,
+		`UPDATE extension_devices SET last_seen_at = NOW()
+		 WHERE id = $1 AND revoked_at IS NULL
+		 RETURNING scopes`,
+		storedSessionID,
+	).Scan(&scopes)
+	if err != nil && err != pgx.ErrNoRows {
+		return "", "", err
+	}
+
+	// Generate access token bound to the session
+	accessToken, err := auth.GenerateAccessToken(
+		h.keys,
+		profile.ID,
+		storedSessionID,
+		profile.Email,
+		profile.DisplayName,
+		scopes,
+		h.cfg.AccessTokenExpiry,
 	)
 	if err != nil {
 		return "", "", err
@@ -409,100 +572,3 @@ func writeError(w http.ResponseWriter, message string, status int) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(model.ErrorResponse{Error: message})
 }
-
-// Extension auth - generate one-time code
-func (h *AuthHandler) ExtensionCode(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
-	if !ok {
-		writeError(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Generate random code
-	code, err := auth.GenerateRefreshToken() // Reuse the random token generator
-	if err != nil {
-		writeError(w, "failed to generate code", http.StatusInternalServerError)
-		return
-	}
-
-	// Short code for easier handling (first 32 chars)
-	code = code[:32]
-
-	// Store code with 60 second expiry
-	expiresAt := time.Now().Add(60 * time.Second)
-	_, err = h.db.Exec(r.Context(),
-		`INSERT INTO extension_codes (user_id, code, expires_at)
-		 VALUES ($1, $2, $3)`,
-		userID, code, expiresAt,
-	)
-	if err != nil {
-		writeError(w, "failed to store code", http.StatusInternalServerError)
-		return
-	}
-
-	writeJSON(w, http.StatusOK, map[string]string{"code": code})
-}
-
-// Extension auth - exchange code for tokens
-func (h *AuthHandler) ExtensionExchange(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Code string `json:"code"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, "invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	if req.Code == "" {
-		writeError(w, "code is required", http.StatusBadRequest)
-		return
-	}
-
-	// Find and validate code
-	var userID string
-	err := h.db.QueryRow(r.Context(),
-		`SELECT user_id FROM extension_codes
-		 WHERE code = $1 AND expires_at > NOW() AND used_at IS NULL`,
-		req.Code,
-	).Scan(&userID)
-	if err != nil {
-		writeError(w, "invalid or expired code", http.StatusUnauthorized)
-		return
-	}
-
-	// Mark code as used
-	_, err = h.db.Exec(r.Context(),
-		`UPDATE extension_codes SET used_at = NOW() WHERE code = $1`,
-		req.Code,
-	)
-	if err != nil {
-		writeError(w, "failed to consume code", http.StatusInternalServerError)
-		return
-	}
-
-	// Get user profile
-	var profile model.Profile
-	err = h.db.QueryRow(r.Context(),
-		`SELECT id, email, display_name, avatar_url, created_at, updated_at
-		 FROM profiles WHERE id = $1`,
-		userID,
-	).Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.AvatarURL, &profile.CreatedAt, &profile.UpdatedAt)
-	if err != nil {
-		writeError(w, "user not found", http.StatusUnauthorized)
-		return
-	}
-
-	// Generate tokens
-	accessToken, refreshToken, err := h.generateTokens(r.Context(), &profile, r)
-	if err != nil {
-		writeError(w, "failed to generate tokens", http.StatusInternalServerError)
-		return
-	}
-
-	h.resolveAvatarURL(r, &profile)
-	writeJSON(w, http.StatusOK, model.AuthResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		User:         &profile,
-	})
-}
@@ -0,0 +1,654 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// blockListVisibleSQL limits block_lists bl to the lists user $1 can see and
+// subscribe to: their own, lists published to one of their nests, and lists
+// an accepted friend shares with their friends
+const blockListVisibleSQL = `(
+	bl.owner_id = $1
+	OR EXISTS (
+	    SELECT 1 FROM block_list_nests ln
+	    JOIN nest_members nm ON nm.nest_id = ln.nest_id
+	    WHERE ln.list_id = bl.id AND nm.user_id = $1)
+	OR (bl.shared_with_friends AND EXISTS (
+	    SELECT 1 FROM friendships f
+	    WHERE f.status = 'accepted'
+	      AND ((f.requester_id = $1 AND f.addressee_id = bl.owner_id)
+	        OR (f.addressee_id = $1 AND f.requester_id = bl.owner_id))))
+)`
+
+const (
+	maxBlockListName        = 100
+	maxBlockListDescription = 500
+)
+
+// BlockListHandler manages block lists. Their rules are block_rules rows
+// owned by the list's owner and edited through the block rule endpoints;
+// subscribers read them live, so edits reach them right away.
+type BlockListHandler struct {
+	db  *pgxpool.Pool
+	hub *ws.Hub
+}
+
+func NewBlockListHandler(db *pgxpool.Pool, hub *ws.Hub) *BlockListHandler {
+	return &BlockListHandler{db: db, hub: hub}
+}
+
+// loadBlockList reads a list and its rules as seen by userID
+func loadBlockList(ctx context.Context, db *pgxpool.Pool, userID, listID uuid.UUID) (model.BlockList, error) {
+	var list model.BlockList
+	err := db.QueryRow(ctx,
+		`SELECT bl.id, bl.owner_id, p.display_name, bl.name, bl.description,
+		        CASE WHEN bl.owner_id = $1 THEN bl.enabled ELSE COALESCE(s.enabled, FALSE) END,
+		        s.user_id IS NOT NULL, bl.shared_with_friends,
+		        ARRAY(SELECT ln.nest_id FROM block_list_nests ln
+		              WHERE ln.list_id = bl.id AND (bl.owner_id = $1 OR EXISTS (
+		                  SELECT 1 FROM nest_members nm WHERE nm.nest_id = ln.nest_id AND nm.user_id = $1))
+		              ORDER BY ln.published_at),
+		        (SELECT COUNT(*) FROM block_list_subscriptions WHERE list_id = bl.id),
+		        bl.created_at, bl.updated_at
+		 FROM block_lists bl
+		 JOIN profiles p ON p.id = bl.owner_id
+		 LEFT JOIN block_list_subscriptions s ON s.list_id = bl.id AND s.user_id = $1
+		 WHERE bl.id = $2`,
+		userID, listID,
+	).Scan(&list.ID, &list.OwnerID, &list.OwnerName, &list.Name, &list.Description,
+		&list.Enabled, &list.Subscribed, &list.SharedWithFriends, &list.NestIDs,
+		&list.SubscriberCount, &list.CreatedAt, &list.UpdatedAt)
+	if err != nil {
+		return list, err
+	}
+
+	list.Rules, err = queryBlockRules(ctx, db,
+		`SELECT `+blockRuleColumns+`
+		 FROM block_rules
+		 WHERE list_id = $1
+		 ORDER BY created_at`,
+		listID,
+	)
+	return list, err
+}
+
+// listIDs runs a query selecting block list ids
+func (h *BlockListHandler) listIDs(ctx context.Context, sql string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := h.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// writeLists loads each list and responds with them
+func (h *BlockListHandler) writeLists(w http.ResponseWriter, r *http.Request, userID uuid.UUID, ids []uuid.UUID) {
+	lists := []model.BlockList{}
+	for _, id := range ids {
+		list, err := loadBlockList(r.Context(), h.db, userID, id)
+		if err != nil {
+			writeError(w, "failed to fetch block lists", http.StatusInternalServerError)
+			return
+		}
+		lists = append(lists, list)
+	}
+
+	writeJSON(w, http.StatusOK, model.BlockListsResponse{Lists: lists})
+}
+
+// ownedList parses the {id} URL param and checks the list belongs to userID
+func (h *BlockListHandler) ownedList(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (uuid.UUID, bool) {
+	listID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid list id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	var exists bool
+	err = h.db.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM block_lists WHERE id = $1 AND owner_id = $2)`,
+		listID, userID,
+	).Scan(&exists)
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return uuid.Nil, false
+	}
+	if !exists {
+		writeError(w, "block list not found", http.StatusNotFound)
+		return uuid.Nil, false
+	}
+	return listID, true
+}
+
+// visibleList parses the {id} URL param and checks userID can see the list
+func (h *BlockListHandler) visibleList(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (uuid.UUID, bool) {
+	listID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid list id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	var visible bool
+	err = h.db.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM block_lists bl WHERE bl.id = $2 AND `+blockListVisibleSQL+`)`,
+		userID, listID,
+	).Scan(&visible)
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return uuid.Nil, false
+	}
+	if !visible {
+		writeError(w, "block list not found", http.StatusNotFound)
+		return uuid.Nil, false
+	}
+	return listID, true
+}
+
+// normalizeListText trims a list's name or description and checks its length
+func normalizeListText(field, s string, max int) (string, error) {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) > max {
+		return "", errors.New(field + " is too long")
+	}
+	return s, nil
+}
+
+// List returns the user's own lists and those they are subscribed to
+func (h *BlockListHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ids, err := h.listIDs(r.Context(),
+		`SELECT bl.id FROM block_lists bl
+		 WHERE bl.owner_id = $1
+		    OR (EXISTS (SELECT 1 FROM block_list_subscriptions s WHERE s.list_id = bl.id AND s.user_id = $1)
+		        AND `+blockListVisibleSQL+`)
+		 ORDER BY bl.owner_id <> $1, bl.created_at`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch block lists", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeLists(w, r, userID, ids)
+}
+
+// Shared returns lists shared by friends or published to the user's nests
+// that they could subscribe to, most subscribed first
+func (h *BlockListHandler) Shared(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ids, err := h.listIDs(r.Context(),
+		`SELECT bl.id FROM block_lists bl
+		 WHERE bl.owner_id <> $1 AND `+blockListVisibleSQL+`
+		 ORDER BY (SELECT COUNT(*) FROM block_list_subscriptions s WHERE s.list_id = bl.id) DESC, bl.created_at DESC
+		 LIMIT 50`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch block lists", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeLists(w, r, userID, ids)
+}
+
+func (h *BlockListHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	listID, ok := h.visibleList(w, r, userID)
+	if !ok {
+		return
+	}
+
+	h.writeList(w, r, userID, listID)
+}
+
+// Create adds an empty list; rules are added with POST /block-rules and a list_id
+func (h *BlockListHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.CreateBlockListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name, err := normalizeListText("name", req.Name, maxBlockListName)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if name == "" {
+		writeError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	var description *string
+	if req.Description != nil {
+		d, err := normalizeListText("description", *req.Description, maxBlockListDescription)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if d != "" {
+			description = &d
+		}
+	}
+
+	var listID uuid.UUID
+	err = h.db.QueryRow(r.Context(),
+		`INSERT INTO block_lists (owner_id, name, description, shared_with_friends)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING id`,
+		userID, name, description, req.SharedWithFriends,
+	).Scan(&listID)
+	if err != nil {
+		writeError(w, "failed to create block list", http.StatusInternalServerError)
+		return
+	}
+
+	list, err := loadBlockList(r.Context(), h.db, userID, listID)
+	if err != nil {
+		writeError(w, "failed to create block list", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, list)
+}
+
+// Update edits a list. The owner can change everything; a subscriber can
+// only toggle their subscription with enabled.
+func (h *BlockListHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	listID, ok := h.visibleList(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var req model.UpdateBlockListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	list, err := loadBlockList(r.Context(), h.db, userID, listID)
+	if err != nil {
+		writeError(w, "failed to fetch block list", http.StatusInternalServerError)
+		return
+	}
+
+	if list.OwnerID != userID {
+		if !list.Subscribed {
+			writeError(w, "not subscribed to this list", http.StatusForbidden)
+			return
+		}
+		if req.Name != nil || req.Description != nil || req.SharedWithFriends != nil {
+			writeError(w, "only the owner can edit this list", http.StatusForbidden)
+			return
+		}
+		if req.Enabled != nil {
+			versions, err := h.changeRules(r.Context(), func(tx pgx.Tx) (map[uuid.UUID]int64, error) {
+				_, err := tx.Exec(r.Context(),
+					`UPDATE block_list_subscriptions SET enabled = $3 WHERE list_id = $1 AND user_id = $2`,
+					listID, userID, *req.Enabled,
+				)
+				if err != nil {
+					return nil, err
+				}
+				return bumpBlockRulesVersion(r.Context(), tx, nil, userID)
+			})
+			if err != nil {
+				writeError(w, "failed to update subscription", http.StatusInternalServerError)
+				return
+			}
+			list.Enabled = *req.Enabled
+			broadcastBlockRulesChanged(h.hub, versions)
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	if req.Name != nil {
+		name, err := normalizeListText("name", *req.Name, maxBlockListName)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if name == "" {
+			writeError(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		list.Name = name
+	}
+	if req.Description != nil {
+		d, err := normalizeListText("description", *req.Description, maxBlockListDescription)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list.Description = nil
+		if d != "" {
+			list.Description = &d
+		}
+	}
+	if req.Enabled != nil {
+		list.Enabled = *req.Enabled
+	}
+	if req.SharedWithFriends != nil {
+		list.SharedWithFriends = *req.SharedWithFriends
+	}
+
+	versions, err := h.changeRules(r.Context(), func(tx pgx.Tx) (map[uuid.UUID]int64, error) {
+		err := tx.QueryRow(r.Context(),
+			`UPDATE block_lists
+			 SET name = $2, description = $3, enabled = $4, shared_with_friends = $5, updated_at = NOW()
+			 WHERE id = $1
+			 RETURNING updated_at`,
+			listID, list.Name, list.Description, list.Enabled, list.SharedWithFriends,
+		).Scan(&list.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		// Only these change what subscribers follow
+		if req.Enabled == nil && req.SharedWithFriends == nil {
+			return nil, nil
+		}
+		return bumpBlockRulesVersion(r.Context(), tx, &listID, userID)
+	})
+	if err != nil {
+		writeError(w, "failed to update block list", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Delete removes a list with its rules and subscriptions
+func (h *BlockListHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	listID, ok := h.ownedList(w, r, userID)
+	if !ok {
+		return
+	}
+
+	versions, err := h.changeRules(r.Context(), func(tx pgx.Tx) (map[uuid.UUID]int64, error) {
+		// Subscriptions go with the list, so bump their versions first
+		versions, err := bumpBlockRulesVersion(r.Context(), tx, &listID, userID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(r.Context(),
+			`DELETE FROM block_lists WHERE id = $1`,
+			listID,
+		)
+		return versions, err
+	})
+	if err != nil {
+		writeError(w, "failed to delete block list", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Publish makes a list visible to the members of a nest the owner belongs to
+func (h *BlockListHandler) Publish(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	listID, ok := h.ownedList(w, r, userID)
+	if !ok {
+		return
+	}
+	nestID, err := uuid.Parse(chi.URLParam(r, "nestId"))
+	if err != nil {
+		writeError(w, "invalid nest id", http.StatusBadRequest)
+		return
+	}
+
+	var isMember bool
+	err = h.db.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM nest_members WHERE nest_id = $1 AND user_id = $2)`,
+		nestID, userID,
+	).Scan(&isMember)
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if !isMember {
+		writeError(w, "not a member of this nest", http.StatusForbidden)
+		return
+	}
+
+	// Subscribers who had lost sight of the list follow it again
+	versions, err := h.changeRules(r.Context(), func(tx pgx.Tx) (map[uuid.UUID]int64, error) {
+		_, err := tx.Exec(r.Context(),
+			`INSERT INTO block_list_nests (list_id, nest_id) VALUES ($1, $2)
+			 ON CONFLICT DO NOTHING`,
+			listID, nestID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return bumpBlockRulesVersion(r.Context(), tx, &listID)
+	})
+	if err != nil {
+		writeError(w, "failed to publish block list", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
+	h.writeList(w, r, userID, listID)
+}
+
+// Unpublish withdraws a list from a nest. Members who subscribed through it
+// stop following it unless they can still see it another way.
+func (h *BlockListHandler) Unpublish(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	listID, ok := h.ownedList(w, r, userID)
+	if !ok {
+		return
+	}
+	nestID, err := uuid.Parse(chi.URLParam(r, "nestId"))
+	if err != nil {
+		writeError(w, "invalid nest id", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := h.changeRules(r.Context(), func(tx pgx.Tx) (map[uuid.UUID]int64, error) {
+		_, err := tx.Exec(r.Context(),
+			`DELETE FROM block_list_nests WHERE list_id = $1 AND nest_id = $2`,
+			listID, nestID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return bumpBlockRulesVersion(r.Context(), tx, &listID)
+	})
+	if err != nil {
+		writeError(w, "failed to unpublish block list", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
+	h.writeList(w, r, userID, listID)
+}
+
+// Subscribe follows a list shared with the user; its rules apply to them
+// from then on, as the owner edits them
+func (h *BlockListHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	listID, ok := h.visibleList(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var ownerID uuid.UUID
+	err := h.db.QueryRow(r.Context(),
+		`SELECT owner_id FROM block_lists WHERE id = $1`,
+		listID,
+	).Scan(&ownerID)
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if ownerID == userID {
+		writeError(w, "cannot subscribe to your own list", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := h.changeRules(r.Context(), func(tx pgx.Tx) (map[uuid.UUID]int64, error) {
+		_, err := tx.Exec(r.Context(),
+			`INSERT INTO block_list_subscriptions (list_id, user_id) VALUES ($1, $2)
+			 ON CONFLICT DO NOTHING`,
+			listID, userID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return bumpBlockRulesVersion(r.Context(), tx, nil, userID)
+	})
+	if err != nil {
+		writeError(w, "failed to subscribe", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
+	h.writeList(w, r, userID, listID)
+}
+
+func (h *BlockListHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	listID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid list id", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := h.changeRules(r.Context(), func(tx pgx.Tx) (map[uuid.UUID]int64, error) {
+		result, err := tx.Exec(r.Context(),
+			`DELETE FROM block_list_subscriptions WHERE list_id = $1 AND user_id = $2`,
+			listID, userID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if result.RowsAffected() == 0 {
+			return nil, pgx.ErrNoRows
+		}
+		return bumpBlockRulesVersion(r.Context(), tx, nil, userID)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "not subscribed to this list", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to unsubscribe", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changeRules runs change in a transaction. change bumps the rule-set
+// versions of the users it affects along with its writes and returns them, to
+// be broadcast once the transaction has committed.
+func (h *BlockListHandler) changeRules(ctx context.Context, change func(pgx.Tx) (map[uuid.UUID]int64, error)) (map[uuid.UUID]int64, error) {
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	versions, err := change(tx)
+	if err != nil {
+		return nil, err
+	}
+	return versions, tx.Commit(ctx)
+}
+
+// writeList responds with a list as userID sees it
+func (h *BlockListHandler) writeList(w http.ResponseWriter, r *http.Request, userID, listID uuid.UUID) {
+	list, err := loadBlockList(r.Context(), h.db, userID, listID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "block list not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to fetch block list", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
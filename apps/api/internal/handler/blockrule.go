@@ -1,56 +1,207 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"wakeup/api/internal/blocking"
+	"wakeup/api/internal/focus"
 	"wakeup/api/internal/middleware"
 	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-type BlockRuleHandler struct {
-	db *pgxpool.Pool
+// blockRuleColumns is the block_rules select list matching scanBlockRule
+const blockRuleColumns = `id, user_id, type, pattern, action, enabled,
+	active_when, window_days, window_start_minute, window_end_minute, window_timezone, schedule_id,
+	list_id, created_at`
+
+func scanBlockRule(row pgx.Row, rule *model.BlockRule) error {
+	var days []string
+	var startMinute, endMinute *int
+	var timezone *string
+	err := row.Scan(&rule.ID, &rule.UserID, &rule.Type, &rule.Pattern, &rule.Action, &rule.Enabled,
+		&rule.ActiveWhen, &days, &startMinute, &endMinute, &timezone, &rule.ScheduleID,
+		&rule.ListID, &rule.CreatedAt)
+	if err == nil && days != nil && startMinute != nil && endMinute != nil && timezone != nil {
+		rule.Window = &model.BlockRuleWindow{
+			Days:      days,
+			StartTime: focus.FormatClock(*startMinute),
+			EndTime:   focus.FormatClock(*endMinute),
+			Timezone:  *timezone,
+		}
+	}
+	return err
 }
 
-func NewBlockRuleHandler(db *pgxpool.Pool) *BlockRuleHandler {
-	return &BlockRuleHandler{db: db}
+// ruleScope is when a rule applies, validated for storage
+type ruleScope struct {
+	activeWhen string
+	window     *focus.Recurrence
+	scheduleID *uuid.UUID
 }
 
-func (h *BlockRuleHandler) List(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
-	if !ok {
-		writeError(w, "unauthorized", http.StatusUnauthorized)
-		return
+// args returns the scope as block_rules column values, in the order
+// active_when, window_days, window_start_minute, window_end_minute,
+// window_timezone, schedule_id
+func (s ruleScope) args() []interface{} {
+	if s.window == nil {
+		return []interface{}{s.activeWhen, nil, nil, nil, nil, s.scheduleID}
 	}
+	return []interface{}{s.activeWhen, s.window.Days, s.window.StartMinute, s.window.EndMinute, s.window.Timezone, s.scheduleID}
+}
+
+// resolveScope validates when a rule should apply. Only the window or
+// schedule that active_when needs is kept; the schedule has to be the user's.
+// Rules in a block list apply to its subscribers too, so they can't follow
+// the owner's schedule.
+func (h *BlockRuleHandler) resolveScope(ctx context.Context, userID uuid.UUID, activeWhen string, window *model.BlockRuleWindow, scheduleID *uuid.UUID, inList bool) (ruleScope, error) {
+	scope := ruleScope{activeWhen: activeWhen}
+	switch activeWhen {
+	case "always", "focus":
+	case "window":
+		if window == nil {
+			return ruleScope{}, errors.New("window is required")
+		}
+		var timezone string
+		err := h.db.QueryRow(ctx,
+			`SELECT timezone FROM profiles WHERE id = $1`,
+			userID,
+		).Scan(&timezone)
+		if err != nil {
+			return ruleScope{}, errors.New("user not found")
+		}
+		rec, err := focus.WeeklyWindow(window.Days, window.StartTime, window.EndTime, window.Timezone, timezone)
+		if err != nil {
+			return ruleScope{}, err
+		}
+		scope.window = &rec
+	case "schedule":
+		if inList {
+			return ruleScope{}, errors.New("rules in a block list can't follow a schedule")
+		}
+		if scheduleID == nil {
+			return ruleScope{}, errors.New("schedule_id is required")
+		}
+		var exists bool
+		err := h.db.QueryRow(ctx,
+			`SELECT EXISTS(SELECT 1 FROM focus_schedules WHERE id = $1 AND user_id = $2)`,
+			*scheduleID, userID,
+		).Scan(&exists)
+		if err != nil || !exists {
+			return ruleScope{}, errors.New("schedule not found")
+		}
+		scope.scheduleID = scheduleID
+	default:
+		return ruleScope{}, errors.New("active_when must be always, focus, window or schedule")
+	}
+	return scope, nil
+}
+
+type BlockRuleHandler struct {
+	db  *pgxpool.Pool
+	hub *ws.Hub
+}
+
+func NewBlockRuleHandler(db *pgxpool.Pool, hub *ws.Hub) *BlockRuleHandler {
+	return &BlockRuleHandler{db: db, hub: hub}
+}
 
-	rows, err := h.db.Query(r.Context(),
-		`SELECT id, user_id, pattern, enabled, created_at
+// listRules returns the user's own rules, including those in their lists,
+// newest first
+func (h *BlockRuleHandler) listRules(ctx context.Context, userID uuid.UUID) ([]model.BlockRule, error) {
+	return queryBlockRules(ctx, h.db,
+		`SELECT `+blockRuleColumns+`
 		 FROM block_rules
 		 WHERE user_id = $1
 		 ORDER BY created_at DESC`,
 		userID,
 	)
+}
+
+// enabledRules returns the enabled rules the user follows, whatever their
+// scope: their own outside a list or in a list they left on, and those of
+// lists they are subscribed to and can still see
+func (h *BlockRuleHandler) enabledRules(ctx context.Context, userID uuid.UUID) ([]model.BlockRule, error) {
+	return queryBlockRules(ctx, h.db,
+		`SELECT `+blockRuleColumns+`
+		 FROM block_rules
+		 WHERE enabled AND (
+		     (user_id = $1 AND (list_id IS NULL OR list_id IN (
+		         SELECT id FROM block_lists WHERE owner_id = $1 AND enabled)))
+		     OR list_id IN (
+		         SELECT bl.id FROM block_lists bl
+		         JOIN block_list_subscriptions s ON s.list_id = bl.id
+		         WHERE s.user_id = $1 AND s.enabled AND bl.owner_id <> $1 AND `+blockListVisibleSQL+`))
+		 ORDER BY created_at DESC`,
+		userID,
+	)
+}
+
+// queryBlockRules runs a query selecting blockRuleColumns
+func queryBlockRules(ctx context.Context, db *pgxpool.Pool, sql string, args ...interface{}) ([]model.BlockRule, error) {
+	rows, err := db.Query(ctx, sql, args...)
 	if err != nil {
-		writeError(w, "failed to fetch block rules", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	rules := []model.BlockRule{}
 	for rows.Next() {
 		var rule model.BlockRule
-		if err := rows.Scan(&rule.ID, &rule.UserID, &rule.Pattern, &rule.Enabled, &rule.CreatedAt); err != nil {
-			writeError(w, "failed to scan block rule", http.StatusInternalServerError)
-			return
+		if err := scanBlockRule(rows, &rule); err != nil {
+			return nil, err
 		}
 		rules = append(rules, rule)
 	}
+	return rules, rows.Err()
+}
 
-	writeJSON(w, http.StatusOK, model.BlockRulesResponse{Rules: rules})
+// List returns the user's rules. The ETag is their rule-set version, so
+// clients can revalidate with If-None-Match and get a 304 when nothing changed.
+func (h *BlockRuleHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Read the version first: a change racing with this request then only
+	// makes the next revalidation fetch again
+	var version int64
+	err := h.db.QueryRow(r.Context(),
+		`SELECT block_rules_version FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&version)
+	if err != nil {
+		writeError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	etag := `"` + strconv.FormatInt(version, 10) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rules, err := h.listRules(r.Context(), userID)
+	if err != nil {
+		writeError(w, "failed to fetch block rules", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.BlockRulesResponse{Rules: rules, Version: version})
 }
 
 func (h *BlockRuleHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -71,19 +222,87 @@ func (h *BlockRuleHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Older clients send only a pattern
+	if req.Type == "" {
+		req.Type = blocking.InferType(req.Pattern)
+		if req.Type == blocking.TypeGlob {
+			req.Pattern = blocking.LegacyGlob(req.Pattern)
+		}
+	}
+	pattern, err := blocking.Normalize(req.Type, req.Pattern)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Action == "" {
+		req.Action = blocking.ActionBlock
+	}
+	if err := blocking.CheckAction(req.Action, req.Type); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.ActiveWhen == "" {
+		req.ActiveWhen = "always"
+	}
+	scope, err := h.resolveScope(r.Context(), userID, req.ActiveWhen, req.Window, req.ScheduleID, req.ListID != nil)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.ListID != nil {
+		var isOwner bool
+		err := h.db.QueryRow(r.Context(),
+			`SELECT EXISTS(SELECT 1 FROM block_lists WHERE id = $1 AND owner_id = $2)`,
+			*req.ListID, userID,
+		).Scan(&isOwner)
+		if err != nil {
+			writeError(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		if !isOwner {
+			writeError(w, "block list not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	// The rule-set version is bumped in the same transaction, so the rules
+	// can't change without clients revalidating to a new version
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
 	var rule model.BlockRule
-	err := h.db.QueryRow(r.Context(),
-		`INSERT INTO block_rules (user_id, pattern)
-		 VALUES ($1, $2)
-		 RETURNING id, user_id, pattern, enabled, created_at`,
-		userID, req.Pattern,
-	).Scan(&rule.ID, &rule.UserID, &rule.Pattern, &rule.Enabled, &rule.CreatedAt)
+	args := append([]interface{}{userID, req.Type, pattern, req.Action, req.ListID}, scope.args()...)
+	err = scanBlockRule(tx.QueryRow(r.Context(),
+		`INSERT INTO block_rules (user_id, type, pattern, action, list_id,
+		     active_when, window_days, window_start_minute, window_end_minute, window_timezone, schedule_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		 RETURNING `+blockRuleColumns,
+		args...,
+	), &rule)
 
 	if err != nil {
 		writeError(w, "failed to create block rule", http.StatusInternalServerError)
 		return
 	}
 
+	versions, err := bumpBlockRulesVersion(r.Context(), tx, rule.ListID, userID)
+	if err != nil {
+		writeError(w, "failed to create block rule", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to create block rule", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
 	writeJSON(w, http.StatusCreated, rule)
 }
 
@@ -108,39 +327,100 @@ func (h *BlockRuleHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 	// Build dynamic update query
 	var rule model.BlockRule
-	err = h.db.QueryRow(r.Context(),
-		`SELECT id, user_id, pattern, enabled, created_at
+	err = scanBlockRule(h.db.QueryRow(r.Context(),
+		`SELECT `+blockRuleColumns+`
 		 FROM block_rules
 		 WHERE id = $1 AND user_id = $2`,
 		ruleID, userID,
-	).Scan(&rule.ID, &rule.UserID, &rule.Pattern, &rule.Enabled, &rule.CreatedAt)
+	), &rule)
 
 	if err != nil {
 		writeError(w, "block rule not found", http.StatusNotFound)
 		return
 	}
 
-	// Apply updates
-	if req.Pattern != nil {
-		rule.Pattern = *req.Pattern
+	// Apply updates; a new type or pattern is validated against the other
+	if req.Type != nil || req.Pattern != nil {
+		if req.Type != nil {
+			rule.Type = *req.Type
+		}
+		if req.Pattern != nil {
+			rule.Pattern = *req.Pattern
+			// Older clients send only a pattern, as in Create
+			if req.Type == nil {
+				rule.Type = blocking.InferType(rule.Pattern)
+				if rule.Type == blocking.TypeGlob {
+					rule.Pattern = blocking.LegacyGlob(rule.Pattern)
+				}
+			}
+		}
+		rule.Pattern, err = blocking.Normalize(rule.Type, rule.Pattern)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Action != nil {
+		rule.Action = *req.Action
+	}
+	if err := blocking.CheckAction(rule.Action, rule.Type); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 	if req.Enabled != nil {
 		rule.Enabled = *req.Enabled
 	}
+	if req.ActiveWhen != nil {
+		rule.ActiveWhen = *req.ActiveWhen
+	}
+	if req.Window != nil {
+		rule.Window = req.Window
+	}
+	if req.ScheduleID != nil {
+		rule.ScheduleID = req.ScheduleID
+	}
+	scope, err := h.resolveScope(r.Context(), userID, rule.ActiveWhen, rule.Window, rule.ScheduleID, rule.ListID != nil)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Save updates
-	_, err = h.db.Exec(r.Context(),
+	// Save updates, bumping the rule-set version with them
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	args := append([]interface{}{ruleID, userID, rule.Type, rule.Pattern, rule.Action, rule.Enabled}, scope.args()...)
+	err = scanBlockRule(tx.QueryRow(r.Context(),
 		`UPDATE block_rules
-		 SET pattern = $1, enabled = $2
-		 WHERE id = $3 AND user_id = $4`,
-		rule.Pattern, rule.Enabled, ruleID, userID,
-	)
+		 SET type = $3, pattern = $4, action = $5, enabled = $6,
+		     active_when = $7, window_days = $8, window_start_minute = $9, window_end_minute = $10,
+		     window_timezone = $11, schedule_id = $12
+		 WHERE id = $1 AND user_id = $2
+		 RETURNING `+blockRuleColumns,
+		args...,
+	), &rule)
+
+	if err != nil {
+		writeError(w, "failed to update block rule", http.StatusInternalServerError)
+		return
+	}
 
+	versions, err := bumpBlockRulesVersion(r.Context(), tx, rule.ListID, userID)
 	if err != nil {
 		writeError(w, "failed to update block rule", http.StatusInternalServerError)
 		return
 	}
 
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to update block rule", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
 	writeJSON(w, http.StatusOK, rule)
 }
 
@@ -157,20 +437,100 @@ func (h *BlockRuleHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.db.Exec(r.Context(),
-		`DELETE FROM block_rules WHERE id = $1 AND user_id = $2`,
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var listID *uuid.UUID
+	err = tx.QueryRow(r.Context(),
+		`DELETE FROM block_rules WHERE id = $1 AND user_id = $2 RETURNING list_id`,
 		ruleID, userID,
-	)
+	).Scan(&listID)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "block rule not found", http.StatusNotFound)
+		return
+	}
 
 	if err != nil {
 		writeError(w, "failed to delete block rule", http.StatusInternalServerError)
 		return
 	}
 
-	if result.RowsAffected() == 0 {
-		writeError(w, "block rule not found", http.StatusNotFound)
+	versions, err := bumpBlockRulesVersion(r.Context(), tx, listID, userID)
+	if err != nil {
+		writeError(w, "failed to delete block rule", http.StatusInternalServerError)
 		return
 	}
 
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to delete block rule", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// Test reports whether a page would be blocked right now and by which rules,
+// using the same policy the clients are expected to follow
+func (h *BlockRuleHandler) Test(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.TestBlockRulesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		writeError(w, "url is required", http.StatusBadRequest)
+		return
+	}
+
+	effective, err := h.effectiveRules(r.Context(), userID, time.Now())
+	if err != nil {
+		writeError(w, "failed to fetch block rules", http.StatusInternalServerError)
+		return
+	}
+
+	byID := map[uuid.UUID]model.BlockRule{}
+	compile := func(rules []model.BlockRule) []blocking.Rule {
+		compiled := make([]blocking.Rule, 0, len(rules))
+		for _, rule := range rules {
+			byID[rule.ID] = rule
+			compiled = append(compiled, blocking.Rule{ID: rule.ID, Type: rule.Type, Pattern: rule.Pattern})
+		}
+		return compiled
+	}
+	policy, err := blocking.NewPolicy(effective.Mode, compile(effective.Rules), compile(effective.Allowlist))
+	if err != nil {
+		writeError(w, "failed to compile block rules", http.StatusInternalServerError)
+		return
+	}
+
+	decision := policy.Check(blocking.Page{URL: req.URL, Title: req.Title})
+	resp := model.TestBlockRulesResponse{
+		Mode:    effective.Mode,
+		Blocked: decision.Blocked,
+		Matches: []model.BlockRule{},
+		Allowed: []model.BlockRule{},
+	}
+	for _, match := range decision.Matches {
+		resp.Matches = append(resp.Matches, byID[match.ID])
+	}
+	for _, match := range decision.Allowed {
+		resp.Allowed = append(resp.Allowed, byID[match.ID])
+	}
+	if resp.Blocked && len(resp.Matches) > 0 {
+		resp.Rule = &resp.Matches[0]
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,434 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"wakeup/api/internal/auth"
+	"wakeup/api/internal/focus"
+	"wakeup/api/internal/ical"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// maxCalendarBytes caps an uploaded .ics file
+	maxCalendarBytes = 1 << 20
+	// maxImportEvents caps how many events one import may turn into blocks
+	maxImportEvents = 500
+	// feedHistoryDays is how far back completed sessions appear in the feed
+	feedHistoryDays = 90
+)
+
+// CalendarHandler manages scheduled focus blocks and exchanges them, along with
+// completed sessions, with calendar apps
+type CalendarHandler struct {
+	db     *pgxpool.Pool
+	apiURL string
+}
+
+func NewCalendarHandler(db *pgxpool.Pool, apiURL string) *CalendarHandler {
+	return &CalendarHandler{db: db, apiURL: strings.TrimRight(apiURL, "/")}
+}
+
+// ListBlocks returns the user's blocks that haven't ended yet, soonest first
+func (h *CalendarHandler) ListBlocks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(r.Context(),
+		`SELECT `+focus.BlockColumns+`
+		 FROM scheduled_focus_blocks
+		 WHERE user_id = $1 AND ends_at > NOW()
+		 ORDER BY starts_at`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch blocks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	blocks := []model.ScheduledBlock{}
+	for rows.Next() {
+		var b model.ScheduledBlock
+		if err := focus.ScanBlock(rows, &b); err != nil {
+			writeError(w, "failed to scan block", http.StatusInternalServerError)
+			return
+		}
+		blocks = append(blocks, b)
+	}
+
+	writeJSON(w, http.StatusOK, model.ScheduledBlocksResponse{Blocks: blocks})
+}
+
+// CreateBlock schedules a focus block; the scheduler starts it as a timed
+// session running until ends_at
+func (h *CalendarHandler) CreateBlock(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.CreateScheduledBlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	title, err := focus.ValidateBlock(req.Title, req.StartsAt, req.EndsAt)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var block model.ScheduledBlock
+	err = focus.ScanBlock(h.db.QueryRow(r.Context(),
+		`INSERT INTO scheduled_focus_blocks (user_id, title, starts_at, ends_at)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+focus.BlockColumns,
+		userID, title, req.StartsAt, req.EndsAt,
+	), &block)
+	if err != nil {
+		writeError(w, "failed to create block", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, block)
+}
+
+// DeleteBlock removes a block. A session it already started keeps running.
+func (h *CalendarHandler) DeleteBlock(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	blockID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid block id", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(r.Context(),
+		`DELETE FROM scheduled_focus_blocks WHERE id = $1 AND user_id = $2`,
+		blockID, userID,
+	)
+	if err != nil {
+		writeError(w, "failed to delete block", http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		writeError(w, "block not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Import reads an .ics file from the request body and schedules a block for
+// each upcoming event. Events keep their UID, so importing an updated export
+// of the same calendar moves blocks that haven't started yet instead of
+// duplicating them, and drops the ones whose event was canceled.
+func (h *CalendarHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Floating times (no zone in the file) are read in the user's time zone
+	var timezone string
+	err := h.db.QueryRow(r.Context(),
+		`SELECT timezone FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&timezone)
+	if err != nil {
+		writeError(w, "user not found", http.StatusNotFound)
+		return
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	events, err := ical.Parse(http.MaxBytesReader(w, r.Body, maxCalendarBytes), loc)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, "calendar file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeError(w, "invalid calendar: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(events) > maxImportEvents {
+		writeError(w, fmt.Sprintf("calendar has more than %d events", maxImportEvents), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	resp := model.ImportCalendarResponse{Warnings: []string{}}
+	skip := func(e ical.Event, reason string) {
+		resp.Skipped++
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("%s: %s", eventName(e), reason))
+	}
+	for _, e := range events {
+		var externalUID *string
+		if e.UID != "" {
+			externalUID = &e.UID
+		}
+
+		if e.Canceled {
+			if externalUID != nil {
+				_, err := tx.Exec(r.Context(),
+					`DELETE FROM scheduled_focus_blocks
+					 WHERE user_id = $1 AND external_uid = $2 AND status = 'scheduled'`,
+					userID, *externalUID,
+				)
+				if err != nil {
+					writeError(w, "failed to import calendar", http.StatusInternalServerError)
+					return
+				}
+			}
+			resp.Skipped++
+			continue
+		}
+		for _, warning := range e.Warnings {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("%s: %s", eventName(e), warning))
+		}
+		if e.AllDay {
+			skip(e, "all-day events aren't imported")
+			continue
+		}
+		if e.Recurring {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("%s: only the first occurrence of a recurring event is imported", eventName(e)))
+		}
+		if !e.End.After(time.Now()) {
+			resp.Skipped++
+			continue
+		}
+
+		title, err := focus.ValidateBlock(truncateRunes(e.Summary, 100), e.Start, e.End)
+		if err != nil {
+			skip(e, err.Error())
+			continue
+		}
+
+		// A block that has already started or been skipped is left alone
+		var inserted bool
+		err = tx.QueryRow(r.Context(),
+			`INSERT INTO scheduled_focus_blocks (user_id, title, starts_at, ends_at, source, external_uid)
+			 VALUES ($1, $2, $3, $4, 'ics', $5)
+			 ON CONFLICT (user_id, external_uid) WHERE external_uid IS NOT NULL DO UPDATE
+			 SET title = EXCLUDED.title, starts_at = EXCLUDED.starts_at, ends_at = EXCLUDED.ends_at, updated_at = NOW()
+			 WHERE scheduled_focus_blocks.status = 'scheduled'
+			 RETURNING xmax = 0`,
+			userID, title, e.Start, e.End, externalUID,
+		).Scan(&inserted)
+		if errors.Is(err, pgx.ErrNoRows) {
+			resp.Skipped++
+			continue
+		}
+		if err != nil {
+			writeError(w, "failed to import calendar", http.StatusInternalServerError)
+			return
+		}
+		if inserted {
+			resp.Imported++
+		} else {
+			resp.Updated++
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to import calendar", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// eventName identifies an event in import warnings
+func eventName(e ical.Event) string {
+	if e.Summary != "" {
+		return fmt.Sprintf("%q", e.Summary)
+	}
+	return "event at " + e.Start.Format(time.RFC3339)
+}
+
+// RotateFeed issues a new secret feed URL, replacing any earlier one
+func (h *CalendarHandler) RotateFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := auth.GenerateRefreshToken()
+	if err != nil {
+		writeError(w, "failed to generate feed token", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.Exec(r.Context(),
+		`UPDATE profiles SET calendar_feed_token_hash = $2, updated_at = NOW() WHERE id = $1`,
+		userID, auth.HashRefreshToken(token),
+	)
+	if err != nil {
+		writeError(w, "failed to save feed token", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.CalendarFeedResponse{URL: h.apiURL + "/calendar/" + token + ".ics"})
+}
+
+// DisableFeed turns the feed off; the current URL stops working
+func (h *CalendarHandler) DisableFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	_, err := h.db.Exec(r.Context(),
+		`UPDATE profiles SET calendar_feed_token_hash = NULL, updated_at = NOW() WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to disable feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Feed serves the iCalendar feed for the token in the URL: completed sessions
+// from the last 90 days and the blocks still scheduled. Calendar apps can't
+// send an Authorization header, so the token is the only credential.
+func (h *CalendarHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	var userID uuid.UUID
+	var displayName string
+	err := h.db.QueryRow(r.Context(),
+		`SELECT id, display_name FROM profiles
+		 WHERE calendar_feed_token_hash = $1 AND deletion_scheduled_for IS NULL`,
+		auth.HashRefreshToken(token),
+	).Scan(&userID, &displayName)
+	if err != nil {
+		writeError(w, "feed not found", http.StatusNotFound)
+		return
+	}
+
+	cal := ical.Calendar{Name: displayName + " – Focus"}
+
+	rows, err := h.db.Query(r.Context(),
+		`SELECT `+focus.SessionColumns+`
+		 FROM focus_sessions
+		 WHERE user_id = $1 AND status = 'completed' AND started_at > NOW() - make_interval(days => $2)
+		 ORDER BY started_at`,
+		userID, feedHistoryDays,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var s model.FocusSession
+		if err := focus.ScanSession(rows, &s); err != nil {
+			rows.Close()
+			writeError(w, "failed to scan session", http.StatusInternalServerError)
+			return
+		}
+		if s.EndedAt == nil {
+			continue
+		}
+		event := ical.Event{
+			UID:         "session-" + s.ID.String() + "@wakeup",
+			Summary:     "Focus session",
+			Description: fmt.Sprintf("Focused for %d min", s.FocusedSeconds/60),
+			Start:       s.StartedAt,
+			End:         *s.EndedAt,
+		}
+		if s.Label != nil {
+			event.Summary = *s.Label
+		}
+		if s.Notes != nil {
+			event.Description += "\n\n" + *s.Notes
+		}
+		cal.Events = append(cal.Events, event)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		writeError(w, "failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err = h.db.Query(r.Context(),
+		`SELECT `+focus.BlockColumns+`
+		 FROM scheduled_focus_blocks
+		 WHERE user_id = $1 AND status = 'scheduled' AND ends_at > NOW()
+		 ORDER BY starts_at`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch blocks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b model.ScheduledBlock
+		if err := focus.ScanBlock(rows, &b); err != nil {
+			writeError(w, "failed to scan block", http.StatusInternalServerError)
+			return
+		}
+		event := ical.Event{
+			UID:     "block-" + b.ID.String() + "@wakeup",
+			Summary: "Focus block",
+			Start:   b.StartsAt,
+			End:     b.EndsAt,
+		}
+		if b.Title != nil {
+			event.Summary = *b.Title
+		}
+		cal.Events = append(cal.Events, event)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, "failed to fetch blocks", http.StatusInternalServerError)
+		return
+	}
+
+	// Rendered up front so a failure is still an error response
+	var buf bytes.Buffer
+	if err := ical.Write(&buf, cal); err != nil {
+		writeError(w, "failed to render calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(buf.Bytes())
+}
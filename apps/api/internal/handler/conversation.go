@@ -26,6 +26,9 @@ func (h *ConversationHandler) CreateDM(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !requireVerifiedEmail(w, r, h.db, userID) {
+		return
+	}
 
 	var req model.CreateDMRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -112,6 +115,9 @@ func (h *ConversationHandler) CreateGroup(w http.ResponseWriter, r *http.Request
 		writeError(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !requireVerifiedEmail(w, r, h.db, userID) {
+		return
+	}
 
 	var req model.CreateGroupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"wakeup/api/internal/blocking"
+	"wakeup/api/internal/focus"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// effectiveHorizon is how far ahead schedule occurrences are looked up when
+// working out the next change; it covers a full week of a schedule
+const effectiveHorizon = 8 * 24 * time.Hour
+
+// Effective returns the rules that apply right now: enabled rules, including
+// those of enabled and subscribed block lists, that are always on, plus those
+// scoped to a focus session, time window or schedule that is currently running.
+// Block and allow rules are returned apart, with the blocking mode: allowlist
+// while a session started in that mode is in a focus phase. The result also
+// depends on the time and on focus sessions, so the ETag is a digest of it
+// rather than the rule-set version; clients revalidate with If-None-Match.
+func (h *BlockRuleHandler) Effective(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	resp, err := h.effectiveRules(r.Context(), userID, time.Now())
+	if err != nil {
+		writeError(w, "failed to fetch block rules", http.StatusInternalServerError)
+		return
+	}
+
+	etag, err := effectiveETag(resp)
+	if err != nil {
+		writeError(w, "failed to fetch block rules", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// effectiveETag digests everything in resp but the evaluation time
+func effectiveETag(resp model.EffectiveBlockRulesResponse) (string, error) {
+	resp.EvaluatedAt = time.Time{}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// effectiveRules evaluates the user's enabled rules at now
+func (h *BlockRuleHandler) effectiveRules(ctx context.Context, userID uuid.UUID, now time.Time) (model.EffectiveBlockRulesResponse, error) {
+	resp := model.EffectiveBlockRulesResponse{
+		Mode:        blocking.ModeBlocklist,
+		Rules:       []model.BlockRule{},
+		Allowlist:   []model.BlockRule{},
+		EvaluatedAt: now,
+	}
+	nextChange := func(t time.Time) {
+		if t.After(now) && (resp.NextChangeAt == nil || t.Before(*resp.NextChangeAt)) {
+			resp.NextChangeAt = &t
+		}
+	}
+
+	rules, err := h.enabledRules(ctx, userID)
+	if err != nil {
+		return resp, err
+	}
+
+	// A running focus phase ends on its own; pauses and stops are sent as events
+	var phaseEndsAt *time.Time
+	var allowlist bool
+	err = h.db.QueryRow(ctx,
+		`SELECT COUNT(*) > 0, MIN(phase_ends_at), COALESCE(BOOL_OR(block_mode = 'allowlist'), FALSE)
+		 FROM focus_sessions
+		 WHERE user_id = $1 AND status = 'active' AND phase = 'focus'`,
+		userID,
+	).Scan(&resp.FocusActive, &phaseEndsAt, &allowlist)
+	if err != nil {
+		return resp, err
+	}
+	if allowlist {
+		resp.Mode = blocking.ModeAllowlist
+	}
+	if phaseEndsAt != nil {
+		nextChange(*phaseEndsAt)
+	}
+
+	// Occurrences of the user's schedules that are running or start soon
+	rows, err := h.db.Query(ctx,
+		`SELECT schedule_id, starts_at, ends_at
+		 FROM scheduled_focus_blocks
+		 WHERE user_id = $1 AND schedule_id IS NOT NULL AND status <> 'skipped'
+		   AND ends_at > $2 AND starts_at < $3`,
+		userID, now, now.Add(effectiveHorizon),
+	)
+	if err != nil {
+		return resp, err
+	}
+	runningSchedules := map[uuid.UUID]bool{}
+	boundaries := map[uuid.UUID][]time.Time{}
+	for rows.Next() {
+		var scheduleID uuid.UUID
+		var startsAt, endsAt time.Time
+		if err := rows.Scan(&scheduleID, &startsAt, &endsAt); err != nil {
+			rows.Close()
+			return resp, err
+		}
+		if !startsAt.After(now) {
+			runningSchedules[scheduleID] = true
+		}
+		boundaries[scheduleID] = append(boundaries[scheduleID], startsAt, endsAt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return resp, err
+	}
+
+	for _, rule := range rules {
+		active := false
+		switch rule.ActiveWhen {
+		case "always":
+			active = true
+		case "focus":
+			active = resp.FocusActive
+		case "window":
+			if rule.Window == nil {
+				continue
+			}
+			rec, err := focus.WeeklyWindow(rule.Window.Days, rule.Window.StartTime, rule.Window.EndTime, rule.Window.Timezone, "")
+			if err != nil {
+				continue
+			}
+			var next time.Time
+			if active, next, err = rec.ActiveAt(now); err != nil {
+				continue
+			}
+			nextChange(next)
+		case "schedule":
+			if rule.ScheduleID == nil {
+				continue
+			}
+			active = runningSchedules[*rule.ScheduleID]
+			for _, t := range boundaries[*rule.ScheduleID] {
+				nextChange(t)
+			}
+		}
+		switch {
+		case !active:
+		case rule.Action == blocking.ActionAllow:
+			resp.Allowlist = append(resp.Allowlist, rule)
+		default:
+			resp.Rules = append(resp.Rules, rule)
+		}
+	}
+
+	return resp, nil
+}
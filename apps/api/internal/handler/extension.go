@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"wakeup/api/internal/auth"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	extensionCodeExpiry       = 60 * time.Second
+	maxExtensionDeviceNameLen = 100
+)
+
+// extensionScopes is what a paired extension can do: read the profile, drive
+// focus sessions and fetch block rules. Account management stays with the web app.
+var extensionScopes = []string{
+	auth.ScopeProfileRead,
+	auth.ScopeFocusRead,
+	auth.ScopeFocusWrite,
+	auth.ScopeBlockRulesRead,
+}
+
+// ExtensionCode issues a one-time pairing code for a signed-in user. The code is
+// bound to the PKCE challenge the extension generated, so only the extension
+// holding the matching verifier can redeem it.
+func (h *AuthHandler) ExtensionCode(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.ExtensionCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.CodeChallenge == "" {
+		writeError(w, "code_challenge is required", http.StatusBadRequest)
+		return
+	}
+	if req.CodeChallengeMethod != "S256" {
+		writeError(w, "code_challenge_method must be S256", http.StatusBadRequest)
+		return
+	}
+
+	code, err := auth.GenerateRefreshToken() // Reuse the random token generator
+	if err != nil {
+		writeError(w, "failed to generate code", http.StatusInternalServerError)
+		return
+	}
+
+	// Short code for easier handling (first 32 chars)
+	code = code[:32]
+
+	_, err = h.db.Exec(r.Context(),
+		`INSERT INTO extension_codes (user_id, code_hash, code_challenge, expires_at)
+		 VALUES ($1, $2, $3, $4)`,
+		userID, auth.HashRefreshToken(code), req.CodeChallenge, time.Now().Add(extensionCodeExpiry),
+	)
+	if err != nil {
+		writeError(w, "failed to store code", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.ExtensionCodeResponse{
+		Code:      code,
+		ExpiresIn: int(extensionCodeExpiry.Seconds()),
+	})
+}
+
+// ExtensionExchange redeems a pairing code. The code is consumed before the
+// verifier is checked, so a wrong guess burns it. A successful exchange
+// registers an extension device whose login session only carries extensionScopes.
+func (h *AuthHandler) ExtensionExchange(w http.ResponseWriter, r *http.Request) {
+	var req model.ExtensionExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Code == "" || req.CodeVerifier == "" {
+		writeError(w, "code and code_verifier are required", http.StatusBadRequest)
+		return
+	}
+
+	throttleKey := throttleExtensionCode + clientIP(r)
+	if wait := h.throttleWait(r, h.limits.ByIP, throttleKey); wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	// Consume the code atomically so it can only ever be redeemed once
+	var userID uuid.UUID
+	var challenge string
+	err := h.db.QueryRow(r.Context(),
+		`UPDATE extension_codes SET used_at = NOW()
+		 WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id, code_challenge`,
+		auth.HashRefreshToken(req.Code),
+	).Scan(&userID, &challenge)
+	if err == nil && !auth.VerifyPKCE(req.CodeVerifier, challenge) {
+		err = errors.New("code verifier mismatch")
+	}
+	if err != nil {
+		wait := h.throttleFail(r, h.limits.ByIP, throttleKey)
+		recordSecurityEvent(r.Context(), h.db, r, nil, securityEventExtensionFailed, map[string]interface{}{
+			"retry_after_seconds": retryAfterSeconds(wait),
+		})
+		writeError(w, "invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+
+	var profile model.Profile
+	err = h.db.QueryRow(r.Context(),
+		`SELECT id, email, display_name, avatar_url, created_at, updated_at
+		 FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.AvatarURL, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		writeError(w, "user not found", http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimSpace(req.DeviceName)
+	if name == "" {
+		name = describeDevice(r.UserAgent())
+	}
+	name = truncateRunes(name, maxExtensionDeviceNameLen)
+
+	// The device id doubles as the login session id of its refresh tokens
+	deviceID := uuid.New()
+	_, err = h.db.Exec(r.Context(),
+		`INSERT INTO extension_devices (id, user_id, name, user_agent, scopes)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		deviceID, userID, name, r.UserAgent(), extensionScopes,
+	)
+	if err != nil {
+		writeError(w, "failed to register device", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, refreshToken, err := h.generateTokens(r.Context(), &profile, r, &deviceID)
+	if err != nil {
+		writeError(w, "failed to generate tokens", http.StatusInternalServerError)
+		return
+	}
+
+	h.resolveAvatarURL(r, &profile)
+	writeJSON(w, http.StatusOK, model.ExtensionExchangeResponse{
+		AuthResponse: model.AuthResponse{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			User:         &profile,
+		},
+		DeviceID: deviceID,
+	})
+}
+
+// ListExtensions returns the extensions that are still paired, i.e. not revoked
+// and holding a live refresh token
+func (h *AuthHandler) ListExtensions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(r.Context(),
+		`SELECT d.id, d.name, d.user_agent, d.scopes, d.created_at, d.last_seen_at
+		 FROM extension_devices d
+		 WHERE d.user_id = $1 AND d.revoked_at IS NULL
+		   AND EXISTS (
+		       SELECT 1 FROM refresh_tokens t
+		       WHERE t.session_id = d.id AND t.revoked_at IS NULL AND t.expires_at > NOW()
+		   )
+		 ORDER BY d.last_seen_at DESC`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch extensions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	devices := []model.ExtensionDevice{}
+	for rows.Next() {
+		var d model.ExtensionDevice
+		if err := rows.Scan(&d.ID, &d.Name, &d.UserAgent, &d.Scopes, &d.CreatedAt, &d.LastSeenAt); err != nil {
+			writeError(w, "failed to scan extension", http.StatusInternalServerError)
+			return
+		}
+		devices = append(devices, d)
+	}
+
+	writeJSON(w, http.StatusOK, model.ExtensionDevicesResponse{Devices: devices})
+}
+
+// RevokeExtension unpairs an extension: its tokens stop refreshing and any open
+// WebSocket connection is closed
+func (h *AuthHandler) RevokeExtension(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid extension id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	err = tx.QueryRow(r.Context(),
+		`UPDATE extension_devices SET revoked_at = NOW()
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		 RETURNING id`,
+		deviceID, userID,
+	).Scan(&deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "extension not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to revoke extension", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(r.Context(),
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND session_id = $2 AND revoked_at IS NULL`,
+		userID, deviceID,
+	)
+	if err != nil {
+		writeError(w, "failed to revoke extension", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to revoke extension", http.StatusInternalServerError)
+		return
+	}
+
+	if h.hub != nil {
+		h.hub.DisconnectSessions(userID, []uuid.UUID{deviceID}, sessionRevokedEvent(deviceID))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
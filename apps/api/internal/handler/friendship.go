@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"wakeup/api/internal/middleware"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -28,6 +30,9 @@ func (h *FriendshipHandler) SendRequest(w http.ResponseWriter, r *http.Request)
 		writeError(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !requireVerifiedEmail(w, r, h.db, userID) {
+		return
+	}
 
 	var req model.SendFriendRequestRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -180,20 +185,25 @@ func (h *FriendshipHandler) RemoveFriend(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Either party can remove
-	result, err := h.db.Exec(r.Context(),
+	var requesterID, addresseeID uuid.UUID
+	err = h.db.QueryRow(r.Context(),
 		`DELETE FROM friendships
-		 WHERE id = $1 AND (requester_id = $2 OR addressee_id = $2) AND status = 'accepted'`,
+		 WHERE id = $1 AND (requester_id = $2 OR addressee_id = $2) AND status = 'accepted'
+		 RETURNING requester_id, addressee_id`,
 		friendshipID, userID,
-	)
+	).Scan(&requesterID, &addresseeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "friendship not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		writeError(w, "database error", http.StatusInternalServerError)
 		return
 	}
 
-	if result.RowsAffected() == 0 {
-		writeError(w, "friendship not found", http.StatusNotFound)
-		return
-	}
+	// Block lists shared with friends are no longer visible to the other side
+	hiddenSubscriptionsChanged(r.Context(), h.db, h.hub, requesterID, `bl.owner_id = $2`, addresseeID)
+	hiddenSubscriptionsChanged(r.Context(), h.db, h.hub, addresseeID, `bl.owner_id = $2`, requesterID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
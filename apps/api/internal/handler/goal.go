@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wakeup/api/internal/focus"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type GoalHandler struct {
+	db    *pgxpool.Pool
+	goals *focus.GoalTracker
+}
+
+func NewGoalHandler(db *pgxpool.Pool, goals *focus.GoalTracker) *GoalHandler {
+	return &GoalHandler{db: db, goals: goals}
+}
+
+// List returns the user's goals with their progress in the current day or week
+func (h *GoalHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	goals, err := h.goals.Progress(r.Context(), userID)
+	if err != nil {
+		writeError(w, "failed to fetch goals", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.FocusGoalsResponse{Goals: goals})
+}
+
+// Upsert sets the target of the user's goal for a period and metric, creating
+// the goal if needed
+func (h *GoalHandler) Upsert(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.UpsertGoalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Period != "daily" && req.Period != "weekly" {
+		writeError(w, "period must be daily or weekly", http.StatusBadRequest)
+		return
+	}
+	if req.Metric != "minutes" && req.Metric != "sessions" {
+		writeError(w, "metric must be minutes or sessions", http.StatusBadRequest)
+		return
+	}
+	if req.Target < 1 {
+		writeError(w, "target must be at least 1", http.StatusBadRequest)
+		return
+	}
+
+	var goalID uuid.UUID
+	err := h.db.QueryRow(r.Context(),
+		`INSERT INTO focus_goals (user_id, period, metric, target)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (user_id, period, metric) DO UPDATE
+		 SET target = EXCLUDED.target, updated_at = NOW()
+		 RETURNING id`,
+		userID, req.Period, req.Metric, req.Target,
+	).Scan(&goalID)
+	if err != nil {
+		writeError(w, "failed to save goal", http.StatusInternalServerError)
+		return
+	}
+
+	// A lower target may already be met
+	h.goals.Evaluate(r.Context(), userID)
+
+	goals, err := h.goals.Progress(r.Context(), userID)
+	if err != nil {
+		writeError(w, "failed to fetch goals", http.StatusInternalServerError)
+		return
+	}
+	for _, goal := range goals {
+		if goal.ID == goalID {
+			writeJSON(w, http.StatusOK, goal)
+			return
+		}
+	}
+	writeError(w, "goal not found", http.StatusNotFound)
+}
+
+// Delete removes a goal along with its history
+func (h *GoalHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	goalID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid goal id", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(r.Context(),
+		`DELETE FROM focus_goals WHERE id = $1 AND user_id = $2`,
+		goalID, userID,
+	)
+	if err != nil {
+		writeError(w, "failed to delete goal", http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		writeError(w, "goal not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// History lists met and missed periods, newest first, optionally for a
+// single goal (?goal_id=). The running period is included with final=false.
+func (h *GoalHandler) History(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := 60
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 366 {
+			limit = parsed
+		}
+	}
+
+	var goalID *uuid.UUID
+	if g := r.URL.Query().Get("goal_id"); g != "" {
+		id, err := uuid.Parse(g)
+		if err != nil {
+			writeError(w, "invalid goal id", http.StatusBadRequest)
+			return
+		}
+		goalID = &id
+	}
+
+	rows, err := h.db.Query(r.Context(),
+		`SELECT r.goal_id, g.period, g.metric, r.period_start, r.target, r.achieved, r.met,
+		        r.reached_at, r.finalized
+		 FROM goal_results r
+		 JOIN focus_goals g ON g.id = r.goal_id
+		 WHERE g.user_id = $1 AND ($2::uuid IS NULL OR r.goal_id = $2)
+		 ORDER BY r.period_start DESC, g.period, g.metric
+		 LIMIT $3`,
+		userID, goalID, limit,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch goal history", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	results := []model.GoalResult{}
+	for rows.Next() {
+		var result model.GoalResult
+		var periodStart time.Time
+		if err := rows.Scan(&result.GoalID, &result.Period, &result.Metric, &periodStart, &result.Target,
+			&result.Achieved, &result.Met, &result.ReachedAt, &result.Final); err != nil {
+			writeError(w, "failed to scan goal result", http.StatusInternalServerError)
+			return
+		}
+		result.PeriodStart = periodStart.Format("2006-01-02")
+		results = append(results, result)
+	}
+
+	writeJSON(w, http.StatusOK, model.GoalHistoryResponse{Results: results})
+}
@@ -2,9 +2,11 @@ package handler
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"unicode/utf8"
 
 	"wakeup/api/internal/model"
 )
@@ -25,3 +27,34 @@ func ResolveAvatarURL(r *http.Request, profile *model.Profile) {
 		profile.AvatarURL = &avatarURL
 	}
 }
+
+// truncateRunes shortens s to at most n characters
+func truncateRunes(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:n]))
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak
+// validators compare equal to strong ones, as they do for GET.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the client's address without the port. Behind a proxy,
+// middleware.RealIP has already replaced RemoteAddr with the forwarded address
+// when the proxy is trusted.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
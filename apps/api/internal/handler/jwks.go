@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+
+	"wakeup/api/internal/auth"
+)
+
+type JWKSHandler struct {
+	keys *auth.KeySet
+}
+
+func NewJWKSHandler(keys *auth.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// Get publishes the public keys access tokens can be verified with. It is public and
+// cacheable; clients should refetch when they see a kid they don't know.
+func (h *JWKSHandler) Get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, h.keys.JWKS())
+}
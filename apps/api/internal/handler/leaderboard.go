@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// leaderboardSize caps how many people a leaderboard lists
+const leaderboardSize = 100
+
+// friendsSQL selects the user ($1) and their accepted friends
+const friendsSQL = `
+	SELECT $1::uuid AS user_id
+	UNION
+	SELECT CASE WHEN requester_id = $1 THEN addressee_id ELSE requester_id END
+	FROM friendships
+	WHERE status = 'accepted' AND (requester_id = $1 OR addressee_id = $1)`
+
+// nestMembersSQL selects the members of a nest ($4)
+const nestMembersSQL = `
+	SELECT user_id FROM nest_members WHERE nest_id = $4`
+
+// LeaderboardHandler ranks friends and nest members by focus time, read from
+// the daily totals kept by focus.LeaderboardRollup
+type LeaderboardHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewLeaderboardHandler(db *pgxpool.Pool) *LeaderboardHandler {
+	return &LeaderboardHandler{db: db}
+}
+
+// Get ranks the user and their friends, or the members of a nest with
+// ?scope=nest&nest_id=, by focus time today, this week or this month
+// (?period=, default week). Periods start in the user's time zone. People who
+// opted out are left out, except that users always see themselves.
+func (h *LeaderboardHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	resp := model.LeaderboardResponse{
+		Period: r.URL.Query().Get("period"),
+		Scope:  r.URL.Query().Get("scope"),
+	}
+	if resp.Period == "" {
+		resp.Period = "week"
+	}
+	if resp.Period != "day" && resp.Period != "week" && resp.Period != "month" {
+		writeError(w, "period must be day, week or month", http.StatusBadRequest)
+		return
+	}
+	if resp.Scope == "" {
+		resp.Scope = "friends"
+	}
+
+	participants := friendsSQL
+	var nestArgs []interface{}
+	switch resp.Scope {
+	case "friends":
+	case "nest":
+		id, err := uuid.Parse(r.URL.Query().Get("nest_id"))
+		if err != nil {
+			writeError(w, "invalid nest_id", http.StatusBadRequest)
+			return
+		}
+		var isMember bool
+		err = h.db.QueryRow(r.Context(),
+			`SELECT EXISTS(SELECT 1 FROM nest_members WHERE nest_id = $1 AND user_id = $2)`,
+			id, userID,
+		).Scan(&isMember)
+		if err != nil {
+			writeError(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		if !isMember {
+			writeError(w, "not a member of this nest", http.StatusForbidden)
+			return
+		}
+		participants = nestMembersSQL
+		nestArgs = append(nestArgs, id)
+	default:
+		writeError(w, "scope must be friends or nest", http.StatusBadRequest)
+		return
+	}
+
+	err := h.db.QueryRow(r.Context(),
+		`SELECT timezone FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&resp.Timezone)
+	if err != nil {
+		writeError(w, "user not found", http.StatusNotFound)
+		return
+	}
+	loc, err := time.LoadLocation(resp.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	start := periodStart(time.Now().In(loc), resp.Period)
+	resp.PeriodStart = start.Format("2006-01-02")
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	rows, err := h.db.Query(r.Context(),
+		`SELECT p.id, p.display_name, p.avatar_url,
+		        COALESCE(SUM(t.focused_seconds), 0)::bigint AS focused,
+		        MAX(t.refreshed_at)
+		 FROM (`+participants+`) m
+		 JOIN profiles p ON p.id = m.user_id
+		 LEFT JOIN focus_daily_totals t ON t.user_id = p.id AND t.day >= $2
+		 WHERE (p.id = $1 OR NOT p.leaderboard_opt_out) AND p.deletion_scheduled_for IS NULL
+		 GROUP BY p.id
+		 ORDER BY focused DESC, p.display_name
+		 LIMIT $3`,
+		append([]interface{}{userID, startDay, leaderboardSize}, nestArgs...)...,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch leaderboard", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	resp.Entries = []model.LeaderboardEntry{}
+	for rows.Next() {
+		var profile model.Profile
+		var entry model.LeaderboardEntry
+		var refreshedAt *time.Time
+		if err := rows.Scan(&profile.ID, &profile.DisplayName, &profile.AvatarURL, &entry.FocusedSeconds, &refreshedAt); err != nil {
+			writeError(w, "failed to scan leaderboard entry", http.StatusInternalServerError)
+			return
+		}
+		ResolveAvatarURL(r, &profile)
+
+		entry.Rank = len(resp.Entries) + 1
+		if n := len(resp.Entries); n > 0 && resp.Entries[n-1].FocusedSeconds == entry.FocusedSeconds {
+			entry.Rank = resp.Entries[n-1].Rank
+		}
+		entry.UserID, entry.DisplayName, entry.AvatarURL = profile.ID, profile.DisplayName, profile.AvatarURL
+		entry.IsMe = profile.ID == userID
+		resp.Entries = append(resp.Entries, entry)
+
+		if refreshedAt != nil && (resp.RefreshedAt == nil || refreshedAt.After(*resp.RefreshedAt)) {
+			resp.RefreshedAt = refreshedAt
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// periodStart returns the first day of the day, week (starting Monday) or
+// month containing now
+func periodStart(now time.Time, period string) time.Time {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	switch period {
+	case "week":
+		return today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	case "month":
+		return today.AddDate(0, 0, 1-d)
+	}
+	return today
+}
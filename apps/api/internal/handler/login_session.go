@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoginSessionHandler lets a user see and revoke the devices they are signed in on.
+// A login session is the chain of refresh tokens rotated from a single login.
+type LoginSessionHandler struct {
+	db  *pgxpool.Pool
+	hub *ws.Hub
+}
+
+func NewLoginSessionHandler(db *pgxpool.Pool, hub *ws.Hub) *LoginSessionHandler {
+	return &LoginSessionHandler{db: db, hub: hub}
+}
+
+func (h *LoginSessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := middleware.GetSessionID(r.Context())
+
+	// Each live session has exactly one unrevoked token; its creation time is the
+	// last time the session was used to refresh.
+	rows, err := h.db.Query(r.Context(),
+		`SELECT t.session_id, t.user_agent, t.ip, t.created_at, t.expires_at,
+		        (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.session_id = t.session_id)
+		 FROM refresh_tokens t
+		 WHERE t.user_id = $1 AND t.revoked_at IS NULL AND t.expires_at > NOW()
+		 ORDER BY t.created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []model.LoginSession{}
+	for rows.Next() {
+		var s model.LoginSession
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.LastUsedAt, &s.ExpiresAt, &s.CreatedAt); err != nil {
+			writeError(w, "failed to scan session", http.StatusInternalServerError)
+			return
+		}
+		userAgent := ""
+		if s.UserAgent != nil {
+			userAgent = *s.UserAgent
+		}
+		s.Device = describeDevice(userAgent)
+		s.Current = s.ID == currentID
+		sessions = append(sessions, s)
+	}
+
+	writeJSON(w, http.StatusOK, model.LoginSessionsResponse{Sessions: sessions})
+}
+
+func (h *LoginSessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(r.Context(),
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND session_id = $2 AND revoked_at IS NULL`,
+		userID, sessionID,
+	)
+	if err != nil {
+		writeError(w, "failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		writeError(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	if h.hub != nil {
+		h.hub.DisconnectSessions(userID, []uuid.UUID{sessionID}, sessionRevokedEvent(sessionID))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOthers signs the user out everywhere except the session making the request
+func (h *LoginSessionHandler) RevokeOthers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	currentID, ok := middleware.GetSessionID(r.Context())
+	if !ok {
+		writeError(w, "current session unknown, sign in again", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.db.Query(r.Context(),
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND session_id <> $2 AND revoked_at IS NULL
+		 RETURNING session_id`,
+		userID, currentID,
+	)
+	if err != nil {
+		writeError(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	seen := map[uuid.UUID]bool{}
+	revoked := []uuid.UUID{}
+	for rows.Next() {
+		var sessionID uuid.UUID
+		if err := rows.Scan(&sessionID); err != nil {
+			writeError(w, "failed to scan session", http.StatusInternalServerError)
+			return
+		}
+		if !seen[sessionID] {
+			seen[sessionID] = true
+			revoked = append(revoked, sessionID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	if h.hub != nil {
+		for _, sessionID := range revoked {
+			h.hub.DisconnectSessions(userID, []uuid.UUID{sessionID}, sessionRevokedEvent(sessionID))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"revoked": len(revoked)})
+}
+
+// sessionRevokedEvent tells a client its login session is gone and it must sign in again
+func sessionRevokedEvent(sessionID uuid.UUID) ws.Event {
+	return ws.Event{
+		Type: "session.revoked",
+		Data: map[string]interface{}{"session_id": sessionID.String()},
+	}
+}
+
+// describeDevice turns a User-Agent into a short label like "Chrome on macOS"
+func describeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	client := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "expo") || strings.Contains(ua, "okhttp") || strings.Contains(ua, "cfnetwork"):
+		client = "Wakeup app"
+	case strings.Contains(ua, "edg/"):
+		client = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		client = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		client = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		client = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		client = "Safari"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") || strings.Contains(ua, "ios"):
+		platform = "iOS"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "mac os") || strings.Contains(ua, "macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "cros"):
+		platform = "ChromeOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	if platform == "" {
+		return client
+	}
+	return client + " on " + platform
+}
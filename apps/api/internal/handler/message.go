@@ -28,6 +28,9 @@ func (h *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !requireVerifiedEmail(w, r, h.db, userID) {
+		return
+	}
 
 	convID, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
@@ -175,6 +178,9 @@ func (h *MessageHandler) SendChannelMessage(w http.ResponseWriter, r *http.Reque
 		writeError(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !requireVerifiedEmail(w, r, h.db, userID) {
+		return
+	}
 
 	channelID, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
@@ -0,0 +1,413 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"wakeup/api/internal/auth"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	mfaChallengeExpiry      = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	recoveryCodeCount       = 10
+	totpIssuer              = "Wakeup"
+)
+
+// EnrollTOTP generates a new authenticator secret. It stays pending until ConfirmTOTP
+// proves the user's app produces matching codes.
+func (h *AuthHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		writeError(w, "failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+
+	var email string
+	err = h.db.QueryRow(r.Context(),
+		`UPDATE profiles SET totp_pending_secret = $1, updated_at = NOW()
+		 WHERE id = $2 AND totp_enabled_at IS NULL
+		 RETURNING email`,
+		secret, userID,
+	).Scan(&email)
+	if err == pgx.ErrNoRows {
+		writeError(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, email, totpIssuer),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication and returns fresh recovery codes
+func (h *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var pending *string
+	err := h.db.QueryRow(r.Context(),
+		`SELECT totp_pending_secret FROM profiles WHERE id = $1 AND totp_enabled_at IS NULL`,
+		userID,
+	).Scan(&pending)
+	if err != nil || pending == nil {
+		writeError(w, "no enrollment in progress", http.StatusBadRequest)
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(*pending, req.Code, time.Now())
+	if !valid {
+		writeError(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	_, err = tx.Exec(r.Context(),
+		`UPDATE profiles
+		 SET totp_secret = totp_pending_secret, totp_pending_secret = NULL,
+		     totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW()
+		 WHERE id = $2`,
+		step, userID,
+	)
+	if err != nil {
+		writeError(w, "failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(r.Context(), tx, userID)
+	if err != nil {
+		writeError(w, "failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to commit", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off. It needs both the password, if
+// the account has one, and a second factor so a hijacked access token alone can't
+// downgrade the account.
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.DisableTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash string
+	err := h.db.QueryRow(r.Context(),
+		`SELECT password_hash FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&passwordHash)
+	if err != nil {
+		writeError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	// Accounts without a password (signed up through a provider) prove themselves
+	// with the second factor alone
+	if passwordHash != "" && !auth.CheckPassword(req.Password, passwordHash) {
+		writeError(w, "invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	valid, err := h.verifySecondFactor(r.Context(), userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		writeError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		writeError(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	_, err = tx.Exec(r.Context(),
+		`UPDATE profiles
+		 SET totp_secret = NULL, totp_pending_secret = NULL, totp_enabled_at = NULL,
+		     totp_last_step = NULL, updated_at = NOW()
+		 WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(r.Context(), `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		writeError(w, "failed to delete recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to commit", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, invalidating the old set
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := h.verifySecondFactor(r.Context(), userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		writeError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		writeError(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	codes, err := replaceRecoveryCodes(r.Context(), tx, userID)
+	if err != nil {
+		writeError(w, "failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to commit", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// LoginMFA completes a two-step login by exchanging the challenge from Login plus a
+// TOTP or recovery code for tokens
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req model.MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		writeError(w, "mfa_token and code or recovery_code are required", http.StatusBadRequest)
+		return
+	}
+
+	// Count the attempt up front so a challenge can't be brute-forced
+	var challengeID, userID uuid.UUID
+	err := h.db.QueryRow(r.Context(),
+		`UPDATE mfa_challenges SET attempts = attempts + 1
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND attempts < $2
+		 RETURNING id, user_id`,
+		auth.HashRefreshToken(req.MFAToken), mfaChallengeMaxAttempts,
+	).Scan(&challengeID, &userID)
+	if err != nil {
+		writeError(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	var email string
+	if err := h.db.QueryRow(r.Context(), `SELECT email FROM profiles WHERE id = $1`, userID).Scan(&email); err != nil {
+		writeError(w, "user not found", http.StatusUnauthorized)
+		return
+	}
+
+	// Second-factor guesses count against the same account budget as passwords
+	if h.loginBlocked(w, r, email) {
+		return
+	}
+
+	valid, err := h.verifySecondFactor(r.Context(), userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		writeError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		h.recordLoginFailure(r, &userID, email, "invalid_mfa_code")
+		writeError(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+	h.resetLoginFailures(r, email)
+
+	result, err := h.db.Exec(r.Context(),
+		`UPDATE mfa_challenges SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`,
+		challengeID,
+	)
+	if err != nil || result.RowsAffected() == 0 {
+		writeError(w, "invalid or expired mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	var profile model.Profile
+	err = h.db.QueryRow(r.Context(),
+		`SELECT id, email, display_name, avatar_url, created_at, updated_at
+		 FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.AvatarURL, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		writeError(w, "user not found", http.StatusUnauthorized)
+		return
+	}
+
+	accessToken, refreshToken, err := h.generateTokens(r.Context(), &profile, r, nil)
+	if err != nil {
+		writeError(w, "failed to generate tokens", http.StatusInternalServerError)
+		return
+	}
+
+	h.resolveAvatarURL(r, &profile)
+	writeJSON(w, http.StatusOK, model.AuthResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		User:         &profile,
+	})
+}
+
+// createMFAChallenge stores a short-lived challenge that LoginMFA redeems
+func (h *AuthHandler) createMFAChallenge(ctx context.Context, userID uuid.UUID) (*model.MFAChallengeResponse, error) {
+	token, err := auth.GenerateRefreshToken() // Reuse the random token generator
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(mfaChallengeExpiry)
+	_, err = h.db.Exec(ctx,
+		`INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`,
+		userID, auth.HashRefreshToken(token), expiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.MFAChallengeResponse{MFARequired: true, MFAToken: token, ExpiresAt: expiresAt}, nil
+}
+
+// verifySecondFactor checks a TOTP code or consumes a recovery code. A TOTP code is
+// accepted at most once: its time step must be newer than the last one used.
+func (h *AuthHandler) verifySecondFactor(ctx context.Context, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		result, err := h.db.Exec(ctx,
+			`UPDATE mfa_recovery_codes SET used_at = NOW()
+			 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+			userID, auth.HashRefreshToken(auth.NormalizeRecoveryCode(recoveryCode)),
+		)
+		if err != nil {
+			return false, err
+		}
+		return result.RowsAffected() == 1, nil
+	}
+
+	var secret *string
+	err := h.db.QueryRow(ctx,
+		`SELECT totp_secret FROM profiles WHERE id = $1 AND totp_enabled_at IS NOT NULL`,
+		userID,
+	).Scan(&secret)
+	if err == pgx.ErrNoRows || (err == nil && secret == nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	step, valid := auth.ValidateTOTP(*secret, code, time.Now())
+	if !valid {
+		return false, nil
+	}
+
+	result, err := h.db.Exec(ctx,
+		`UPDATE profiles SET totp_last_step = $1
+		 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`,
+		step, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and returns a new plaintext set
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, auth.HashRefreshToken(code),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"wakeup/api/internal/middleware"
 	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -13,11 +14,12 @@ import (
 )
 
 type NestHandler struct {
-	db *pgxpool.Pool
+	db  *pgxpool.Pool
+	hub *ws.Hub
 }
 
-func NewNestHandler(db *pgxpool.Pool) *NestHandler {
-	return &NestHandler{db: db}
+func NewNestHandler(db *pgxpool.Pool, hub *ws.Hub) *NestHandler {
+	return &NestHandler{db: db, hub: hub}
 }
 
 func (h *NestHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -26,6 +28,9 @@ func (h *NestHandler) Create(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !requireVerifiedEmail(w, r, h.db, userID) {
+		return
+	}
 
 	var req model.CreateNestRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -232,6 +237,9 @@ func (h *NestHandler) Join(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if !requireVerifiedEmail(w, r, h.db, userID) {
+		return
+	}
 
 	nestID, err := uuid.Parse(chi.URLParam(r, "id"))
 	if err != nil {
@@ -302,5 +310,8 @@ func (h *NestHandler) Leave(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	hiddenSubscriptionsChanged(r.Context(), h.db, h.hub, userID,
+		`bl.id IN (SELECT list_id FROM block_list_nests WHERE nest_id = $2)`, nestID)
+
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,506 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"wakeup/api/internal/auth"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/oauth"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	oauthStateExpiry     = 10 * time.Minute
+	oauthLoginCodeExpiry = 2 * time.Minute
+)
+
+// Reasons passed back to the client as ?error=... when a provider login fails
+var (
+	errOAuthIdentityInUse = errors.New("identity_in_use")
+	errOAuthEmailInUse    = errors.New("email_in_use")
+	errOAuthEmailRequired = errors.New("email_required")
+)
+
+// OAuthHandler signs users in with external identity providers. The browser is sent
+// to the provider, comes back to Callback, and is then redirected to the client with
+// a short-lived login code that Exchange turns into tokens, so tokens never appear
+// in a URL.
+type OAuthHandler struct {
+	auth      *AuthHandler
+	providers map[string]*oauth.Provider
+}
+
+func NewOAuthHandler(authHandler *AuthHandler, providers map[string]*oauth.Provider) *OAuthHandler {
+	return &OAuthHandler{auth: authHandler, providers: providers}
+}
+
+// Providers lists the configured provider names so clients know which buttons to show
+func (h *OAuthHandler) Providers(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(h.providers))
+	for name := range h.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string][]string{"providers": names})
+}
+
+// Start begins a sign-in with a provider
+func (h *OAuthHandler) Start(w http.ResponseWriter, r *http.Request) {
+	h.start(w, r, nil)
+}
+
+// StartLink begins linking a provider identity to the signed-in user
+func (h *OAuthHandler) StartLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.start(w, r, &userID)
+}
+
+func (h *OAuthHandler) start(w http.ResponseWriter, r *http.Request, linkUserID *uuid.UUID) {
+	provider, ok := h.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		writeError(w, "unknown provider", http.StatusNotFound)
+		return
+	}
+
+	var req model.OAuthStartRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.RedirectURI == "" {
+		req.RedirectURI = strings.TrimRight(h.auth.cfg.AppURL, "/") + "/auth/callback"
+	}
+	if !h.allowedRedirect(req.RedirectURI) {
+		writeError(w, "redirect_uri is not allowed", http.StatusBadRequest)
+		return
+	}
+
+	state, err := auth.GenerateRefreshToken() // Reuse the random token generator
+	if err != nil {
+		writeError(w, "failed to generate state", http.StatusInternalServerError)
+		return
+	}
+	verifier, challenge, err := oauth.GeneratePKCE()
+	if err != nil {
+		writeError(w, "failed to generate pkce", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, challenge, h.callbackURL(provider))
+	if err != nil {
+		log.Printf("OAuth %s: %v", provider.Name, err)
+		writeError(w, "provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	_, err = h.auth.db.Exec(r.Context(),
+		`INSERT INTO oauth_states (state_hash, provider, code_verifier, redirect_uri, link_user_id, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		auth.HashRefreshToken(state), provider.Name, verifier, req.RedirectURI, linkUserID,
+		time.Now().Add(oauthStateExpiry),
+	)
+	if err != nil {
+		writeError(w, "failed to store state", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.OAuthStartResponse{AuthorizationURL: authURL})
+}
+
+// Callback is where the provider sends the browser back to. It always ends in a
+// redirect to the client's redirect_uri, carrying either a login code or an error.
+func (h *OAuthHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		writeError(w, "unknown provider", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	var stateID uuid.UUID
+	var verifier, redirectURI string
+	var linkUserID *uuid.UUID
+	err := h.auth.db.QueryRow(r.Context(),
+		`UPDATE oauth_states SET completed_at = NOW()
+		 WHERE state_hash = $1 AND provider = $2 AND completed_at IS NULL AND expires_at > NOW()
+		 RETURNING id, code_verifier, redirect_uri, link_user_id`,
+		auth.HashRefreshToken(query.Get("state")), provider.Name,
+	).Scan(&stateID, &verifier, &redirectURI, &linkUserID)
+	if err != nil {
+		writeError(w, "invalid or expired state", http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("error") != "" || query.Get("code") == "" {
+		redirectWithParam(w, r, redirectURI, "error", "access_denied")
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), verifier, h.callbackURL(provider))
+	if err != nil {
+		log.Printf("OAuth %s: %v", provider.Name, err)
+		redirectWithParam(w, r, redirectURI, "error", "provider_error")
+		return
+	}
+
+	if linkUserID != nil {
+		if err := h.linkIdentity(r.Context(), *linkUserID, provider.Name, identity); err != nil {
+			redirectWithParam(w, r, redirectURI, "error", oauthErrorCode(err))
+			return
+		}
+		redirectWithParam(w, r, redirectURI, "linked", provider.Name)
+		return
+	}
+
+	userID, err := h.resolveUser(r.Context(), provider.Name, identity)
+	if err != nil {
+		redirectWithParam(w, r, redirectURI, "error", oauthErrorCode(err))
+		return
+	}
+
+	code, err := auth.GenerateRefreshToken()
+	if err != nil {
+		redirectWithParam(w, r, redirectURI, "error", "server_error")
+		return
+	}
+	_, err = h.auth.db.Exec(r.Context(),
+		`UPDATE oauth_states SET user_id = $1, login_code_hash = $2 WHERE id = $3`,
+		userID, auth.HashRefreshToken(code), stateID,
+	)
+	if err != nil {
+		redirectWithParam(w, r, redirectURI, "error", "server_error")
+		return
+	}
+
+	redirectWithParam(w, r, redirectURI, "code", code)
+}
+
+// Exchange swaps the login code from Callback for tokens, or for an MFA challenge when
+// the account has two-factor authentication enabled
+func (h *OAuthHandler) Exchange(w http.ResponseWriter, r *http.Request) {
+	var req model.OAuthExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Code == "" {
+		writeError(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	var userID uuid.UUID
+	err := h.auth.db.QueryRow(r.Context(),
+		`UPDATE oauth_states SET consumed_at = NOW()
+		 WHERE login_code_hash = $1 AND consumed_at IS NULL AND completed_at > $2
+		 RETURNING user_id`,
+		auth.HashRefreshToken(req.Code), time.Now().Add(-oauthLoginCodeExpiry),
+	).Scan(&userID)
+	if err != nil {
+		writeError(w, "invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+
+	var profile model.Profile
+	var totpEnabledAt *time.Time
+	err = h.auth.db.QueryRow(r.Context(),
+		`SELECT id, email, display_name, avatar_url, totp_enabled_at, created_at, updated_at
+		 FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&profile.ID, &profile.Email, &profile.DisplayName, &profile.AvatarURL, &totpEnabledAt, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		writeError(w, "user not found", http.StatusUnauthorized)
+		return
+	}
+
+	if totpEnabledAt != nil {
+		challenge, err := h.auth.createMFAChallenge(r.Context(), profile.ID)
+		if err != nil {
+			writeError(w, "failed to create mfa challenge", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, challenge)
+		return
+	}
+
+	accessToken, refreshToken, err := h.auth.generateTokens(r.Context(), &profile, r, nil)
+	if err != nil {
+		writeError(w, "failed to generate tokens", http.StatusInternalServerError)
+		return
+	}
+
+	ResolveAvatarURL(r, &profile)
+	writeJSON(w, http.StatusOK, model.AuthResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		User:         &profile,
+	})
+}
+
+// ListIdentities returns the provider identities linked to the current user
+func (h *OAuthHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.auth.db.Query(r.Context(),
+		`SELECT id, provider, email, created_at, last_login_at
+		 FROM linked_identities
+		 WHERE user_id = $1
+		 ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch identities", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	identities := []model.LinkedIdentity{}
+	for rows.Next() {
+		var li model.LinkedIdentity
+		if err := rows.Scan(&li.ID, &li.Provider, &li.Email, &li.CreatedAt, &li.LastLoginAt); err != nil {
+			writeError(w, "failed to scan identity", http.StatusInternalServerError)
+			return
+		}
+		identities = append(identities, li)
+	}
+
+	writeJSON(w, http.StatusOK, model.LinkedIdentitiesResponse{Identities: identities})
+}
+
+// Unlink removes a linked identity, as long as the user keeps some way to sign in
+func (h *OAuthHandler) Unlink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	identityID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid identity id", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.auth.db.Exec(r.Context(),
+		`DELETE FROM linked_identities li
+		 WHERE li.id = $1 AND li.user_id = $2
+		   AND (
+		       EXISTS(SELECT 1 FROM profiles p WHERE p.id = $2 AND p.password_hash <> '')
+		       OR EXISTS(SELECT 1 FROM linked_identities o WHERE o.user_id = $2 AND o.id <> $1)
+		   )`,
+		identityID, userID,
+	)
+	if err != nil {
+		writeError(w, "failed to unlink identity", http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		writeError(w, "identity not found, or it is your only way to sign in", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resolveUser finds or creates the profile for a provider identity. An existing
+// profile with the same email is only linked automatically when both the
+// provider and the profile have verified that email; otherwise the user has to
+// sign in and link explicitly. Linking into an unverified profile would hand
+// the account to whoever registered the address first.
+func (h *OAuthHandler) resolveUser(ctx context.Context, provider string, identity *oauth.Identity) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := h.auth.db.QueryRow(ctx,
+		`UPDATE linked_identities SET last_login_at = NOW()
+		 WHERE provider = $1 AND subject = $2
+		 RETURNING user_id`,
+		provider, identity.Subject,
+	).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	}
+	if err != pgx.ErrNoRows {
+		return uuid.Nil, err
+	}
+
+	if identity.Email == "" {
+		return uuid.Nil, errOAuthEmailRequired
+	}
+
+	tx, err := h.auth.db.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var profileVerified bool
+	err = tx.QueryRow(ctx,
+		`SELECT id, email_verified_at IS NOT NULL FROM profiles WHERE email = $1`,
+		identity.Email,
+	).Scan(&userID, &profileVerified)
+	switch {
+	case err == pgx.ErrNoRows:
+		userID, err = createProviderProfile(ctx, tx, identity)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	case err != nil:
+		return uuid.Nil, err
+	case !identity.EmailVerified || !profileVerified:
+		return uuid.Nil, errOAuthEmailInUse
+	}
+
+	// userID is either the new account or an existing one whose email both the
+	// provider and we have verified; the identity gets linked to it
+	_, err = tx.Exec(ctx,
+		`INSERT INTO linked_identities (user_id, provider, subject, email, last_login_at)
+		 VALUES ($1, $2, $3, $4, NOW())`,
+		userID, provider, identity.Subject, identity.Email,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return userID, tx.Commit(ctx)
+}
+
+// createProviderProfile creates the account for a first provider login. It has no
+// password until the user sets one via reset.
+func createProviderProfile(ctx context.Context, tx pgx.Tx, identity *oauth.Identity) (uuid.UUID, error) {
+	displayName := identity.Name
+	if displayName == "" {
+		displayName = strings.Split(identity.Email, "@")[0]
+	}
+	var avatarURL *string
+	if identity.AvatarURL != "" {
+		avatarURL = &identity.AvatarURL
+	}
+	var verifiedAt *time.Time
+	if identity.EmailVerified {
+		now := time.Now()
+		verifiedAt = &now
+	}
+
+	var userID uuid.UUID
+	err := tx.QueryRow(ctx,
+		`INSERT INTO profiles (email, password_hash, display_name, avatar_url, email_verified_at)
+		 VALUES ($1, '', $2, $3, $4)
+		 RETURNING id`,
+		identity.Email, displayName, avatarURL, verifiedAt,
+	).Scan(&userID)
+	return userID, err
+}
+
+// linkIdentity attaches a provider identity to an existing user. An identity that
+// is already linked is left alone unless it belongs to userID.
+func (h *OAuthHandler) linkIdentity(ctx context.Context, userID uuid.UUID, provider string, identity *oauth.Identity) error {
+	var ownerID uuid.UUID
+	err := h.auth.db.QueryRow(ctx,
+		`INSERT INTO linked_identities (user_id, provider, subject, email)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (provider, subject) DO NOTHING
+		 RETURNING user_id`,
+		userID, provider, identity.Subject, identity.Email,
+	).Scan(&ownerID)
+	if err == nil {
+		return nil
+	}
+	if err != pgx.ErrNoRows {
+		return err
+	}
+
+	err = h.auth.db.QueryRow(ctx,
+		`SELECT user_id FROM linked_identities WHERE provider = $1 AND subject = $2`,
+		provider, identity.Subject,
+	).Scan(&ownerID)
+	if err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return errOAuthIdentityInUse
+	}
+
+	_, err = h.auth.db.Exec(ctx,
+		`UPDATE linked_identities SET email = $1
+		 WHERE provider = $2 AND subject = $3 AND user_id = $4`,
+		identity.Email, provider, identity.Subject, userID,
+	)
+	return err
+}
+
+func (h *OAuthHandler) callbackURL(provider *oauth.Provider) string {
+	return strings.TrimRight(h.auth.cfg.APIURL, "/") + "/auth/oauth/" + provider.Name + "/callback"
+}
+
+// allowedRedirect accepts redirect URIs on a configured origin, at or below
+// its path. Paths are compared by whole segments, so /auth doesn't allow /authevil.
+func (h *OAuthHandler) allowedRedirect(redirectURI string) bool {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range h.auth.cfg.OAuthRedirectURLs {
+		prefix, err := url.Parse(allowed)
+		if err != nil {
+			continue
+		}
+		if target.Scheme == prefix.Scheme && target.Host == prefix.Host && pathWithin(target.Path, prefix.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathWithin reports whether p is base or below it, after resolving dot segments
+func pathWithin(p, base string) bool {
+	if p == "" {
+		p = "/"
+	}
+	p = path.Clean(p)
+	base = strings.TrimSuffix(path.Clean("/"+base), "/")
+	return p == base || strings.HasPrefix(p, base+"/") || base == ""
+}
+
+func oauthErrorCode(err error) string {
+	switch err {
+	case errOAuthIdentityInUse, errOAuthEmailInUse, errOAuthEmailRequired:
+		return err.Error()
+	}
+	log.Printf("OAuth login failed: %v", err)
+	return "server_error"
+}
+
+func redirectWithParam(w http.ResponseWriter, r *http.Request, redirectURI, key, value string) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		writeError(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := target.Query()
+	q.Set(key, value)
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
@@ -0,0 +1,635 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"wakeup/api/internal/focus"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// roomVisibleSQL limits focus_rooms fr to the rooms user $1 can see and join:
+// rooms they are in, rooms shared with one of their nests, and rooms hosted by
+// them or an accepted friend
+const roomVisibleSQL = `(
+	EXISTS (SELECT 1 FROM focus_room_members m WHERE m.room_id = fr.id AND m.user_id = $1 AND m.left_at IS NULL)
+	OR (fr.nest_id IS NOT NULL AND EXISTS (
+	    SELECT 1 FROM nest_members nm WHERE nm.nest_id = fr.nest_id AND nm.user_id = $1))
+	OR (fr.nest_id IS NULL AND (fr.host_id = $1 OR EXISTS (
+	    SELECT 1 FROM friendships f
+	    WHERE f.status = 'accepted'
+	      AND ((f.requester_id = $1 AND f.addressee_id = fr.host_id)
+	        OR (f.addressee_id = $1 AND f.requester_id = fr.host_id)))))
+)`
+
+// RoomHandler manages group focus rooms. Once a room starts every participant
+// gets their own focus_sessions row on the room's shared timer, which the
+// scheduler advances like any other session.
+type RoomHandler struct {
+	db    *pgxpool.Pool
+	hub   *ws.Hub
+	goals *focus.GoalTracker
+}
+
+func NewRoomHandler(db *pgxpool.Pool, hub *ws.Hub, goals *focus.GoalTracker) *RoomHandler {
+	return &RoomHandler{db: db, hub: hub, goals: goals}
+}
+
+// List returns the waiting and running rooms the user can see
+func (h *RoomHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(r.Context(),
+		`SELECT fr.id FROM focus_rooms fr
+		 WHERE fr.status <> 'ended' AND `+roomVisibleSQL+`
+		 ORDER BY fr.created_at DESC
+		 LIMIT 50`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch rooms", http.StatusInternalServerError)
+		return
+	}
+	var roomIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			writeError(w, "failed to scan room", http.StatusInternalServerError)
+			return
+		}
+		roomIDs = append(roomIDs, id)
+	}
+	rows.Close()
+
+	rooms := []model.FocusRoom{}
+	for _, id := range roomIDs {
+		room, err := focus.LoadRoom(r.Context(), h.db, id)
+		if err != nil {
+			writeError(w, "failed to fetch rooms", http.StatusInternalServerError)
+			return
+		}
+		rooms = append(rooms, room)
+	}
+
+	writeJSON(w, http.StatusOK, model.FocusRoomsResponse{Rooms: rooms})
+}
+
+// Create opens a room with the given timer settings, hosted by the user. It is
+// shared with the host's friends, or with a nest's members when nest_id is set.
+func (h *RoomHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.CreateFocusRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Name) > 100 {
+		writeError(w, "name must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := focus.PlanFromRequest(model.StartSessionRequest{
+		Preset:            req.Preset,
+		FocusMinutes:      req.FocusMinutes,
+		ShortBreakMinutes: req.ShortBreakMinutes,
+		LongBreakMinutes:  req.LongBreakMinutes,
+		LongBreakEvery:    req.LongBreakEvery,
+		Cycles:            req.Cycles,
+	})
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.NestID != nil {
+		var isMember bool
+		err := h.db.QueryRow(r.Context(),
+			`SELECT EXISTS(SELECT 1 FROM nest_members WHERE nest_id = $1 AND user_id = $2)`,
+			*req.NestID, userID,
+		).Scan(&isMember)
+		if err != nil || !isMember {
+			writeError(w, "not a member of this nest", http.StatusForbidden)
+			return
+		}
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var roomID uuid.UUID
+	args := append([]interface{}{req.Name, userID, req.NestID}, plan.Args()...)
+	err = tx.QueryRow(r.Context(),
+		`INSERT INTO focus_rooms (name, host_id, nest_id,
+		     mode, focus_seconds, short_break_seconds, long_break_seconds, long_break_every, cycles)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING id`,
+		args...,
+	).Scan(&roomID)
+	if err != nil {
+		writeError(w, "failed to create room", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(r.Context(),
+		`INSERT INTO focus_room_members (room_id, user_id) VALUES ($1, $2)`,
+		roomID, userID,
+	)
+	if err != nil {
+		writeError(w, "failed to create room", http.StatusInternalServerError)
+		return
+	}
+
+	room, err := focus.LoadRoom(r.Context(), tx, roomID)
+	if err != nil {
+		writeError(w, "failed to create room", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to create room", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, room)
+}
+
+func (h *RoomHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	roomID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid room id", http.StatusBadRequest)
+		return
+	}
+
+	var visible bool
+	err = h.db.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM focus_rooms fr WHERE fr.id = $2 AND `+roomVisibleSQL+`)`,
+		userID, roomID,
+	).Scan(&visible)
+	if err != nil || !visible {
+		writeError(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	room, err := focus.LoadRoom(r.Context(), h.db, roomID)
+	if err != nil {
+		writeError(w, "failed to fetch room", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, room)
+}
+
+// Join adds the user to a room. Joining a running room starts their session
+// right away, lined up with the phase the room is in.
+func (h *RoomHandler) Join(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	roomID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid room id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var status string
+	err = tx.QueryRow(r.Context(),
+		`SELECT fr.status FROM focus_rooms fr
+		 WHERE fr.id = $2 AND `+roomVisibleSQL+`
+		 FOR UPDATE`,
+		userID, roomID,
+	).Scan(&status)
+	if err != nil {
+		writeError(w, "room not found", http.StatusNotFound)
+		return
+	}
+	if status == "ended" {
+		writeError(w, "room has ended", http.StatusConflict)
+		return
+	}
+
+	_, err = tx.Exec(r.Context(),
+		`INSERT INTO focus_room_members (room_id, user_id) VALUES ($1, $2)
+		 ON CONFLICT (room_id, user_id) DO UPDATE
+		 SET joined_at = CASE WHEN focus_room_members.left_at IS NULL THEN focus_room_members.joined_at ELSE NOW() END,
+		     left_at = NULL`,
+		roomID, userID,
+	)
+	if err != nil {
+		writeError(w, "failed to join room", http.StatusInternalServerError)
+		return
+	}
+
+	var started *model.FocusSession
+	if status == "running" {
+		var currentRoom *uuid.UUID
+		err := tx.QueryRow(r.Context(),
+			`SELECT room_id FROM focus_sessions
+			 WHERE user_id = $1 AND status IN ('active', 'paused')
+			 LIMIT 1
+			 FOR UPDATE`,
+			userID,
+		).Scan(&currentRoom)
+		switch {
+		case err == nil && (currentRoom == nil || *currentRoom != roomID):
+			writeError(w, "stop your current session before joining", http.StatusConflict)
+			return
+		case errors.Is(err, pgx.ErrNoRows):
+			sessionID, err := focus.JoinRoomSession(r.Context(), tx, roomID, userID, time.Now())
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeError(w, "room has ended", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, focus.ErrSessionRunning) {
+				writeError(w, "stop your current session before joining", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				writeError(w, "failed to join room", http.StatusInternalServerError)
+				return
+			}
+			var session model.FocusSession
+			err = focus.ScanSession(tx.QueryRow(r.Context(),
+				`SELECT `+focus.SessionColumns+` FROM focus_sessions WHERE id = $1`,
+				sessionID,
+			), &session)
+			if err != nil {
+				writeError(w, "failed to join room", http.StatusInternalServerError)
+				return
+			}
+			started = &session
+		case err != nil:
+			writeError(w, "database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	room, err := focus.LoadRoom(r.Context(), tx, roomID)
+	if err != nil {
+		writeError(w, "failed to join room", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to join room", http.StatusInternalServerError)
+		return
+	}
+
+	if started != nil && h.hub != nil {
+		h.hub.Broadcast([]uuid.UUID{userID}, focus.PhaseChangedEvent(*started, ""))
+	}
+	focus.BroadcastRoom(r.Context(), h.db, h.hub, roomID)
+	writeJSON(w, http.StatusOK, room)
+}
+
+// Leave removes the user from a room, completing their room session. A host
+// who leaves hands the room to the longest-standing participant; the room
+// ends when nobody is left.
+func (h *RoomHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	roomID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid room id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var hostID uuid.UUID
+	err = tx.QueryRow(r.Context(),
+		`SELECT host_id FROM focus_rooms WHERE id = $1 FOR UPDATE`,
+		roomID,
+	).Scan(&hostID)
+	if err != nil {
+		writeError(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	result, err := tx.Exec(r.Context(),
+		`UPDATE focus_room_members SET left_at = NOW()
+		 WHERE room_id = $1 AND user_id = $2 AND left_at IS NULL`,
+		roomID, userID,
+	)
+	if err != nil {
+		writeError(w, "failed to leave room", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected() == 0 {
+		writeError(w, "not in this room", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	var ended *model.FocusSession
+	var sessionID uuid.UUID
+	err = tx.QueryRow(r.Context(),
+		`SELECT id FROM focus_sessions
+		 WHERE user_id = $1 AND room_id = $2 AND status IN ('active', 'paused')
+		 FOR UPDATE`,
+		userID, roomID,
+	).Scan(&sessionID)
+	if err == nil {
+		if err := focus.CloseInterval(r.Context(), tx, sessionID, now); err != nil {
+			writeError(w, "failed to leave room", http.StatusInternalServerError)
+			return
+		}
+		var session model.FocusSession
+		err = focus.ScanSession(tx.QueryRow(r.Context(),
+			`UPDATE focus_sessions
+			 SET ended_at = $2, status = 'completed', phase_ends_at = NULL, phase_remaining_seconds = NULL
+			 WHERE id = $1
+			 RETURNING `+focus.SessionColumns,
+			sessionID, now,
+		), &session)
+		if err != nil {
+			writeError(w, "failed to leave room", http.StatusInternalServerError)
+			return
+		}
+		ended = &session
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	if hostID == userID {
+		_, err = tx.Exec(r.Context(),
+			`UPDATE focus_rooms SET host_id = next.user_id
+			 FROM (
+			     SELECT user_id FROM focus_room_members
+			     WHERE room_id = $1 AND left_at IS NULL
+			     ORDER BY joined_at
+			     LIMIT 1
+			 ) next
+			 WHERE id = $1`,
+			roomID,
+		)
+		if err != nil {
+			writeError(w, "failed to leave room", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_, err = tx.Exec(r.Context(),
+		`UPDATE focus_rooms SET status = 'ended', ended_at = NOW()
+		 WHERE id = $1 AND status <> 'ended'
+		   AND NOT EXISTS (SELECT 1 FROM focus_room_members WHERE room_id = $1 AND left_at IS NULL)`,
+		roomID,
+	)
+	if err != nil {
+		writeError(w, "failed to leave room", http.StatusInternalServerError)
+		return
+	}
+	if err := focus.SettleRoom(r.Context(), tx, roomID); err != nil {
+		writeError(w, "failed to leave room", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to leave room", http.StatusInternalServerError)
+		return
+	}
+
+	if ended != nil {
+		if h.hub != nil {
+			h.hub.Broadcast([]uuid.UUID{userID}, focus.PhaseChangedEvent(*ended, ended.Phase))
+		}
+		h.goals.Evaluate(r.Context(), userID)
+	}
+	focus.BroadcastRoom(r.Context(), h.db, h.hub, roomID, userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Start begins the room's shared timer for everyone in it. Participants who
+// are busy with a session of their own are skipped and can join in later.
+func (h *RoomHandler) Start(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	roomID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid room id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	now := time.Now()
+	var room model.FocusRoom
+	err = focus.ScanRoom(tx.QueryRow(r.Context(),
+		`UPDATE focus_rooms SET status = 'running', started_at = $3
+		 WHERE id = $1 AND host_id = $2 AND status = 'waiting'
+		 RETURNING `+focus.RoomColumns,
+		roomID, userID, now,
+	), &room)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "room not found or already started", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to start room", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := tx.Query(r.Context(),
+		`SELECT m.user_id FROM focus_room_members m
+		 WHERE m.room_id = $1 AND m.left_at IS NULL
+		   AND NOT EXISTS (
+		       SELECT 1 FROM focus_sessions s
+		       WHERE s.user_id = m.user_id AND s.status IN ('active', 'paused')
+		   )`,
+		roomID,
+	)
+	if err != nil {
+		writeError(w, "failed to start room", http.StatusInternalServerError)
+		return
+	}
+	var participants []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			writeError(w, "failed to start room", http.StatusInternalServerError)
+			return
+		}
+		participants = append(participants, id)
+	}
+	rows.Close()
+
+	if len(participants) == 0 {
+		writeError(w, "nobody in the room is free to start", http.StatusConflict)
+		return
+	}
+
+	var sessions []model.FocusSession
+	for _, participant := range participants {
+		sessionID, err := focus.StartRoomSession(r.Context(), tx, room, participant, now)
+		if errors.Is(err, focus.ErrSessionRunning) {
+			// Started a session of their own since the lookup; leave them out
+			continue
+		}
+		if err != nil {
+			writeError(w, "failed to start room", http.StatusInternalServerError)
+			return
+		}
+		var session model.FocusSession
+		err = focus.ScanSession(tx.QueryRow(r.Context(),
+			`SELECT `+focus.SessionColumns+` FROM focus_sessions WHERE id = $1`,
+			sessionID,
+		), &session)
+		if err != nil {
+			writeError(w, "failed to start room", http.StatusInternalServerError)
+			return
+		}
+		sessions = append(sessions, session)
+	}
+	if len(sessions) == 0 {
+		writeError(w, "nobody in the room is free to start", http.StatusConflict)
+		return
+	}
+
+	room, err = focus.LoadRoom(r.Context(), tx, roomID)
+	if err != nil {
+		writeError(w, "failed to start room", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to start room", http.StatusInternalServerError)
+		return
+	}
+
+	if h.hub != nil {
+		for _, session := range sessions {
+			h.hub.Broadcast([]uuid.UUID{session.UserID}, focus.PhaseChangedEvent(session, ""))
+		}
+	}
+	focus.BroadcastRoom(r.Context(), h.db, h.hub, roomID)
+	writeJSON(w, http.StatusOK, room)
+}
+
+// End closes the room for everyone, completing all running room sessions
+func (h *RoomHandler) End(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	roomID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid room id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	now := time.Now()
+	result, err := tx.Exec(r.Context(),
+		`UPDATE focus_rooms SET status = 'ended', ended_at = $3
+		 WHERE id = $1 AND host_id = $2 AND status <> 'ended'`,
+		roomID, userID, now,
+	)
+	if err != nil {
+		writeError(w, "failed to end room", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected() == 0 {
+		writeError(w, "room not found or already ended", http.StatusNotFound)
+		return
+	}
+
+	sessions, err := focus.EndRoomSessions(r.Context(), tx, roomID, now)
+	if err != nil {
+		writeError(w, "failed to end room", http.StatusInternalServerError)
+		return
+	}
+
+	room, err := focus.LoadRoom(r.Context(), tx, roomID)
+	if err != nil {
+		writeError(w, "failed to end room", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to end room", http.StatusInternalServerError)
+		return
+	}
+
+	for _, session := range sessions {
+		if h.hub != nil {
+			h.hub.Broadcast([]uuid.UUID{session.UserID}, focus.PhaseChangedEvent(session, session.Phase))
+		}
+		h.goals.Evaluate(r.Context(), session.UserID)
+	}
+	focus.BroadcastRoom(r.Context(), h.db, h.hub, roomID)
+	writeJSON(w, http.StatusOK, room)
+}
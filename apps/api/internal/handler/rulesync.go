@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"log"
+
+	"wakeup/api/internal/focus"
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// eventBlockRulesChanged is sent when the rules a user follows change
+const eventBlockRulesChanged = "blockrules.changed"
+
+// blockRulesChanged bumps the rule-set version of users, and of the
+// subscribers of listID when it's set, and tells their connected clients to
+// refetch. It's for changes that only affect the rules indirectly and are
+// saved before it runs, such as an unfriend hiding a subscribed list; writes
+// to rules, lists and schedules bump the version in their own transaction.
+func blockRulesChanged(ctx context.Context, db *pgxpool.Pool, hub *ws.Hub, listID *uuid.UUID, userIDs ...uuid.UUID) {
+	versions, err := bumpBlockRulesVersion(ctx, db, listID, userIDs...)
+	if err != nil {
+		log.Printf("Failed to bump block rule versions: %v", err)
+		return
+	}
+	broadcastBlockRulesChanged(hub, versions)
+}
+
+// bumpBlockRulesVersion is the first half of blockRulesChanged, for changes
+// that bump the version in their own transaction. It returns the new versions
+// to broadcast once that transaction commits.
+func bumpBlockRulesVersion(ctx context.Context, db focus.Querier, listID *uuid.UUID, userIDs ...uuid.UUID) (map[uuid.UUID]int64, error) {
+	rows, err := db.Query(ctx,
+		`UPDATE profiles SET block_rules_version = block_rules_version + 1
+		 WHERE id = ANY($1) OR id IN (SELECT user_id FROM block_list_subscriptions WHERE list_id = $2)
+		 RETURNING id, block_rules_version`,
+		userIDs, listID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[uuid.UUID]int64{}
+	for rows.Next() {
+		var userID uuid.UUID
+		var version int64
+		if err := rows.Scan(&userID, &version); err != nil {
+			return nil, err
+		}
+		versions[userID] = version
+	}
+	return versions, rows.Err()
+}
+
+// broadcastBlockRulesChanged sends each user their new rule-set version
+func broadcastBlockRulesChanged(hub *ws.Hub, versions map[uuid.UUID]int64) {
+	for userID, version := range versions {
+		event := model.BlockRulesChangedEvent{Version: version}
+		hub.Broadcast([]uuid.UUID{userID}, ws.Event{Type: eventBlockRulesChanged, Data: event})
+	}
+}
+
+// hiddenSubscriptionsChanged notifies userID when they follow a list, picked
+// by filter on block_lists bl with $2 bound to arg, that they can no longer
+// see. Call it after an unfriend or nest leave has been saved.
+func hiddenSubscriptionsChanged(ctx context.Context, db *pgxpool.Pool, hub *ws.Hub, userID uuid.UUID, filter string, arg any) {
+	var hidden bool
+	err := db.QueryRow(ctx,
+		`SELECT EXISTS(
+		     SELECT 1 FROM block_list_subscriptions s
+		     JOIN block_lists bl ON bl.id = s.list_id
+		     WHERE s.user_id = $1 AND `+filter+` AND NOT `+blockListVisibleSQL+`)`,
+		userID, arg,
+	).Scan(&hidden)
+	if err != nil {
+		log.Printf("Failed to check block list subscriptions: %v", err)
+		return
+	}
+	if hidden {
+		blockRulesChanged(ctx, db, hub, nil, userID)
+	}
+}
@@ -0,0 +1,403 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"wakeup/api/internal/focus"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ScheduleHandler manages recurring focus schedules. The scheduler starts and
+// stops their occurrences like any other scheduled block.
+type ScheduleHandler struct {
+	db  *pgxpool.Pool
+	hub *ws.Hub
+}
+
+func NewScheduleHandler(db *pgxpool.Pool, hub *ws.Hub) *ScheduleHandler {
+	return &ScheduleHandler{db: db, hub: hub}
+}
+
+// ownedSchedule parses the {id} URL param and checks the schedule belongs to userID
+func (h *ScheduleHandler) ownedSchedule(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (uuid.UUID, bool) {
+	scheduleID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid schedule id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	var exists bool
+	err = h.db.QueryRow(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM focus_schedules WHERE id = $1 AND user_id = $2)`,
+		scheduleID, userID,
+	).Scan(&exists)
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return uuid.Nil, false
+	}
+	if !exists {
+		writeError(w, "schedule not found", http.StatusNotFound)
+		return uuid.Nil, false
+	}
+	return scheduleID, true
+}
+
+// parseSchedule decodes and validates a schedule, defaulting to the user's time zone
+func (h *ScheduleHandler) parseSchedule(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (focus.Recurrence, *bool, bool) {
+	var req model.UpsertScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return focus.Recurrence{}, nil, false
+	}
+
+	var timezone string
+	err := h.db.QueryRow(r.Context(),
+		`SELECT timezone FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&timezone)
+	if err != nil {
+		writeError(w, "user not found", http.StatusNotFound)
+		return focus.Recurrence{}, nil, false
+	}
+
+	rec, err := focus.RecurrenceFromRequest(req, timezone)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return focus.Recurrence{}, nil, false
+	}
+	return rec, req.Enabled, true
+}
+
+// List returns the user's schedules with their upcoming occurrences
+func (h *ScheduleHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.Query(r.Context(),
+		`SELECT id FROM focus_schedules WHERE user_id = $1 ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to fetch schedules", http.StatusInternalServerError)
+		return
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			writeError(w, "failed to scan schedule", http.StatusInternalServerError)
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	schedules := []model.FocusSchedule{}
+	for _, id := range ids {
+		schedule, err := focus.LoadSchedule(r.Context(), h.db, id)
+		if err != nil {
+			writeError(w, "failed to fetch schedules", http.StatusInternalServerError)
+			return
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	writeJSON(w, http.StatusOK, model.FocusSchedulesResponse{Schedules: schedules})
+}
+
+// Create adds a schedule and schedules its occurrences for the coming week
+func (h *ScheduleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rec, enabled, ok := h.parseSchedule(w, r, userID)
+	if !ok {
+		return
+	}
+	if enabled == nil {
+		t := true
+		enabled = &t
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var scheduleID uuid.UUID
+	args := append([]interface{}{userID, *enabled}, rec.Args()...)
+	err = tx.QueryRow(r.Context(),
+		`INSERT INTO focus_schedules (user_id, enabled, name, days, start_minute, end_minute, timezone)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id`,
+		args...,
+	).Scan(&scheduleID)
+	if err != nil {
+		writeError(w, "failed to create schedule", http.StatusInternalServerError)
+		return
+	}
+
+	if err := focus.MaterializeSchedule(r.Context(), tx, scheduleID, time.Now()); err != nil {
+		writeError(w, "failed to create schedule", http.StatusInternalServerError)
+		return
+	}
+
+	schedule, err := focus.LoadSchedule(r.Context(), tx, scheduleID)
+	if err != nil {
+		writeError(w, "failed to create schedule", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to create schedule", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, schedule)
+}
+
+// Update replaces a schedule's rule. Occurrences that haven't started are
+// rescheduled; skipped ones stay skipped. enabled is left alone if omitted.
+func (h *ScheduleHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scheduleID, ok := h.ownedSchedule(w, r, userID)
+	if !ok {
+		return
+	}
+	rec, enabled, ok := h.parseSchedule(w, r, userID)
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	args := append([]interface{}{scheduleID, enabled}, rec.Args()...)
+	_, err = tx.Exec(r.Context(),
+		`UPDATE focus_schedules
+		 SET enabled = COALESCE($2, enabled), name = $3, days = $4, start_minute = $5, end_minute = $6,
+		     timezone = $7, updated_at = NOW()
+		 WHERE id = $1`,
+		args...,
+	)
+	if err != nil {
+		writeError(w, "failed to update schedule", http.StatusInternalServerError)
+		return
+	}
+
+	if err := focus.ResetSchedule(r.Context(), tx, scheduleID, time.Now()); err != nil {
+		writeError(w, "failed to update schedule", http.StatusInternalServerError)
+		return
+	}
+
+	schedule, err := focus.LoadSchedule(r.Context(), tx, scheduleID)
+	if err != nil {
+		writeError(w, "failed to update schedule", http.StatusInternalServerError)
+		return
+	}
+
+	// Block rules scoped to the schedule follow its new times
+	versions, err := bumpBlockRulesVersion(r.Context(), tx, nil, userID)
+	if err != nil {
+		writeError(w, "failed to update schedule", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to update schedule", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
+
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+// Delete removes a schedule and its occurrences that haven't started. A
+// session already started from it keeps running. Block rules scoped to the
+// schedule are switched off and become always-on rules the user can re-enable.
+func (h *ScheduleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scheduleID, ok := h.ownedSchedule(w, r, userID)
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	_, err = tx.Exec(r.Context(),
+		`DELETE FROM scheduled_focus_blocks WHERE schedule_id = $1 AND status <> 'started'`,
+		scheduleID,
+	)
+	if err != nil {
+		writeError(w, "failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+	rules, err := tx.Exec(r.Context(),
+		`UPDATE block_rules SET active_when = 'always', schedule_id = NULL, enabled = FALSE
+		 WHERE schedule_id = $1`,
+		scheduleID,
+	)
+	if err != nil {
+		writeError(w, "failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+	var versions map[uuid.UUID]int64
+	if rules.RowsAffected() > 0 {
+		if versions, err = bumpBlockRulesVersion(r.Context(), tx, nil, userID); err != nil {
+			writeError(w, "failed to delete schedule", http.StatusInternalServerError)
+			return
+		}
+	}
+	_, err = tx.Exec(r.Context(),
+		`DELETE FROM focus_schedules WHERE id = $1`,
+		scheduleID,
+	)
+	if err != nil {
+		writeError(w, "failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Skip skips a single occurrence, given by its date in the schedule's time zone
+func (h *ScheduleHandler) Skip(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scheduleID, ok := h.ownedSchedule(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var req model.SkipOccurrenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.changeOccurrence(w, r, userID, scheduleID, func(tx pgx.Tx) error {
+		return focus.SkipOccurrence(r.Context(), tx, scheduleID, req.Date, time.Now())
+	})
+}
+
+// Unskip restores a skipped occurrence that isn't over yet
+func (h *ScheduleHandler) Unskip(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scheduleID, ok := h.ownedSchedule(w, r, userID)
+	if !ok {
+		return
+	}
+
+	h.changeOccurrence(w, r, userID, scheduleID, func(tx pgx.Tx) error {
+		found, err := focus.UnskipOccurrence(r.Context(), tx, scheduleID, chi.URLParam(r, "date"))
+		if err == nil && !found {
+			return pgx.ErrNoRows
+		}
+		return err
+	})
+}
+
+// changeOccurrence runs change in a transaction and responds with the
+// updated schedule. Clients are told to refetch, since block rules scoped to
+// the schedule follow its occurrences.
+func (h *ScheduleHandler) changeOccurrence(w http.ResponseWriter, r *http.Request, userID, scheduleID uuid.UUID, change func(pgx.Tx) error) {
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var occurrenceErr focus.OccurrenceError
+	err = change(tx)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		writeError(w, "no skipped occurrence on that date", http.StatusNotFound)
+		return
+	case errors.Is(err, focus.ErrOccurrenceStarted):
+		writeError(w, err.Error(), http.StatusConflict)
+		return
+	case errors.As(err, &occurrenceErr):
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		writeError(w, "failed to update occurrence", http.StatusInternalServerError)
+		return
+	}
+
+	schedule, err := focus.LoadSchedule(r.Context(), tx, scheduleID)
+	if err != nil {
+		writeError(w, "failed to update occurrence", http.StatusInternalServerError)
+		return
+	}
+
+	versions, err := bumpBlockRulesVersion(r.Context(), tx, nil, userID)
+	if err != nil {
+		writeError(w, "failed to update occurrence", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to update occurrence", http.StatusInternalServerError)
+		return
+	}
+
+	broadcastBlockRulesChanged(h.hub, versions)
+
+	writeJSON(w, http.StatusOK, schedule)
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Security event types recorded in security_events
+const (
+	securityEventRefreshTokenReuse = "refresh_token_reuse"
+)
+
+// recordSecurityEvent writes an audit row for a security-relevant event. Failures
+// are logged rather than surfaced, since the triggering request has already been handled.
+func recordSecurityEvent(ctx context.Context, db *pgxpool.Pool, r *http.Request, userID *uuid.UUID, eventType string, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+
+	log.Printf("Security event: %s user=%v ip=%s details=%v", eventType, userID, clientIP(r), details)
+
+	_, err := db.Exec(ctx,
+		`INSERT INTO security_events (user_id, type, ip, user_agent, details)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		userID, eventType, clientIP(r), r.UserAgent(), details,
+	)
+	if err != nil {
+		log.Printf("Failed to record security event %s: %v", eventType, err)
+	}
+}
@@ -1,25 +1,56 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"wakeup/api/internal/blocking"
+	"wakeup/api/internal/database"
+	"wakeup/api/internal/focus"
 	"wakeup/api/internal/middleware"
 	"wakeup/api/internal/model"
+	"wakeup/api/internal/ws"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type SessionHandler struct {
-	db *pgxpool.Pool
+	db    *pgxpool.Pool
+	hub   *ws.Hub
+	goals *focus.GoalTracker
 }
 
-func NewSessionHandler(db *pgxpool.Pool) *SessionHandler {
-	return &SessionHandler{db: db}
+func NewSessionHandler(db *pgxpool.Pool, hub *ws.Hub, goals *focus.GoalTracker) *SessionHandler {
+	return &SessionHandler{db: db, hub: hub, goals: goals}
 }
 
+// errRoomSessionPaused rejects pausing a session that shares a room's timer
+var errRoomSessionPaused = errors.New("sessions in a focus room can't be paused")
+
+// broadcastPhase keeps the user's other clients, and the rest of the session's
+// focus room, in step with a session change
+func (h *SessionHandler) broadcastPhase(ctx context.Context, session model.FocusSession, previousPhase string) {
+	if h.hub != nil {
+		h.hub.Broadcast([]uuid.UUID{session.UserID}, focus.PhaseChangedEvent(session, previousPhase))
+	}
+	if session.RoomID != nil {
+		focus.BroadcastRoom(ctx, h.db, h.hub, *session.RoomID)
+	}
+}
+
+// StartSession starts an open-ended session, or a timed/pomodoro one when the
+// body carries a preset or focus length. The scheduler ends or advances timed
+// sessions when their phase runs out.
 func (h *SessionHandler) StartSession(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok {
@@ -27,16 +58,53 @@ func (h *SessionHandler) StartSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user already has an active session
+	// The body is optional; older clients start sessions without one
+	var req model.StartSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := focus.PlanFromRequest(req)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	meta, err := focus.MetadataFromRequest(req)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.BlockMode == "" {
+		req.BlockMode = blocking.ModeBlocklist
+	}
+	if !blocking.ValidMode(req.BlockMode) {
+		writeError(w, "block_mode must be blocklist or allowlist", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin(r.Context())
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// Serialize with SyncSessions, which trims uploads against the running session
+	if _, err := tx.Exec(r.Context(), `SELECT 1 FROM profiles WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Check if user already has a running or paused session
 	var existingSession model.FocusSession
-	err := h.db.QueryRow(r.Context(),
-		`SELECT id, user_id, started_at, ended_at, status, created_at
+	err = focus.ScanSession(tx.QueryRow(r.Context(),
+		`SELECT `+focus.SessionColumns+`
 		 FROM focus_sessions
-		 WHERE user_id = $1 AND status = 'active'
+		 WHERE user_id = $1 AND status IN ('active', 'paused')
 		 LIMIT 1`,
 		userID,
-	).Scan(&existingSession.ID, &existingSession.UserID, &existingSession.StartedAt,
-		&existingSession.EndedAt, &existingSession.Status, &existingSession.CreatedAt)
+	), &existingSession)
 
 	if err == nil {
 		// Return existing active session
@@ -45,48 +113,289 @@ func (h *SessionHandler) StartSession(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create new session
-	var session model.FocusSession
-	err = h.db.QueryRow(r.Context(),
-		`INSERT INTO focus_sessions (user_id, status)
-		 VALUES ($1, 'active')
-		 RETURNING id, user_id, started_at, ended_at, status, created_at`,
-		userID,
-	).Scan(&session.ID, &session.UserID, &session.StartedAt, &session.EndedAt, &session.Status, &session.CreatedAt)
+	now := time.Now()
+	var phaseEndsAt *time.Time
+	if plan.FocusSeconds > 0 {
+		t := now.Add(time.Duration(plan.FocusSeconds) * time.Second)
+		phaseEndsAt = &t
+	}
+
+	var sessionID uuid.UUID
+	args := append([]interface{}{userID, now, phaseEndsAt}, plan.Args()...)
+	args = append(args, meta.Args()...)
+	args = append(args, req.BlockMode)
+	err = tx.QueryRow(r.Context(),
+		`INSERT INTO focus_sessions (user_id, status, started_at, phase_started_at, phase_ends_at,
+		     mode, focus_seconds, short_break_seconds, long_break_seconds, long_break_every, cycles,
+		     label, notes, tags, task_url, block_mode)
+		 VALUES ($1, 'active', $2, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		 RETURNING id`,
+		args...,
+	).Scan(&sessionID)
+	if database.IsUniqueViolation(err) {
+		// Started elsewhere since the lookup, e.g. by a room or a scheduled block
+		writeError(w, "a focus session is already running", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
 
+	if err := focus.OpenInterval(r.Context(), tx, sessionID, focus.PhaseFocus, now); err != nil {
+		writeError(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	var session model.FocusSession
+	err = focus.ScanSession(tx.QueryRow(r.Context(),
+		`SELECT `+focus.SessionColumns+` FROM focus_sessions WHERE id = $1`,
+		sessionID,
+	), &session)
 	if err != nil {
 		writeError(w, "failed to create session", http.StatusInternalServerError)
 		return
 	}
 
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	h.broadcastPhase(r.Context(), session, "")
 	writeJSON(w, http.StatusCreated, session)
 }
 
+// StopSession completes the running or paused session
 func (h *SessionHandler) StopSession(w http.ResponseWriter, r *http.Request) {
+	h.endSession(w, r, "completed")
+}
+
+// CancelSession abandons the running or paused session. Canceled sessions are
+// kept for history but don't count towards stats.
+func (h *SessionHandler) CancelSession(w http.ResponseWriter, r *http.Request) {
+	h.endSession(w, r, "canceled")
+}
+
+func (h *SessionHandler) endSession(w http.ResponseWriter, r *http.Request, status string) {
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok {
 		writeError(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Find and stop active session
-	var session model.FocusSession
-	now := time.Now()
-	err := h.db.QueryRow(r.Context(),
-		`UPDATE focus_sessions
-		 SET ended_at = $1, status = 'completed'
-		 WHERE user_id = $2 AND status = 'active'
-		 RETURNING id, user_id, started_at, ended_at, status, created_at`,
-		now, userID,
-	).Scan(&session.ID, &session.UserID, &session.StartedAt, &session.EndedAt, &session.Status, &session.CreatedAt)
+	h.updateCurrentSession(w, r, userID, []string{"active", "paused"},
+		func(tx pgx.Tx, sessionID uuid.UUID, now time.Time) error {
+			if err := focus.CloseInterval(r.Context(), tx, sessionID, now); err != nil {
+				return err
+			}
+			var roomID *uuid.UUID
+			err := tx.QueryRow(r.Context(),
+				`UPDATE focus_sessions
+				 SET ended_at = $2, status = $3, phase_ends_at = NULL, phase_remaining_seconds = NULL
+				 WHERE id = $1
+				 RETURNING room_id`,
+				sessionID, now, status,
+			).Scan(&roomID)
+			if err != nil || roomID == nil {
+				return err
+			}
+			return focus.SettleRoom(r.Context(), tx, *roomID)
+		},
+	)
+}
 
+// PauseSession freezes the running session's timer; paused time doesn't count
+// as focus time
+func (h *SessionHandler) PauseSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.updateCurrentSession(w, r, userID, []string{"active"},
+		func(tx pgx.Tx, sessionID uuid.UUID, now time.Time) error {
+			var inRoom bool
+			err := tx.QueryRow(r.Context(),
+				`SELECT room_id IS NOT NULL FROM focus_sessions WHERE id = $1`,
+				sessionID,
+			).Scan(&inRoom)
+			if err != nil {
+				return err
+			}
+			if inRoom {
+				return errRoomSessionPaused
+			}
+
+			if err := focus.CloseInterval(r.Context(), tx, sessionID, now); err != nil {
+				return err
+			}
+			_, err = tx.Exec(r.Context(),
+				`UPDATE focus_sessions
+				 SET status = 'paused',
+				     phase_remaining_seconds = CASE WHEN phase_ends_at IS NOT NULL
+				         THEN GREATEST(0, CEIL(EXTRACT(EPOCH FROM phase_ends_at - $2)))::int
+				     END,
+				     phase_ends_at = NULL
+				 WHERE id = $1`,
+				sessionID, now,
+			)
+			return err
+		},
+	)
+}
+
+// ResumeSession restarts a paused session's timer where it left off
+func (h *SessionHandler) ResumeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.updateCurrentSession(w, r, userID, []string{"paused"},
+		func(tx pgx.Tx, sessionID uuid.UUID, now time.Time) error {
+			var phase string
+			err := tx.QueryRow(r.Context(),
+				`UPDATE focus_sessions
+				 SET status = 'active',
+				     phase_ends_at = $2 + make_interval(secs => phase_remaining_seconds), -- stays NULL for open sessions
+				     phase_remaining_seconds = NULL
+				 WHERE id = $1
+				 RETURNING phase`,
+				sessionID, now,
+			).Scan(&phase)
+			if err != nil {
+				return err
+			}
+			return focus.OpenInterval(r.Context(), tx, sessionID, phase, now)
+		},
+	)
+}
+
+// updateCurrentSession locks the user's current session, which must be in one
+// of fromStatuses, applies update and responds with (and broadcasts) the result
+func (h *SessionHandler) updateCurrentSession(w http.ResponseWriter, r *http.Request, userID uuid.UUID, fromStatuses []string,
+	update func(tx pgx.Tx, sessionID uuid.UUID, now time.Time) error) {
+	tx, err := h.db.Begin(r.Context())
 	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var sessionID uuid.UUID
+	var status string
+	err = tx.QueryRow(r.Context(),
+		`SELECT id, status FROM focus_sessions
+		 WHERE user_id = $1 AND status IN ('active', 'paused')
+		 LIMIT 1
+		 FOR UPDATE`,
+		userID,
+	).Scan(&sessionID, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
 		writeError(w, "no active session found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if !slices.Contains(fromStatuses, status) {
+		writeError(w, "session is "+status, http.StatusConflict)
+		return
+	}
+
+	if err := update(tx, sessionID, time.Now()); err != nil {
+		if errors.Is(err, errRoomSessionPaused) {
+			writeError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeError(w, "failed to update session", http.StatusInternalServerError)
+		return
+	}
+
+	var session model.FocusSession
+	err = focus.ScanSession(tx.QueryRow(r.Context(),
+		`SELECT `+focus.SessionColumns+` FROM focus_sessions WHERE id = $1`,
+		sessionID,
+	), &session)
+	if err != nil {
+		writeError(w, "failed to update session", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeError(w, "failed to update session", http.StatusInternalServerError)
+		return
+	}
 
+	h.broadcastPhase(r.Context(), session, session.Phase)
+	h.goals.Evaluate(r.Context(), userID)
 	writeJSON(w, http.StatusOK, session)
 }
 
+// UpdateSession edits the label, notes, tags or task link of any of the
+// user's sessions, running or finished
+func (h *SessionHandler) UpdateSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+
+	var req model.UpdateSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var session model.FocusSession
+	err = focus.ScanSession(h.db.QueryRow(r.Context(),
+		`SELECT `+focus.SessionColumns+` FROM focus_sessions WHERE id = $1 AND user_id = $2`,
+		sessionID, userID,
+	), &session)
+	if err != nil {
+		writeError(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	current := focus.Metadata{Label: session.Label, Notes: session.Notes, Tags: session.Tags, TaskURL: session.TaskURL}
+	meta, err := current.Apply(req)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	args := append([]interface{}{sessionID}, meta.Args()...)
+	err = focus.ScanSession(h.db.QueryRow(r.Context(),
+		`UPDATE focus_sessions
+		 SET label = $2, notes = $3, tags = $4, task_url = $5
+		 WHERE id = $1
+		 RETURNING `+focus.SessionColumns,
+		args...,
+	), &session)
+	if err != nil {
+		writeError(w, "failed to update session", http.StatusInternalServerError)
+		return
+	}
+
+	if session.Status == "active" || session.Status == "paused" {
+		h.broadcastPhase(r.Context(), session, session.Phase)
+	}
+	writeJSON(w, http.StatusOK, session)
+}
+
+// ListSessions returns the user's sessions, newest first. They can be narrowed
+// down with ?tag=, ?room_id=, ?label=, ?status= and a ?from=/?to= range
+// (RFC 3339) on the start time.
 func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok {
@@ -102,14 +411,61 @@ func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	rows, err := h.db.Query(r.Context(),
-		`SELECT id, user_id, started_at, ended_at, status, created_at
-		 FROM focus_sessions
-		 WHERE user_id = $1
-		 ORDER BY created_at DESC
-		 LIMIT $2`,
-		userID, limit,
-	)
+	query := `SELECT ` + focus.SessionColumns + `
+	          FROM focus_sessions
+	          WHERE user_id = $1`
+	args := []interface{}{userID}
+	argIdx := 2
+
+	q := r.URL.Query()
+	if tag := q.Get("tag"); tag != "" {
+		query += ` AND tags @> ARRAY[$` + strconv.Itoa(argIdx) + `]::text[]`
+		args = append(args, strings.ToLower(strings.TrimSpace(tag)))
+		argIdx++
+	}
+	if room := q.Get("room_id"); room != "" {
+		roomID, err := uuid.Parse(room)
+		if err != nil {
+			writeError(w, "invalid room id", http.StatusBadRequest)
+			return
+		}
+		query += ` AND room_id = $` + strconv.Itoa(argIdx)
+		args = append(args, roomID)
+		argIdx++
+	}
+	if label := q.Get("label"); label != "" {
+		query += ` AND label = $` + strconv.Itoa(argIdx)
+		args = append(args, strings.TrimSpace(label))
+		argIdx++
+	}
+	if status := q.Get("status"); status != "" {
+		if !slices.Contains([]string{"active", "paused", "completed", "canceled"}, status) {
+			writeError(w, "invalid status", http.StatusBadRequest)
+			return
+		}
+		query += ` AND status = $` + strconv.Itoa(argIdx)
+		args = append(args, status)
+		argIdx++
+	}
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		v := q.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, "invalid "+bound.param+" time", http.StatusBadRequest)
+			return
+		}
+		query += ` AND started_at ` + bound.op + ` $` + strconv.Itoa(argIdx)
+		args = append(args, t)
+		argIdx++
+	}
+
+	query += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(argIdx)
+	args = append(args, limit)
+
+	rows, err := h.db.Query(r.Context(), query, args...)
 	if err != nil {
 		writeError(w, "failed to fetch sessions", http.StatusInternalServerError)
 		return
@@ -119,7 +475,7 @@ func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
 	sessions := []model.FocusSession{}
 	for rows.Next() {
 		var s model.FocusSession
-		if err := rows.Scan(&s.ID, &s.UserID, &s.StartedAt, &s.EndedAt, &s.Status, &s.CreatedAt); err != nil {
+		if err := focus.ScanSession(rows, &s); err != nil {
 			writeError(w, "failed to scan session", http.StatusInternalServerError)
 			return
 		}
@@ -137,13 +493,13 @@ func (h *SessionHandler) GetActiveSession(w http.ResponseWriter, r *http.Request
 	}
 
 	var session model.FocusSession
-	err := h.db.QueryRow(r.Context(),
-		`SELECT id, user_id, started_at, ended_at, status, created_at
+	err := focus.ScanSession(h.db.QueryRow(r.Context(),
+		`SELECT `+focus.SessionColumns+`
 		 FROM focus_sessions
-		 WHERE user_id = $1 AND status = 'active'
+		 WHERE user_id = $1 AND status IN ('active', 'paused')
 		 LIMIT 1`,
 		userID,
-	).Scan(&session.ID, &session.UserID, &session.StartedAt, &session.EndedAt, &session.Status, &session.CreatedAt)
+	), &session)
 
 	if err != nil {
 		// No active session - return null
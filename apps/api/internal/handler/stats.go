@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// focusTimeSQL yields one row per focus-phase interval of the user's
+// non-canceled sessions, with its start in local time ($2 is the time zone).
+// Pauses and breaks are separate intervals, so summing secs gives net focus time.
+const focusTimeSQL = `
+	SELECT i.session_id,
+	       i.started_at AT TIME ZONE $2 AS local_start,
+	       EXTRACT(EPOCH FROM COALESCE(i.ended_at, NOW()) - i.started_at) AS secs
+	FROM session_intervals i
+	JOIN focus_sessions s ON s.id = i.session_id
+	WHERE s.user_id = $1 AND s.status <> 'canceled' AND i.phase = 'focus'`
+
+// Number of buckets returned for each series
+const (
+	statsDays   = 30
+	statsWeeks  = 12
+	statsMonths = 12
+)
+
+// Stats aggregates focus time into totals, streaks, day/week/month series and
+// a per-tag breakdown.
+// Days are counted in the user's time zone, or the one given with ?tz=.
+func (h *SessionHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	stats := model.FocusStats{Timezone: r.URL.Query().Get("tz")}
+	if stats.Timezone != "" {
+		if _, err := time.LoadLocation(stats.Timezone); err != nil || stats.Timezone == "Local" {
+			writeError(w, "invalid timezone", http.StatusBadRequest)
+			return
+		}
+	} else {
+		err := h.db.QueryRow(r.Context(),
+			`SELECT timezone FROM profiles WHERE id = $1`,
+			userID,
+		).Scan(&stats.Timezone)
+		if err != nil {
+			writeError(w, "user not found", http.StatusNotFound)
+			return
+		}
+	}
+	ctx := r.Context()
+
+	err := h.db.QueryRow(ctx,
+		`WITH f AS (`+focusTimeSQL+`)
+		 SELECT
+		     COALESCE(SUM(secs) FILTER (WHERE local_start >= date_trunc('day', NOW() AT TIME ZONE $2)), 0)::bigint,
+		     COALESCE(SUM(secs) FILTER (WHERE local_start >= date_trunc('week', NOW() AT TIME ZONE $2)), 0)::bigint,
+		     COALESCE(SUM(secs) FILTER (WHERE local_start >= date_trunc('month', NOW() AT TIME ZONE $2)), 0)::bigint,
+		     COALESCE(SUM(secs), 0)::bigint
+		 FROM f`,
+		userID, stats.Timezone,
+	).Scan(&stats.TodaySeconds, &stats.WeekSeconds, &stats.MonthSeconds, &stats.TotalSeconds)
+	if err != nil {
+		writeError(w, "failed to compute stats", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.db.QueryRow(ctx,
+		`SELECT COUNT(*), COALESCE(AVG(focused), 0)::bigint
+		 FROM (
+		     SELECT SUM(secs) AS focused
+		     FROM (`+focusTimeSQL+`) f
+		     JOIN focus_sessions s ON s.id = f.session_id AND s.status = 'completed'
+		     GROUP BY f.session_id
+		 ) per_session`,
+		userID, stats.Timezone,
+	).Scan(&stats.CompletedSessions, &stats.AverageSessionSeconds)
+	if err != nil {
+		writeError(w, "failed to compute stats", http.StatusInternalServerError)
+		return
+	}
+
+	// Streaks are runs of consecutive local days with any focus time. Subtracting
+	// the row number from each day maps every run onto a single group date.
+	err = h.db.QueryRow(ctx,
+		`WITH days AS (
+		     SELECT DISTINCT local_start::date AS day FROM (`+focusTimeSQL+`) f
+		 ), runs AS (
+		     SELECT MAX(day) AS last_day, COUNT(*) AS length
+		     FROM (SELECT day, day - (ROW_NUMBER() OVER (ORDER BY day))::int AS grp FROM days) numbered
+		     GROUP BY grp
+		 )
+		 SELECT
+		     COALESCE(MAX(length) FILTER (WHERE last_day >= (NOW() AT TIME ZONE $2)::date - 1), 0),
+		     COALESCE(MAX(length), 0)
+		 FROM runs`,
+		userID, stats.Timezone,
+	).Scan(&stats.CurrentStreakDays, &stats.LongestStreakDays)
+	if err != nil {
+		writeError(w, "failed to compute stats", http.StatusInternalServerError)
+		return
+	}
+
+	series := []struct {
+		unit    string
+		count   int
+		buckets *[]model.FocusStatsBucket
+	}{
+		{"day", statsDays, &stats.Daily},
+		{"week", statsWeeks, &stats.Weekly},
+		{"month", statsMonths, &stats.Monthly},
+	}
+	for _, s := range series {
+		buckets, err := h.focusSeries(ctx, userID, stats.Timezone, s.unit, s.count)
+		if err != nil {
+			writeError(w, "failed to compute stats", http.StatusInternalServerError)
+			return
+		}
+		*s.buckets = buckets
+	}
+
+	stats.Tags, err = h.focusByTag(ctx, userID, stats.Timezone)
+	if err != nil {
+		writeError(w, "failed to compute stats", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// focusByTag totals focus time per session tag, most time first
+func (h *SessionHandler) focusByTag(ctx context.Context, userID uuid.UUID, tz string) ([]model.FocusTagStats, error) {
+	rows, err := h.db.Query(ctx,
+		`SELECT tag, COALESCE(SUM(f.secs), 0)::bigint, COUNT(DISTINCT f.session_id)
+		 FROM (`+focusTimeSQL+`) f
+		 JOIN focus_sessions s ON s.id = f.session_id
+		 CROSS JOIN LATERAL unnest(s.tags) AS tag
+		 GROUP BY tag
+		 ORDER BY 2 DESC, tag`,
+		userID, tz,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []model.FocusTagStats{}
+	for rows.Next() {
+		var t model.FocusTagStats
+		if err := rows.Scan(&t.Tag, &t.FocusedSeconds, &t.Sessions); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// focusSeries returns the last count day/week/month buckets up to the current
+// one, including empty ones, oldest first. Weeks start on Monday.
+func (h *SessionHandler) focusSeries(ctx context.Context, userID uuid.UUID, tz, unit string, count int) ([]model.FocusStatsBucket, error) {
+	rows, err := h.db.Query(ctx,
+		`WITH f AS (`+focusTimeSQL+`),
+		 current AS (
+		     SELECT date_trunc($3, NOW() AT TIME ZONE $2) AS bucket
+		 ),
+		 buckets AS (
+		     SELECT generate_series(
+		         current.bucket - ($4::int - 1) * ('1 ' || $3)::interval,
+		         current.bucket,
+		         ('1 ' || $3)::interval
+		     ) AS bucket
+		     FROM current
+		 )
+		 SELECT b.bucket::date, COALESCE(SUM(f.secs), 0)::bigint, COUNT(DISTINCT f.session_id)
+		 FROM buckets b
+		 LEFT JOIN f ON date_trunc($3, f.local_start) = b.bucket
+		 GROUP BY b.bucket
+		 ORDER BY b.bucket`,
+		userID, tz, unit, count,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []model.FocusStatsBucket{}
+	for rows.Next() {
+		var start time.Time
+		var b model.FocusStatsBucket
+		if err := rows.Scan(&start, &b.FocusedSeconds, &b.Sessions); err != nil {
+			return nil, err
+		}
+		b.Start = start.Format("2006-01-02")
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
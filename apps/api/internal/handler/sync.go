@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"wakeup/api/internal/focus"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// SyncSessions stores sessions that a client recorded while offline. Each one
+// is reported back individually:
+//   - duplicate: its client_id was synced before; the stored session is returned
+//   - trimmed: it ran into the user's active session and was cut off where that
+//     session started
+//   - conflict: it started during the active session, or overlaps a completed
+//     session; nothing is stored
+//   - invalid: the upload itself is malformed; nothing is stored
+func (h *SessionHandler) SyncSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.SyncSessionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Sessions) == 0 {
+		writeError(w, "no sessions to sync", http.StatusBadRequest)
+		return
+	}
+	if len(req.Sessions) > focus.MaxSyncBatch {
+		writeError(w, "too many sessions in one batch", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize the user's syncs so overlap checks see each other's sessions
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM profiles WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	var activeID *uuid.UUID
+	var activeStart time.Time
+	err = tx.QueryRow(ctx,
+		`SELECT id, started_at FROM focus_sessions
+		 WHERE user_id = $1 AND status IN ('active', 'paused')
+		 LIMIT 1
+		 FOR UPDATE`,
+		userID,
+	).Scan(&activeID, &activeStart)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	results := make([]model.SyncResult, 0, len(req.Sessions))
+	var earliest *time.Time
+	for _, item := range req.Sessions {
+		result, err := h.syncSession(ctx, tx, userID, item, activeID, activeStart, now)
+		if err != nil {
+			writeError(w, "failed to sync sessions", http.StatusInternalServerError)
+			return
+		}
+		if result.Status == "created" || result.Status == "trimmed" {
+			if earliest == nil || item.StartedAt.Before(*earliest) {
+				earliest = &item.StartedAt
+			}
+		}
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		writeError(w, "failed to sync sessions", http.StatusInternalServerError)
+		return
+	}
+
+	if earliest != nil {
+		if err := h.goals.Recompute(ctx, userID, *earliest); err != nil {
+			log.Printf("Failed to recompute goals for %s: %v", userID, err)
+		}
+		h.goals.Evaluate(ctx, userID)
+	}
+
+	writeJSON(w, http.StatusOK, model.SyncSessionsResponse{Results: results})
+}
+
+// syncSession stores one uploaded session. Only database failures are
+// returned as errors; everything else is reported in the result.
+func (h *SessionHandler) syncSession(ctx context.Context, tx pgx.Tx, userID uuid.UUID, item model.SyncSession,
+	activeID *uuid.UUID, activeStart time.Time, now time.Time) (model.SyncResult, error) {
+	result := model.SyncResult{ClientID: item.ClientID}
+	if item.ClientID == uuid.Nil {
+		result.Status = "invalid"
+		result.Error = "client_id is required"
+		return result, nil
+	}
+
+	var existing model.FocusSession
+	err := focus.ScanSession(tx.QueryRow(ctx,
+		`SELECT `+focus.SessionColumns+` FROM focus_sessions WHERE user_id = $1 AND client_id = $2`,
+		userID, item.ClientID,
+	), &existing)
+	if err == nil {
+		result.Status = "duplicate"
+		result.Session = &existing
+		return result, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return result, err
+	}
+
+	intervals, err := focus.SyncIntervals(item, now)
+	var meta focus.Metadata
+	if err == nil {
+		meta, err = focus.MetadataFromRequest(model.StartSessionRequest{
+			Label: item.Label, Notes: item.Notes, Tags: item.Tags, TaskURL: item.TaskURL,
+		})
+	}
+	if err != nil {
+		result.Status = "invalid"
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	// The server's running session wins: an offline session that started
+	// before it keeps only the part up to its start
+	result.Status = "created"
+	endedAt := item.EndedAt
+	if activeID != nil && endedAt.After(activeStart) {
+		if !item.StartedAt.Before(activeStart) {
+			result.Status = "conflict"
+			result.ConflictSessionID = activeID
+			result.Error = "overlaps the active session"
+			return result, nil
+		}
+		intervals = focus.ClipIntervals(intervals, activeStart)
+		endedAt = activeStart
+		result.Status = "trimmed"
+	}
+
+	var overlapID uuid.UUID
+	err = tx.QueryRow(ctx,
+		`SELECT id FROM focus_sessions
+		 WHERE user_id = $1 AND status = 'completed' AND started_at < $3 AND ended_at > $2
+		 ORDER BY started_at
+		 LIMIT 1`,
+		userID, item.StartedAt, endedAt,
+	).Scan(&overlapID)
+	if err == nil {
+		result.Status = "conflict"
+		result.ConflictSessionID = &overlapID
+		result.Error = "overlaps another session"
+		return result, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return result, err
+	}
+
+	status := item.Status
+	if status == "" {
+		status = "completed"
+	}
+	phase, phaseStartedAt := focus.PhaseFocus, item.StartedAt
+	if len(intervals) > 0 {
+		last := intervals[len(intervals)-1]
+		phase, phaseStartedAt = last.Phase, last.StartedAt
+	}
+
+	var sessionID uuid.UUID
+	args := append([]interface{}{userID, item.ClientID, status, item.StartedAt, endedAt, phase, phaseStartedAt}, meta.Args()...)
+	err = tx.QueryRow(ctx,
+		`INSERT INTO focus_sessions (user_id, client_id, status, started_at, ended_at, phase, phase_started_at,
+		     label, notes, tags, task_url, synced_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+		 RETURNING id`,
+		args...,
+	).Scan(&sessionID)
+	if err != nil {
+		return result, err
+	}
+
+	for _, i := range intervals {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO session_intervals (session_id, phase, started_at, ended_at) VALUES ($1, $2, $3, $4)`,
+			sessionID, i.Phase, i.StartedAt, i.EndedAt,
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	var session model.FocusSession
+	err = focus.ScanSession(tx.QueryRow(ctx,
+		`SELECT `+focus.SessionColumns+` FROM focus_sessions WHERE id = $1`,
+		sessionID,
+	), &session)
+	if err != nil {
+		return result, err
+	}
+	result.Session = &session
+	return result, nil
+}
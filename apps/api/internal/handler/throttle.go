@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"wakeup/api/internal/ratelimit"
+
+	"github.com/google/uuid"
+)
+
+// Throttle key namespaces; the Postgres limiter stores every key in one table
+const (
+	throttleLoginIP       = "login:ip:"
+	throttleLoginAccount  = "login:account:"
+	throttleExtensionCode = "extension:ip:"
+)
+
+// Security event types for credential failures
+const (
+	securityEventLoginFailed     = "login_failed"
+	securityEventLoginThrottled  = "login_throttled"
+	securityEventExtensionFailed = "extension_code_failed"
+)
+
+// loginBlocked writes a 429 and returns true when the client IP or the account is
+// currently backing off. Limiter errors fail open so a database hiccup doesn't lock
+// everyone out.
+func (h *AuthHandler) loginBlocked(w http.ResponseWriter, r *http.Request, email string) bool {
+	wait := h.throttleWait(r, h.limits.ByIP, throttleLoginIP+clientIP(r))
+	if email != "" {
+		if accountWait := h.throttleWait(r, h.limits.ByAccount, throttleLoginAccount+email); accountWait > wait {
+			wait = accountWait
+		}
+	}
+	if wait == 0 {
+		return false
+	}
+
+	recordSecurityEvent(r.Context(), h.db, r, nil, securityEventLoginThrottled, map[string]interface{}{
+		"email":               email,
+		"retry_after_seconds": retryAfterSeconds(wait),
+	})
+	writeTooManyAttempts(w, wait)
+	return true
+}
+
+// recordLoginFailure counts a failed credential check against the IP and the account
+// and writes it to the audit log
+func (h *AuthHandler) recordLoginFailure(r *http.Request, userID *uuid.UUID, email, reason string) {
+	ipWait := h.throttleFail(r, h.limits.ByIP, throttleLoginIP+clientIP(r))
+	var accountWait time.Duration
+	if email != "" {
+		accountWait = h.throttleFail(r, h.limits.ByAccount, throttleLoginAccount+email)
+	}
+
+	recordSecurityEvent(r.Context(), h.db, r, userID, securityEventLoginFailed, map[string]interface{}{
+		"email":                       email,
+		"reason":                      reason,
+		"ip_retry_after_seconds":      retryAfterSeconds(ipWait),
+		"account_retry_after_seconds": retryAfterSeconds(accountWait),
+	})
+}
+
+// resetLoginFailures clears an account's failures after a successful login. The IP
+// counter is left alone so one good login can't launder guesses against other accounts.
+func (h *AuthHandler) resetLoginFailures(r *http.Request, email string) {
+	if err := h.limits.ByAccount.Reset(r.Context(), throttleLoginAccount+email); err != nil {
+		log.Printf("Failed to reset login throttle for %s: %v", email, err)
+	}
+}
+
+func (h *AuthHandler) throttleWait(r *http.Request, limiter ratelimit.Limiter, key string) time.Duration {
+	wait, err := limiter.Allow(r.Context(), key)
+	if err != nil {
+		log.Printf("Rate limiter check failed for %s: %v", key, err)
+		return 0
+	}
+	return wait
+}
+
+func (h *AuthHandler) throttleFail(r *http.Request, limiter ratelimit.Limiter, key string) time.Duration {
+	wait, err := limiter.Fail(r.Context(), key)
+	if err != nil {
+		log.Printf("Rate limiter update failed for %s: %v", key, err)
+		return 0
+	}
+	return wait
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(retryAfterSeconds(wait)))
+	writeError(w, "too many attempts, try again later", http.StatusTooManyRequests)
+}
+
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"wakeup/api/internal/auth"
+	"wakeup/api/internal/mail"
+	"wakeup/api/internal/middleware"
+	"wakeup/api/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Verification token purposes stored in verification_tokens
+const (
+	purposeEmailVerification = "email_verification"
+	purposePasswordReset     = "password_reset"
+)
+
+const (
+	emailVerificationExpiry = 24 * time.Hour
+	passwordResetExpiry     = time.Hour
+	minPasswordLength       = 8
+	maxPasswordBytes        = 72 // bcrypt ignores anything longer
+)
+
+// validatePassword checks a new password against the password policy
+func validatePassword(password string) error {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+	return nil
+}
+
+// requireVerifiedEmail writes 403 and returns false unless userID has verified
+// their email. Reaching other users needs a proven address, so throwaway
+// sign-ups can't send friend requests or messages.
+func requireVerifiedEmail(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, userID uuid.UUID) bool {
+	var verified bool
+	err := db.QueryRow(r.Context(),
+		`SELECT email_verified_at IS NOT NULL FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&verified)
+	if err != nil {
+		writeError(w, "failed to check email verification", http.StatusInternalServerError)
+		return false
+	}
+	if !verified {
+		writeError(w, "verify your email address first", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// VerifyEmail marks the profile's email as verified using the token from the verification link
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req model.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" {
+		writeError(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, email, err := h.consumeVerificationToken(r.Context(), req.Token, purposeEmailVerification)
+	if err != nil {
+		writeError(w, "invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	// The token only proves ownership of the address it was sent to
+	result, err := h.db.Exec(r.Context(),
+		`UPDATE profiles SET email_verified_at = NOW(), updated_at = NOW()
+		 WHERE id = $1 AND email = $2`,
+		userID, email,
+	)
+	if err != nil {
+		writeError(w, "failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		writeError(w, "email has changed since this link was sent", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification sends a fresh verification link to the current user
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var email string
+	var verifiedAt *time.Time
+	err := h.db.QueryRow(r.Context(),
+		`SELECT email, email_verified_at FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&email, &verifiedAt)
+	if err != nil {
+		writeError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	if verifiedAt != nil {
+		writeError(w, "email already verified", http.StatusConflict)
+		return
+	}
+
+	if err := h.sendVerificationEmail(r.Context(), userID, email); err != nil {
+		writeError(w, "failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ForgotPassword emails a password reset link. It responds the same way whether or
+// not the address is registered so it can't be used to enumerate accounts.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if req.Email == "" {
+		writeError(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	var userID uuid.UUID
+	err := h.db.QueryRow(r.Context(),
+		`SELECT id FROM profiles WHERE email = $1`,
+		req.Email,
+	).Scan(&userID)
+	if err != nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// Only the most recent reset link should work
+	_, err = h.db.Exec(r.Context(),
+		`UPDATE verification_tokens SET used_at = NOW()
+		 WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, purposePasswordReset,
+	)
+	if err != nil {
+		writeError(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := h.issueVerificationToken(r.Context(), userID, req.Email, purposePasswordReset, passwordResetExpiry)
+	if err != nil {
+		writeError(w, "failed to create reset token", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.mailer.Send(r.Context(), mail.Message{
+		To:      req.Email,
+		Subject: "Reset your Wakeup password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Wakeup account.\n\n"+
+			"Choose a new password here (the link expires in 1 hour):\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.\n",
+			h.appLink("/reset-password", token)),
+	})
+	if err != nil {
+		log.Printf("Failed to send password reset email to %s: %v", req.Email, err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password using a reset token and signs out every session
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		writeError(w, "token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePassword(req.Password); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		writeError(w, "failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	userID, email, err := h.consumeVerificationToken(r.Context(), req.Token, purposePasswordReset)
+	if err != nil {
+		writeError(w, "invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	// Receiving the reset link also proves ownership of the address
+	result, err := h.db.Exec(r.Context(),
+		`UPDATE profiles
+		 SET password_hash = $1, email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		 WHERE id = $2 AND email = $3`,
+		passwordHash, userID, email,
+	)
+	if err != nil {
+		writeError(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected() == 0 {
+		writeError(w, "email has changed since this link was sent", http.StatusBadRequest)
+		return
+	}
+
+	// Sign out everywhere: whoever knew the old password may hold a session
+	rows, err := h.db.Query(r.Context(),
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND revoked_at IS NULL
+		 RETURNING session_id`,
+		userID,
+	)
+	if err != nil {
+		writeError(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	var sessionIDs []uuid.UUID
+	for rows.Next() {
+		var sessionID uuid.UUID
+		if err := rows.Scan(&sessionID); err == nil {
+			sessionIDs = append(sessionIDs, sessionID)
+		}
+	}
+	rows.Close()
+
+	if h.hub != nil {
+		for _, sessionID := range sessionIDs {
+			h.hub.DisconnectSessions(userID, []uuid.UUID{sessionID}, sessionRevokedEvent(sessionID))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword replaces the password of a signed-in user who knows the current
+// one, and signs out every other session
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req model.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		writeError(w, "current_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePassword(req.NewPassword); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash string
+	err := h.db.QueryRow(r.Context(),
+		`SELECT password_hash FROM profiles WHERE id = $1`,
+		userID,
+	).Scan(&passwordHash)
+	if err != nil {
+		writeError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	if !auth.CheckPassword(req.CurrentPassword, passwordHash) {
+		writeError(w, "invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	newHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		writeError(w, "failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.db.Exec(r.Context(),
+		`UPDATE profiles SET password_hash = $1, updated_at = NOW() WHERE id = $2`,
+		newHash, userID,
+	)
+	if err != nil {
+		writeError(w, "failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the session that changed the password, sign out the rest
+	currentID, _ := middleware.GetSessionID(r.Context())
+	rows, err := h.db.Query(r.Context(),
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		 WHERE user_id = $1 AND session_id <> $2 AND revoked_at IS NULL
+		 RETURNING session_id`,
+		userID, currentID,
+	)
+	if err != nil {
+		writeError(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	var sessionIDs []uuid.UUID
+	for rows.Next() {
+		var sessionID uuid.UUID
+		if err := rows.Scan(&sessionID); err == nil {
+			sessionIDs = append(sessionIDs, sessionID)
+		}
+	}
+	rows.Close()
+
+	if h.hub != nil {
+		for _, sessionID := range sessionIDs {
+			h.hub.DisconnectSessions(userID, []uuid.UUID{sessionID}, sessionRevokedEvent(sessionID))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendVerificationEmail issues a verification token for email and mails the link
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := h.issueVerificationToken(ctx, userID, email, purposeEmailVerification, emailVerificationExpiry)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Verify your Wakeup email",
+		Body: fmt.Sprintf("Welcome to Wakeup!\n\n"+
+			"Confirm your email address by opening this link (it expires in 24 hours):\n%s\n",
+			h.appLink("/verify-email", token)),
+	})
+}
+
+// issueVerificationToken stores a hashed single-use token and returns the raw value
+func (h *AuthHandler) issueVerificationToken(ctx context.Context, userID uuid.UUID, email, purpose string, expiry time.Duration) (string, error) {
+	token, err := auth.GenerateRefreshToken() // Reuse the random token generator
+	if err != nil {
+		return "", err
+	}
+
+	_, err = h.db.Exec(ctx,
+		`INSERT INTO verification_tokens (user_id, purpose, token_hash, email, expires_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		userID, purpose, auth.HashRefreshToken(token), email, time.Now().Add(expiry),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeVerificationToken atomically marks a token used and returns who it was issued to
+func (h *AuthHandler) consumeVerificationToken(ctx context.Context, token, purpose string) (uuid.UUID, string, error) {
+	var userID uuid.UUID
+	var email string
+	err := h.db.QueryRow(ctx,
+		`UPDATE verification_tokens SET used_at = NOW()
+		 WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		 RETURNING user_id, email`,
+		auth.HashRefreshToken(token), purpose,
+	).Scan(&userID, &email)
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, "", auth.ErrInvalidToken
+	}
+	return userID, email, err
+}
+
+// appLink builds a link into the web app carrying a token
+func (h *AuthHandler) appLink(path, token string) string {
+	return strings.TrimRight(h.cfg.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,381 @@
+// Package ical reads and writes the subset of iCalendar (RFC 5545) needed to
+// exchange focus blocks with calendar apps: VEVENTs with a start, an end or
+// duration, a summary and a description.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a single VEVENT
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool // DTSTART was a DATE rather than a DATE-TIME
+	Recurring   bool // the event has an RRULE; only its first occurrence is read
+	Canceled    bool // STATUS:CANCELLED
+	// Problems that didn't stop the event from being read, e.g. a time zone
+	// that had to be guessed
+	Warnings []string
+}
+
+// Calendar is a VCALENDAR to be written out
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+const (
+	dateTimeUTC = "20060102T150405Z"
+	dateTime    = "20060102T150405"
+	date        = "20060102"
+
+	maxLineOctets = 75
+)
+
+// property is one content line: NAME;PARAM=VALUE:value
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads the VEVENTs in an iCalendar stream. Times without a zone
+// ("floating" times) are read in loc, and so are times in a zone that is
+// neither a known IANA name nor described by the file's VTIMEZONEs, with a
+// warning on the event. Components nested in an event, such as VALARMs, are
+// skipped. Events that can't be understood are returned as errors rather than
+// skipped, naming the offending line.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	zones := timezones(lines)
+
+	var events []Event
+	var current *Event
+	var duration time.Duration
+	hasEnd := false
+	depth := 0 // components open inside the current event
+	for n, line := range lines {
+		if line == "" {
+			continue
+		}
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		switch {
+		case current != nil && prop.name == "BEGIN":
+			depth++
+		case current != nil && prop.name == "END" && depth > 0:
+			depth--
+		case depth > 0:
+			// Properties of a nested component, e.g. a VALARM's DESCRIPTION
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			current = &Event{}
+			duration, hasEnd = 0, false
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT"):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN", n+1)
+			}
+			if current.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event without DTSTART", n+1)
+			}
+			if !hasEnd {
+				switch {
+				case duration > 0:
+					current.End = current.Start.Add(duration)
+				case current.AllDay:
+					current.End = current.Start.AddDate(0, 0, 1)
+				default:
+					current.End = current.Start
+				}
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			// Calendar-level properties and other components are ignored
+		case prop.name == "UID":
+			current.UID = prop.value
+		case prop.name == "SUMMARY":
+			current.Summary = unescape(prop.value)
+		case prop.name == "DESCRIPTION":
+			current.Description = unescape(prop.value)
+		case prop.name == "STATUS":
+			current.Canceled = strings.EqualFold(prop.value, "CANCELLED")
+		case prop.name == "RRULE":
+			current.Recurring = true
+		case prop.name == "DTSTART":
+			t, allDay, err := parseTime(prop, current, zones, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			current.Start, current.AllDay = t, allDay
+		case prop.name == "DTEND":
+			t, _, err := parseTime(prop, current, zones, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			current.End, hasEnd = t, true
+		case prop.name == "DURATION":
+			d, err := parseDuration(prop.value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			duration = d
+		}
+	}
+	return events, nil
+}
+
+// timezones reads the file's VTIMEZONEs into locations by TZID. A zone is
+// only usable when it names its IANA zone in X-LIC-LOCATION, or has a single
+// fixed offset; anything with daylight saving rules is left out.
+func timezones(lines []string) map[string]*time.Location {
+	zones := map[string]*time.Location{}
+
+	var tzid, location string
+	var offsets []string
+	inZone, daylight := false, false
+	for _, line := range lines {
+		prop, err := parseLine(line)
+		if err != nil {
+			continue
+		}
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VTIMEZONE"):
+			inZone = true
+			tzid, location, offsets, daylight = "", "", nil, false
+		case !inZone:
+		case prop.name == "END" && strings.EqualFold(prop.value, "VTIMEZONE"):
+			inZone = false
+			if tzid == "" {
+				continue
+			}
+			if tz, err := time.LoadLocation(location); location != "" && err == nil {
+				zones[tzid] = tz
+			} else if offset, ok := fixedOffset(offsets); ok && !daylight {
+				zones[tzid] = time.FixedZone(tzid, offset)
+			}
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "DAYLIGHT"):
+			daylight = true
+		case prop.name == "TZID":
+			tzid = prop.value
+		case prop.name == "X-LIC-LOCATION":
+			location = prop.value
+		case prop.name == "TZOFFSETTO":
+			offsets = append(offsets, prop.value)
+		}
+	}
+	return zones
+}
+
+// fixedOffset reads UTC offsets such as +0530, returning the offset in
+// seconds when they are all the same
+func fixedOffset(offsets []string) (int, bool) {
+	if len(offsets) == 0 {
+		return 0, false
+	}
+	for _, o := range offsets[1:] {
+		if o != offsets[0] {
+			return 0, false
+		}
+	}
+	o := offsets[0]
+	if len(o) != 5 && len(o) != 7 || (o[0] != '+' && o[0] != '-') {
+		return 0, false
+	}
+	hours, err1 := strconv.Atoi(o[1:3])
+	minutes, err2 := strconv.Atoi(o[3:5])
+	seconds := 0
+	var err3 error
+	if len(o) == 7 {
+		seconds, err3 = strconv.Atoi(o[5:7])
+	}
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	offset := hours*3600 + minutes*60 + seconds
+	if o[0] == '-' {
+		offset = -offset
+	}
+	return offset, true
+}
+
+// unfold joins continuation lines (those starting with a space or tab) onto
+// the line before them
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func parseLine(line string) (property, error) {
+	// The value starts at the first colon outside a quoted parameter value
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, errors.New("malformed content line")
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	prop := property{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return property{}, errors.New("malformed parameter")
+		}
+		prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// parseTime reads a DATE or DATE-TIME. A TZID that can't be resolved falls
+// back to loc and adds a warning to e.
+func parseTime(prop property, e *Event, zones map[string]*time.Location, loc *time.Location) (time.Time, bool, error) {
+	if strings.EqualFold(prop.params["VALUE"], "DATE") || len(prop.value) == len(date) {
+		t, err := time.ParseInLocation(date, prop.value, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s", prop.name)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(prop.value, "Z") {
+		t, err := time.Parse(dateTimeUTC, prop.value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s", prop.name)
+		}
+		return t, false, nil
+	}
+
+	if tzid := prop.params["TZID"]; tzid != "" {
+		if tz, err := time.LoadLocation(tzid); err == nil {
+			loc = tz
+		} else if tz, ok := zones[tzid]; ok {
+			loc = tz
+		} else {
+			e.Warnings = append(e.Warnings, fmt.Sprintf("unknown time zone %q, %s read in %s", tzid, prop.name, loc))
+		}
+	}
+	t, err := time.ParseInLocation(dateTime, prop.value, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s", prop.name)
+	}
+	return t, false, nil
+}
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration reads an RFC 5545 duration such as PT1H30M or P1D
+func parseDuration(value string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(value)
+	if m == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, errors.New("invalid DURATION")
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, errors.New("invalid DURATION")
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+var unescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`, "\r", "")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// Write renders cal as an iCalendar stream
+func Write(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+	stamp := time.Now().UTC().Format(dateTimeUTC)
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:-//Wakeup//Focus//EN")
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	if cal.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escape(cal.Name))
+	}
+	for _, e := range cal.Events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+e.UID)
+		writeLine(bw, "DTSTAMP:"+stamp)
+		writeLine(bw, "DTSTART:"+e.Start.UTC().Format(dateTimeUTC))
+		writeLine(bw, "DTEND:"+e.End.UTC().Format(dateTimeUTC))
+		writeLine(bw, "SUMMARY:"+escape(e.Summary))
+		if e.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escape(e.Description))
+		}
+		writeLine(bw, "END:VEVENT")
+	}
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+// writeLine writes a CRLF-terminated content line, folded so no line is
+// longer than 75 octets and no UTF-8 sequence is split
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1 // the leading space counts
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
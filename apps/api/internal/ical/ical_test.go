@@ -0,0 +1,252 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// calendar joins content lines with CRLF, wrapped in a VCALENDAR
+func calendar(lines ...string) string {
+	return strings.Join(append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...), "END:VCALENDAR"), "\r\n") + "\r\n"
+}
+
+func TestParse(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []Event
+	}{
+		{
+			name:  "utc times",
+			input: calendar("BEGIN:VEVENT", "UID:a@example.com", "SUMMARY:Write", "DTSTART:20261020T080000Z", "DTEND:20261020T093000Z", "END:VEVENT"),
+			want:  []Event{{UID: "a@example.com", Summary: "Write", Start: utc(10, 20, 8, 0), End: utc(10, 20, 9, 30)}},
+		},
+		{
+			name:  "floating times use loc",
+			input: calendar("BEGIN:VEVENT", "DTSTART:20261020T100000", "DURATION:PT45M", "END:VEVENT"),
+			want:  []Event{{Start: utc(10, 20, 8, 0), End: utc(10, 20, 8, 45)}},
+		},
+		{
+			name:  "tzid",
+			input: calendar("BEGIN:VEVENT", "DTSTART;TZID=America/New_York:20261020T090000", "DTEND;TZID=America/New_York:20261020T100000", "END:VEVENT"),
+			want:  []Event{{Start: utc(10, 20, 13, 0), End: utc(10, 20, 14, 0)}},
+		},
+		{
+			name: "vtimezone with an IANA location",
+			input: calendar(
+				"BEGIN:VTIMEZONE", "TZID:W. Europe Standard Time", "X-LIC-LOCATION:Europe/Berlin",
+				"BEGIN:STANDARD", "TZOFFSETTO:+0100", "END:STANDARD", "BEGIN:DAYLIGHT", "TZOFFSETTO:+0200", "END:DAYLIGHT",
+				"END:VTIMEZONE",
+				"BEGIN:VEVENT", `DTSTART;TZID="W. Europe Standard Time":20260701T090000`, "DURATION:PT1H", "END:VEVENT",
+			),
+			want: []Event{{Start: utc(7, 1, 7, 0), End: utc(7, 1, 8, 0)}},
+		},
+		{
+			name: "vtimezone with a fixed offset",
+			input: calendar(
+				"BEGIN:VEVENT", "DTSTART;TZID=India Standard Time:20261020T090000", "DURATION:PT1H", "END:VEVENT",
+				"BEGIN:VTIMEZONE", "TZID:India Standard Time", "BEGIN:STANDARD", "TZOFFSETTO:+0530", "END:STANDARD", "END:VTIMEZONE",
+			),
+			want: []Event{{Start: utc(10, 20, 3, 30), End: utc(10, 20, 4, 30)}},
+		},
+		{
+			name:  "unknown tzid falls back with a warning",
+			input: calendar("BEGIN:VEVENT", "DTSTART;TZID=Pacific Standard Time:20261020T100000", "DURATION:PT1H", "END:VEVENT"),
+			want: []Event{{
+				Start: utc(10, 20, 8, 0), End: utc(10, 20, 9, 0),
+				Warnings: []string{`unknown time zone "Pacific Standard Time", DTSTART read in Europe/Berlin`},
+			}},
+		},
+		{
+			name:  "all day",
+			input: calendar("BEGIN:VEVENT", "DTSTART;VALUE=DATE:20261020", "END:VEVENT"),
+			want:  []Event{{Start: time.Date(2026, 10, 20, 0, 0, 0, 0, berlin), End: time.Date(2026, 10, 21, 0, 0, 0, 0, berlin), AllDay: true}},
+		},
+		{
+			name: "alarm properties are ignored",
+			input: calendar(
+				"BEGIN:VEVENT", "SUMMARY:Standup", "DTSTART:20261020T080000Z", "DTEND:20261020T081500Z",
+				"BEGIN:VALARM", "ACTION:DISPLAY", "DESCRIPTION:Reminder", "TRIGGER:-PT10M", "DURATION:PT5M", "END:VALARM",
+				"STATUS:CONFIRMED", "END:VEVENT",
+			),
+			want: []Event{{Summary: "Standup", Start: utc(10, 20, 8, 0), End: utc(10, 20, 8, 15)}},
+		},
+		{
+			name:  "recurring and canceled",
+			input: calendar("BEGIN:VEVENT", "DTSTART:20261020T080000Z", "RRULE:FREQ=DAILY", "STATUS:CANCELLED", "END:VEVENT"),
+			want:  []Event{{Start: utc(10, 20, 8, 0), End: utc(10, 20, 8, 0), Recurring: true, Canceled: true}},
+		},
+		{
+			name:  "folded and escaped text",
+			input: calendar("BEGIN:VEVENT", `SUMMARY:Deep work\, part`, " two", `DESCRIPTION:line one\nline two\; more`, "DTSTART:20261020T080000Z", "END:VEVENT"),
+			want:  []Event{{Summary: "Deep work, parttwo", Description: "line one\nline two; more", Start: utc(10, 20, 8, 0), End: utc(10, 20, 8, 0)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input), berlin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !eventsEqual(got[i], tt.want[i]) {
+					t.Errorf("event %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func eventsEqual(a, b Event) bool {
+	return a.UID == b.UID && a.Summary == b.Summary && a.Description == b.Description &&
+		a.Start.Equal(b.Start) && a.End.Equal(b.End) &&
+		a.AllDay == b.AllDay && a.Recurring == b.Recurring && a.Canceled == b.Canceled &&
+		strings.Join(a.Warnings, "|") == strings.Join(b.Warnings, "|")
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"end without begin", calendar("END:VEVENT")},
+		{"no dtstart", calendar("BEGIN:VEVENT", "SUMMARY:x", "END:VEVENT")},
+		{"bad dtstart", calendar("BEGIN:VEVENT", "DTSTART:tomorrow", "END:VEVENT")},
+		{"bad duration", calendar("BEGIN:VEVENT", "DTSTART:20261020T080000Z", "DURATION:1 hour", "END:VEVENT")},
+		{"malformed line", calendar("BEGIN:VEVENT", "DTSTART 20261020T080000Z", "END:VEVENT")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.input), time.UTC); err == nil {
+				t.Error("Parse succeeded")
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"PT1H30M", 90 * time.Minute, false},
+		{"P1D", 24 * time.Hour, false},
+		{"P1W", 7 * 24 * time.Hour, false},
+		{"P1DT2H", 26 * time.Hour, false},
+		{"PT45S", 45 * time.Second, false},
+		{"-PT15M", -15 * time.Minute, false},
+		{"P", 0, true},
+		{"PT", 0, true},
+		{"1H", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteLineFolding(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:Focus"},
+		{"exactly 75", "SUMMARY:" + strings.Repeat("a", 67)},
+		{"long ascii", "DESCRIPTION:" + strings.Repeat("abcdefghij", 30)},
+		{"multibyte", "SUMMARY:" + strings.Repeat("日本語のテキスト", 20)},
+		{"emoji", "SUMMARY:" + strings.Repeat("🎯 ", 60)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			writeLine(w, tt.line)
+			w.Flush()
+
+			out := buf.String()
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("line not CRLF-terminated: %q", out)
+			}
+			lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			for i, l := range lines {
+				if len(l) > maxLineOctets {
+					t.Errorf("line %d is %d octets", i, len(l))
+				}
+				if i > 0 && !strings.HasPrefix(l, " ") {
+					t.Errorf("continuation line %d doesn't start with a space", i)
+				}
+				if !utf8.ValidString(l) {
+					t.Errorf("line %d splits a UTF-8 sequence", i)
+				}
+			}
+
+			unfolded, err := unfold(strings.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(unfolded) != 1 || unfolded[0] != tt.line {
+				t.Errorf("unfolded = %q, want %q", unfolded, tt.line)
+			}
+		})
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	cal := Calendar{
+		Name: "Focus; blocks",
+		Events: []Event{
+			{
+				UID:         "block-1@wakeup",
+				Summary:     "Write the, report; " + strings.Repeat("long title ", 10),
+				Description: "first line\nsecond line with a \\ backslash",
+				Start:       time.Date(2026, 10, 20, 8, 0, 0, 0, time.UTC),
+				End:         time.Date(2026, 10, 20, 9, 30, 0, 0, time.UTC),
+			},
+			{
+				UID:     "block-2@wakeup",
+				Summary: "Réunion 🎯",
+				Start:   time.Date(2026, 10, 21, 14, 0, 0, 0, time.FixedZone("CEST", 2*3600)),
+				End:     time.Date(2026, 10, 21, 15, 0, 0, 0, time.FixedZone("CEST", 2*3600)),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, cal); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `X-WR-CALNAME:Focus\; blocks`) {
+		t.Errorf("calendar name not escaped:\n%s", buf.String())
+	}
+
+	got, err := Parse(&buf, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(cal.Events) {
+		t.Fatalf("got %d events, want %d", len(got), len(cal.Events))
+	}
+	for i := range got {
+		if !eventsEqual(got[i], cal.Events[i]) {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], cal.Events[i])
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogMailer prints messages to the server log instead of delivering them. When dir
+// is set each message is also written there as an .eml file, which is handy for
+// clicking verification links in local dev.
+type LogMailer struct {
+	dir  string
+	from string
+}
+
+func NewLogMailer(dir, from string) *LogMailer {
+	return &LogMailer{dir: dir, from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+
+	if m.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail dir: %w", err)
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	if err := os.WriteFile(filepath.Join(m.dir, name), render(m.from, msg), 0o644); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"wakeup/api/internal/config"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email (verification links, password resets)
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Mailer selected by MAIL_DRIVER: "smtp" for real delivery,
+// anything else falls back to the log mailer used in local dev and tests.
+func New(cfg *config.Config) Mailer {
+	if cfg.MailDriver == "smtp" {
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
+	return NewLogMailer(cfg.MailDir, cfg.MailFrom)
+}
+
+// render builds an RFC 5322 message with the headers every driver needs
+func render(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPMailer sends mail through an SMTP relay
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+// Send delivers msg, authenticating with PLAIN when credentials are configured
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The envelope sender is the bare address; the display name only goes in the header
+	sender, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	if err := smtp.SendMail(m.addr, auth, sender.Address, []string{msg.To}, render(m.from, msg)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
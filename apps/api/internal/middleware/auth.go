@@ -8,13 +8,23 @@ import (
 	"wakeup/api/internal/auth"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "userID"
+const (
+	UserIDKey    contextKey = "userID"
+	SessionIDKey contextKey = "sessionID"
+	ScopesKey    contextKey = "scopes"
+)
 
-func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
+// AuthMiddleware accepts a Bearer access token (JWT) whose login session is still
+// active, so revoking a session locks its access tokens out before they expire, or
+// a personal access token. Requests made with a personal access token, or an
+// access token from a scoped session, carry the scopes in the context; see
+// RequireScope and RequireSession.
+func AuthMiddleware(keys *auth.KeySet, db *pgxpool.Pool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -29,7 +39,19 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
-			claims, err := auth.ValidateAccessToken(parts[1], jwtSecret)
+			if auth.IsAPIToken(parts[1]) {
+				userID, scopes, err := lookupAPIToken(r.Context(), db, parts[1])
+				if err != nil {
+					http.Error(w, `{"error":"invalid token"}`, http.StatusUnauthorized)
+					return
+				}
+				ctx := context.WithValue(r.Context(), UserIDKey, userID)
+				ctx = context.WithValue(ctx, ScopesKey, scopes)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			claims, err := auth.ValidateAccessToken(parts[1], keys)
 			if err != nil {
 				if err == auth.ErrExpiredToken {
 					http.Error(w, `{"error":"token expired"}`, http.StatusUnauthorized)
@@ -39,7 +61,21 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
+			active, err := SessionActive(r.Context(), db, claims.UserID, claims.SessionID)
+			if err != nil {
+				http.Error(w, `{"error":"failed to verify session"}`, http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				http.Error(w, `{"error":"session revoked"}`, http.StatusUnauthorized)
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+			if claims.Scopes != nil {
+				ctx = context.WithValue(ctx, ScopesKey, claims.Scopes)
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -49,3 +85,25 @@ func GetUserID(ctx context.Context) (uuid.UUID, bool) {
 	userID, ok := ctx.Value(UserIDKey).(uuid.UUID)
 	return userID, ok
 }
+
+// GetSessionID returns the login session the request's access token was issued for.
+// Tokens minted before sessions were tracked carry uuid.Nil.
+func GetSessionID(ctx context.Context) (uuid.UUID, bool) {
+	sessionID, ok := ctx.Value(SessionIDKey).(uuid.UUID)
+	return sessionID, ok && sessionID != uuid.Nil
+}
+
+// SessionActive reports whether a login session still holds a refresh token that
+// is neither revoked nor expired. Logging out, revoking the session and refresh
+// token reuse all revoke its tokens, which ends the session.
+func SessionActive(ctx context.Context, db *pgxpool.Pool, userID, sessionID uuid.UUID) (bool, error) {
+	var active bool
+	err := db.QueryRow(ctx,
+		`SELECT EXISTS(
+		     SELECT 1 FROM refresh_tokens
+		     WHERE user_id = $1 AND session_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+		 )`,
+		userID, sessionID,
+	).Scan(&active)
+	return active, err
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses proxy addresses and CIDR ranges, e.g.
+// "10.0.0.0/8" or "127.0.0.1"
+func ParseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// RealIP sets r.RemoteAddr to the client address. X-Forwarded-For is only
+// believed when the connection comes from a trusted proxy, and then only up to
+// the right-most hop that isn't one: anything left of it was written by the
+// client. With no trusted proxies the connection address is used as is.
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for _, prefix := range trusted {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(trusted) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			peer, ok := parseHost(r.RemoteAddr)
+			if !ok || !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := peer
+			hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop, ok := parseHost(strings.TrimSpace(hops[i]))
+				if !ok {
+					break
+				}
+				client = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+
+			r.RemoteAddr = client.Unmap().String()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parseHost parses an address with or without a port
+func parseHost(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	return addr, err == nil
+}
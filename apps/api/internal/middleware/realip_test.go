@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		trusted   bool
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"no trusted proxies", false, "203.0.113.9:4000", []string{"198.51.100.1"}, "203.0.113.9:4000"},
+		{"untrusted peer", true, "203.0.113.9:4000", []string{"198.51.100.1"}, "203.0.113.9:4000"},
+		{"trusted peer without header", true, "127.0.0.1:4000", nil, "127.0.0.1"},
+		{"one proxy", true, "127.0.0.1:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hops are skipped", true, "127.0.0.1:4000", []string{"1.2.3.4, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"repeated headers", true, "10.0.0.1:4000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"only proxies", true, "127.0.0.1:4000", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"garbage hop", true, "127.0.0.1:4000", []string{"198.51.100.1, nonsense"}, "127.0.0.1"},
+		{"ipv6", true, "127.0.0.1:4000", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies := trusted
+			if !tt.trusted {
+				proxies = nil
+			}
+			var got string
+			handler := RealIP(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		entries []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"10.0.0.0/8", "::1", "192.168.1.1"}, false},
+		{[]string{"10.0.0.0/33"}, true},
+		{[]string{"proxy.local"}, true},
+	}
+	for _, tt := range tests {
+		if _, err := ParseTrustedProxies(tt.entries); (err != nil) != tt.wantErr {
+			t.Errorf("ParseTrustedProxies(%v) error = %v, want error %v", tt.entries, err, tt.wantErr)
+		}
+	}
+}
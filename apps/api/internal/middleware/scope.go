@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"wakeup/api/internal/auth"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lookupAPIToken resolves a personal access token to its owner and scopes,
+// recording the use. Revoked and expired tokens are rejected.
+func lookupAPIToken(ctx context.Context, db *pgxpool.Pool, token string) (uuid.UUID, []string, error) {
+	var userID uuid.UUID
+	var scopes []string
+	err := db.QueryRow(ctx,
+		`UPDATE personal_access_tokens SET last_used_at = NOW()
+		 WHERE token_hash = $1 AND revoked_at IS NULL
+		   AND (expires_at IS NULL OR expires_at > NOW())
+		 RETURNING user_id, scopes`,
+		auth.HashRefreshToken(token),
+	).Scan(&userID, &scopes)
+	return userID, scopes, err
+}
+
+// GetScopes returns the scopes the request is limited to, for personal access
+// tokens and paired extensions. ok is false for regular login sessions.
+func GetScopes(ctx context.Context) (scopes []string, ok bool) {
+	scopes, ok = ctx.Value(ScopesKey).([]string)
+	return scopes, ok
+}
+
+// RequireScope lets scope-limited credentials through only if they were granted
+// scope. Regular login sessions always pass.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scopes, ok := GetScopes(r.Context()); ok && !slices.Contains(scopes, scope) {
+				http.Error(w, `{"error":"token is missing the `+scope+` scope"}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects scope-limited credentials, for routes that manage the
+// account itself and should need an interactive login.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := GetScopes(r.Context()); ok {
+			http.Error(w, `{"error":"this endpoint requires a full login session"}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -7,13 +7,17 @@ import (
 )
 
 type Profile struct {
-	ID           uuid.UUID  `json:"id"`
-	Email        string     `json:"email"`
-	PasswordHash string     `json:"-"`
-	DisplayName  string     `json:"display_name"`
-	AvatarURL    *string    `json:"avatar_url,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID                   uuid.UUID  `json:"id"`
+	Email                string     `json:"email"`
+	PasswordHash         string     `json:"-"`
+	DisplayName          string     `json:"display_name"`
+	AvatarURL            *string    `json:"avatar_url,omitempty"`
+	EmailVerifiedAt      *time.Time `json:"email_verified_at,omitempty"`      // only loaded for the current user
+	DeletionScheduledFor *time.Time `json:"deletion_scheduled_for,omitempty"` // set while account deletion is pending
+	Timezone             string     `json:"timezone,omitempty"`               // IANA name; only loaded for the current user
+	LeaderboardOptOut    *bool      `json:"leaderboard_opt_out,omitempty"`    // hidden from friends' leaderboards; only loaded for the current user
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
 }
 
 type RefreshToken struct {
@@ -47,12 +51,170 @@ type LogoutRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
 type AuthResponse struct {
 	AccessToken  string   `json:"access_token"`
 	RefreshToken string   `json:"refresh_token"`
 	User         *Profile `json:"user"`
 }
 
+// MFAChallengeResponse is returned by Login instead of tokens when the account has
+// two-factor authentication enabled
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TOTPCodeRequest struct {
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+type DisableTOTPRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// OAuth types
+type OAuthStartRequest struct {
+	RedirectURI string `json:"redirect_uri,omitempty"`
+}
+
+type OAuthStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+type OAuthExchangeRequest struct {
+	Code string `json:"code"`
+}
+
+type LinkedIdentity struct {
+	ID          uuid.UUID  `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       *string    `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+type LinkedIdentitiesResponse struct {
+	Identities []LinkedIdentity `json:"identities"`
+}
+
+// Account deletion and data export types
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type AccountDeletionResponse struct {
+	DeletionScheduledFor time.Time `json:"deletion_scheduled_for"`
+}
+
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	SizeBytes   *int64     `json:"size_bytes,omitempty"`
+	Error       *string    `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL *string    `json:"download_url,omitempty"`
+}
+
+// Personal access token types
+type APIToken struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expires_in_days,omitempty"` // omit for a token that never expires
+}
+
+type CreateAPITokenResponse struct {
+	APIToken
+	Token string `json:"token"` // only returned once
+}
+
+type APITokensResponse struct {
+	Tokens []APIToken `json:"tokens"`
+}
+
+// Extension pairing types
+type ExtensionCodeRequest struct {
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+type ExtensionCodeResponse struct {
+	Code      string `json:"code"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+type ExtensionExchangeRequest struct {
+	Code         string `json:"code"`
+	CodeVerifier string `json:"code_verifier"`
+	DeviceName   string `json:"device_name,omitempty"`
+}
+
+type ExtensionExchangeResponse struct {
+	AuthResponse
+	DeviceID uuid.UUID `json:"device_id"`
+}
+
+type ExtensionDevice struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	UserAgent  *string   `json:"user_agent,omitempty"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type ExtensionDevicesResponse struct {
+	Devices []ExtensionDevice `json:"devices"`
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -65,32 +227,451 @@ type FocusSession struct {
 	EndedAt   *time.Time `json:"ended_at,omitempty"`
 	Status    string     `json:"status"`
 	CreatedAt time.Time  `json:"created_at"`
+	// Timer plan; open sessions run until stopped and leave these empty
+	Mode              string     `json:"mode"`
+	FocusSeconds      *int       `json:"focus_seconds,omitempty"`
+	ShortBreakSeconds *int       `json:"short_break_seconds,omitempty"`
+	LongBreakSeconds  *int       `json:"long_break_seconds,omitempty"`
+	LongBreakEvery    *int       `json:"long_break_every,omitempty"`
+	Cycles            *int       `json:"cycles,omitempty"`
+	Phase             string     `json:"phase"`
+	CurrentCycle      int        `json:"current_cycle"`
+	PhaseStartedAt    time.Time  `json:"phase_started_at"`
+	PhaseEndsAt       *time.Time `json:"phase_ends_at,omitempty"`
+	// While paused the phase timer is frozen at this many seconds
+	PhaseRemainingSeconds *int `json:"phase_remaining_seconds,omitempty"`
+	// Time actually spent focusing: focus-phase intervals, excluding pauses and breaks
+	FocusedSeconds int `json:"focused_seconds"`
+	// What the session was spent on
+	Label   *string  `json:"label,omitempty"`
+	Notes   *string  `json:"notes,omitempty"`
+	Tags    []string `json:"tags"`
+	TaskURL *string  `json:"task_url,omitempty"`
+	// Set on sessions recorded offline and uploaded through the sync endpoint
+	ClientID *uuid.UUID `json:"client_id,omitempty"`
+	SyncedAt *time.Time `json:"synced_at,omitempty"`
+	RoomID   *uuid.UUID `json:"room_id,omitempty"` // focus room the session was run in
+	// How pages are blocked during focus phases: blocklist, or allowlist to
+	// block everything but allow rules
+	BlockMode string `json:"block_mode"`
+}
+
+type StartSessionRequest struct {
+	Preset            string `json:"preset,omitempty"` // see focus.Presets
+	FocusMinutes      *int   `json:"focus_minutes,omitempty"`
+	ShortBreakMinutes *int   `json:"short_break_minutes,omitempty"`
+	LongBreakMinutes  *int   `json:"long_break_minutes,omitempty"`
+	LongBreakEvery    *int   `json:"long_break_every,omitempty"`
+	Cycles            *int   `json:"cycles,omitempty"`
+	// Optional metadata, see UpdateSessionRequest
+	Label   string   `json:"label,omitempty"`
+	Notes   string   `json:"notes,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	TaskURL string   `json:"task_url,omitempty"`
+	// blocklist (default) or allowlist for deep focus
+	BlockMode string `json:"block_mode,omitempty"`
+}
+
+// SyncSessionsRequest uploads sessions a client recorded while offline
+type SyncSessionsRequest struct {
+	Sessions []SyncSession `json:"sessions"`
+}
+
+type SyncSession struct {
+	ClientID  uuid.UUID `json:"client_id"` // generated by the client; retries with the same id are no-ops
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Status    string    `json:"status,omitempty"` // completed (default) or canceled
+	// Timer phases in order; gaps between them are pauses. Without any, the
+	// whole session counts as focus time.
+	Intervals []SyncInterval `json:"intervals,omitempty"`
+	Label     string         `json:"label,omitempty"`
+	Notes     string         `json:"notes,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+	TaskURL   string         `json:"task_url,omitempty"`
+}
+
+type SyncInterval struct {
+	Phase     string    `json:"phase"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+}
+
+// SyncResult reports what happened to one uploaded session: created, trimmed
+// (created, but cut short where the server's active session began),
+// duplicate, conflict or invalid
+type SyncResult struct {
+	ClientID          uuid.UUID     `json:"client_id"`
+	Status            string        `json:"status"`
+	Session           *FocusSession `json:"session,omitempty"`
+	ConflictSessionID *uuid.UUID    `json:"conflict_session_id,omitempty"`
+	Error             string        `json:"error,omitempty"`
+}
+
+type SyncSessionsResponse struct {
+	Results []SyncResult `json:"results"`
+}
+
+// UpdateSessionRequest edits a session's metadata; omitted fields are left
+// alone and empty values clear them
+type UpdateSessionRequest struct {
+	Label   *string   `json:"label,omitempty"`
+	Notes   *string   `json:"notes,omitempty"`
+	Tags    *[]string `json:"tags,omitempty"`
+	TaskURL *string   `json:"task_url,omitempty"`
+}
+
+type FocusStatsBucket struct {
+	Start          string `json:"start"` // first day of the bucket, YYYY-MM-DD in the user's time zone
+	FocusedSeconds int64  `json:"focused_seconds"`
+	Sessions       int    `json:"sessions"`
+}
+
+type FocusStats struct {
+	Timezone              string             `json:"timezone"`
+	TodaySeconds          int64              `json:"today_seconds"`
+	WeekSeconds           int64              `json:"week_seconds"`
+	MonthSeconds          int64              `json:"month_seconds"`
+	TotalSeconds          int64              `json:"total_seconds"`
+	CompletedSessions     int                `json:"completed_sessions"`
+	AverageSessionSeconds int64              `json:"average_session_seconds"`
+	CurrentStreakDays     int                `json:"current_streak_days"`
+	LongestStreakDays     int                `json:"longest_streak_days"`
+	Daily                 []FocusStatsBucket `json:"daily"`
+	Weekly                []FocusStatsBucket `json:"weekly"`
+	Monthly               []FocusStatsBucket `json:"monthly"`
+	Tags                  []FocusTagStats    `json:"tags"`
+}
+
+// FocusTagStats is focus time spent on sessions carrying a tag; sessions with
+// several tags count towards each of them
+type FocusTagStats struct {
+	Tag            string `json:"tag"`
+	FocusedSeconds int64  `json:"focused_seconds"`
+	Sessions       int    `json:"sessions"`
+}
+
+// Focus goal types
+type FocusGoal struct {
+	ID        uuid.UUID     `json:"id"`
+	Period    string        `json:"period"` // daily or weekly
+	Metric    string        `json:"metric"` // minutes or sessions
+	Target    int           `json:"target"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Progress  *GoalProgress `json:"progress,omitempty"`
+}
+
+type GoalProgress struct {
+	PeriodStart string `json:"period_start"` // YYYY-MM-DD in the user's time zone
+	Achieved    int    `json:"achieved"`
+	Met         bool   `json:"met"`
+}
+
+type FocusGoalsResponse struct {
+	Goals []FocusGoal `json:"goals"`
+}
+
+type UpsertGoalRequest struct {
+	Period string `json:"period"`
+	Metric string `json:"metric"`
+	Target int    `json:"target"`
+}
+
+type GoalResult struct {
+	GoalID      uuid.UUID  `json:"goal_id"`
+	Period      string     `json:"period"`
+	Metric      string     `json:"metric"`
+	PeriodStart string     `json:"period_start"`
+	Target      int        `json:"target"`
+	Achieved    int        `json:"achieved"`
+	Met         bool       `json:"met"`
+	ReachedAt   *time.Time `json:"reached_at,omitempty"`
+	Final       bool       `json:"final"` // false while the period is still running
+}
+
+type GoalHistoryResponse struct {
+	Results []GoalResult `json:"results"`
+}
+
+type FocusPhaseChangedEvent struct {
+	Session       FocusSession `json:"session"`
+	PreviousPhase string       `json:"previous_phase,omitempty"`
 }
 
 type FocusSessionsResponse struct {
 	Sessions []FocusSession `json:"sessions"`
 }
 
+// Focus room types
+type FocusRoom struct {
+	ID                uuid.UUID              `json:"id"`
+	Name              string                 `json:"name"`
+	HostID            uuid.UUID              `json:"host_id"`
+	NestID            *uuid.UUID             `json:"nest_id,omitempty"` // shared with the nest rather than the host's friends
+	Status            string                 `json:"status"`            // waiting, running or ended
+	Mode              string                 `json:"mode"`
+	FocusSeconds      *int                   `json:"focus_seconds,omitempty"`
+	ShortBreakSeconds *int                   `json:"short_break_seconds,omitempty"`
+	LongBreakSeconds  *int                   `json:"long_break_seconds,omitempty"`
+	LongBreakEvery    *int                   `json:"long_break_every,omitempty"`
+	Cycles            *int                   `json:"cycles,omitempty"`
+	StartedAt         *time.Time             `json:"started_at,omitempty"`
+	EndedAt           *time.Time             `json:"ended_at,omitempty"`
+	CreatedAt         time.Time              `json:"created_at"`
+	Participants      []FocusRoomParticipant `json:"participants"`
+}
+
+// FocusRoomParticipant is a room member and the state of their room session,
+// which is empty until the room starts
+type FocusRoomParticipant struct {
+	UserID                uuid.UUID  `json:"user_id"`
+	DisplayName           string     `json:"display_name"`
+	JoinedAt              time.Time  `json:"joined_at"`
+	SessionID             *uuid.UUID `json:"session_id,omitempty"`
+	SessionStatus         *string    `json:"session_status,omitempty"`
+	Phase                 *string    `json:"phase,omitempty"`
+	CurrentCycle          *int       `json:"current_cycle,omitempty"`
+	PhaseEndsAt           *time.Time `json:"phase_ends_at,omitempty"`
+	PhaseRemainingSeconds *int       `json:"phase_remaining_seconds,omitempty"`
+}
+
+type FocusRoomsResponse struct {
+	Rooms []FocusRoom `json:"rooms"`
+}
+
+// CreateFocusRoomRequest takes the same timer settings as StartSessionRequest
+type CreateFocusRoomRequest struct {
+	Name              string     `json:"name"`
+	NestID            *uuid.UUID `json:"nest_id,omitempty"`
+	Preset            string     `json:"preset,omitempty"`
+	FocusMinutes      *int       `json:"focus_minutes,omitempty"`
+	ShortBreakMinutes *int       `json:"short_break_minutes,omitempty"`
+	LongBreakMinutes  *int       `json:"long_break_minutes,omitempty"`
+	LongBreakEvery    *int       `json:"long_break_every,omitempty"`
+	Cycles            *int       `json:"cycles,omitempty"`
+}
+
+// Scheduled focus block types
+type ScheduledBlock struct {
+	ID          uuid.UUID  `json:"id"`
+	Title       *string    `json:"title,omitempty"`
+	StartsAt    time.Time  `json:"starts_at"`
+	EndsAt      time.Time  `json:"ends_at"`
+	Source      string     `json:"source"` // manual, ics or schedule
+	ExternalUID *string    `json:"external_uid,omitempty"`
+	Status      string     `json:"status"`               // scheduled, started or skipped
+	SessionID   *uuid.UUID `json:"session_id,omitempty"` // the session the block was started as
+	// Set on blocks generated from a recurring schedule
+	ScheduleID     *uuid.UUID `json:"schedule_id,omitempty"`
+	OccurrenceDate *string    `json:"occurrence_date,omitempty"` // YYYY-MM-DD in the schedule's time zone
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type ScheduledBlocksResponse struct {
+	Blocks []ScheduledBlock `json:"blocks"`
+}
+
+type CreateScheduledBlockRequest struct {
+	Title    string    `json:"title,omitempty"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// ImportCalendarResponse counts what happened to the events of an imported
+// .ics file; re-importing a file updates the blocks it created before
+type ImportCalendarResponse struct {
+	Imported int      `json:"imported"`
+	Updated  int      `json:"updated"`
+	Skipped  int      `json:"skipped"`
+	Warnings []string `json:"warnings"`
+}
+
+// LeaderboardEntry is one person's focus time over a leaderboard's period
+type LeaderboardEntry struct {
+	Rank           int       `json:"rank"` // equal totals share a rank
+	UserID         uuid.UUID `json:"user_id"`
+	DisplayName    string    `json:"display_name"`
+	AvatarURL      *string   `json:"avatar_url,omitempty"`
+	FocusedSeconds int64     `json:"focused_seconds"`
+	IsMe           bool      `json:"is_me"`
+}
+
+type LeaderboardResponse struct {
+	Period      string             `json:"period"` // day, week or month
+	Scope       string             `json:"scope"`  // friends or nest
+	PeriodStart string             `json:"period_start"`
+	Timezone    string             `json:"timezone"`
+	RefreshedAt *time.Time         `json:"refreshed_at,omitempty"` // totals lag behind by up to a few minutes
+	Entries     []LeaderboardEntry `json:"entries"`
+}
+
+type CalendarFeedResponse struct {
+	URL string `json:"url"` // secret; anyone with it can read the feed
+}
+
+// FocusBlockEvent is sent when the scheduler starts or skips a block
+type FocusBlockEvent struct {
+	Block   ScheduledBlock `json:"block"`
+	Session *FocusSession  `json:"session,omitempty"` // only when started
+}
+
+// FocusSchedule is a recurring focus block, e.g. weekdays 09:00-11:00. Its
+// upcoming occurrences are kept as scheduled blocks.
+type FocusSchedule struct {
+	ID        uuid.UUID        `json:"id"`
+	Name      *string          `json:"name,omitempty"`
+	Days      []string         `json:"days"`       // MO, TU, WE, TH, FR, SA, SU
+	StartTime string           `json:"start_time"` // HH:MM local time
+	EndTime   string           `json:"end_time"`   // HH:MM; before start_time means the next day
+	Timezone  string           `json:"timezone"`
+	Enabled   bool             `json:"enabled"`
+	Upcoming  []ScheduledBlock `json:"upcoming"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+type FocusSchedulesResponse struct {
+	Schedules []FocusSchedule `json:"schedules"`
+}
+
+// UpsertScheduleRequest creates or replaces a schedule. The time zone
+// defaults to the user's.
+type UpsertScheduleRequest struct {
+	Name      string   `json:"name,omitempty"`
+	Days      []string `json:"days"`
+	StartTime string   `json:"start_time"`
+	EndTime   string   `json:"end_time"`
+	Timezone  string   `json:"timezone,omitempty"`
+	Enabled   *bool    `json:"enabled,omitempty"`
+}
+
+type SkipOccurrenceRequest struct {
+	Date string `json:"date"` // YYYY-MM-DD in the schedule's time zone
+}
+
 // Block Rule types
 type BlockRule struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Pattern   string    `json:"pattern"`
-	Enabled   bool      `json:"enabled"`
-	CreatedAt time.Time `json:"created_at"`
+	ID      uuid.UUID `json:"id"`
+	UserID  uuid.UUID `json:"user_id"`
+	Type    string    `json:"type"`    // see blocking.Types
+	Pattern string    `json:"pattern"` // normalized for its type
+	Action  string    `json:"action"`  // block, or allow to let matching pages through
+	Enabled bool      `json:"enabled"`
+	// When the rule applies: always, focus (while a session is in a focus
+	// phase), window (during Window) or schedule (during an occurrence of
+	// ScheduleID that wasn't skipped)
+	ActiveWhen string           `json:"active_when"`
+	Window     *BlockRuleWindow `json:"window,omitempty"`
+	ScheduleID *uuid.UUID       `json:"schedule_id,omitempty"` // cleared if the schedule is deleted
+	ListID     *uuid.UUID       `json:"list_id,omitempty"`     // block list the rule belongs to
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+// BlockRuleWindow is a time of day a rule applies on some days of the week
+type BlockRuleWindow struct {
+	Days      []string `json:"days"`               // MO..SU, WEEKDAYS, WEEKENDS or DAILY
+	StartTime string   `json:"start_time"`         // HH:MM
+	EndTime   string   `json:"end_time"`           // HH:MM; before start_time means the next day
+	Timezone  string   `json:"timezone,omitempty"` // defaults to the user's
 }
 
 type CreateBlockRuleRequest struct {
-	Pattern string `json:"pattern"`
+	Type       string           `json:"type,omitempty"` // inferred from the pattern when omitted
+	Pattern    string           `json:"pattern"`
+	Action     string           `json:"action,omitempty"`      // defaults to block
+	ActiveWhen string           `json:"active_when,omitempty"` // defaults to always
+	Window     *BlockRuleWindow `json:"window,omitempty"`
+	ScheduleID *uuid.UUID       `json:"schedule_id,omitempty"`
+	ListID     *uuid.UUID       `json:"list_id,omitempty"` // one of the user's own block lists
 }
 
+// UpdateBlockRuleRequest edits a rule; changing active_when needs the window
+// or schedule_id it depends on
 type UpdateBlockRuleRequest struct {
-	Pattern *string `json:"pattern,omitempty"`
-	Enabled *bool   `json:"enabled,omitempty"`
+	Type       *string          `json:"type,omitempty"`
+	Pattern    *string          `json:"pattern,omitempty"`
+	Action     *string          `json:"action,omitempty"`
+	Enabled    *bool            `json:"enabled,omitempty"`
+	ActiveWhen *string          `json:"active_when,omitempty"`
+	Window     *BlockRuleWindow `json:"window,omitempty"`
+	ScheduleID *uuid.UUID       `json:"schedule_id,omitempty"`
+}
+
+// EffectiveBlockRulesResponse is the rule set that applies right now. In
+// allowlist mode every page is blocked unless an allowlist rule matches it;
+// otherwise pages matching a rule are blocked unless an allowlist rule
+// matches too.
+type EffectiveBlockRulesResponse struct {
+	Mode         string      `json:"mode"`      // blocklist or allowlist
+	Rules        []BlockRule `json:"rules"`     // block rules
+	Allowlist    []BlockRule `json:"allowlist"` // allow rules
+	FocusActive  bool        `json:"focus_active"`
+	EvaluatedAt  time.Time   `json:"evaluated_at"`
+	NextChangeAt *time.Time  `json:"next_change_at,omitempty"` // next window or schedule boundary; focus changes arrive as events
 }
 
 type BlockRulesResponse struct {
-	Rules []BlockRule `json:"rules"`
+	Rules   []BlockRule `json:"rules"`
+	Version int64       `json:"version"` // the user's rule-set version, also sent as the ETag
+}
+
+// BlockRulesChangedEvent is sent to a user's clients when rules they follow
+// change, including through a block list. Version only ever increases.
+type BlockRulesChangedEvent struct {
+	Version int64 `json:"version"`
+}
+
+// TestBlockRulesRequest asks which of the user's enabled rules would block a page
+type TestBlockRulesRequest struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"` // needed for keyword rules
+}
+
+type TestBlockRulesResponse struct {
+	Mode    string      `json:"mode"`
+	Blocked bool        `json:"blocked"`
+	Rule    *BlockRule  `json:"rule,omitempty"` // the first matching block rule
+	Matches []BlockRule `json:"matches"`
+	Allowed []BlockRule `json:"allowed"` // matching allow rules, which let the page through
+}
+
+// BlockList is a named collection of block rules, toggled as a whole. Owners
+// can share it with their friends or publish it to nests, and others can
+// subscribe to it, following its rules as the owner edits them.
+type BlockList struct {
+	ID                uuid.UUID   `json:"id"`
+	OwnerID           uuid.UUID   `json:"owner_id"`
+	OwnerName         string      `json:"owner_name"`
+	Name              string      `json:"name"`
+	Description       *string     `json:"description,omitempty"`
+	Enabled           bool        `json:"enabled"`    // whether its rules apply to the user: the owner's toggle or the subscription's
+	Subscribed        bool        `json:"subscribed"` // the user follows someone else's list
+	SharedWithFriends bool        `json:"shared_with_friends"`
+	NestIDs           []uuid.UUID `json:"nest_ids"` // nests it's published to that the user can see
+	SubscriberCount   int         `json:"subscriber_count"`
+	Rules             []BlockRule `json:"rules"`
+	CreatedAt         time.Time   `json:"created_at"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+}
+
+type BlockListsResponse struct {
+	Lists []BlockList `json:"lists"`
+}
+
+type CreateBlockListRequest struct {
+	Name              string  `json:"name"`
+	Description       *string `json:"description,omitempty"`
+	SharedWithFriends bool    `json:"shared_with_friends,omitempty"`
+}
+
+// UpdateBlockListRequest edits a list. Subscribers can only change enabled,
+// which toggles their subscription.
+type UpdateBlockListRequest struct {
+	Name              *string `json:"name,omitempty"`
+	Description       *string `json:"description,omitempty"`
+	Enabled           *bool   `json:"enabled,omitempty"`
+	SharedWithFriends *bool   `json:"shared_with_friends,omitempty"`
 }
 
 // File types
@@ -131,4 +712,23 @@ type UpdateProfileRequest struct {
 	DisplayName *string `json:"display_name,omitempty"`
 	AvatarURL   *string `json:"avatar_url,omitempty"`
 	Email       *string `json:"email,omitempty"`
+	Timezone    *string `json:"timezone,omitempty"`
+	// Hide the user's focus time from friends' and nests' leaderboards
+	LeaderboardOptOut *bool `json:"leaderboard_opt_out,omitempty"`
+}
+
+// Login session types
+type LoginSession struct {
+	ID         uuid.UUID `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  *string   `json:"user_agent,omitempty"`
+	IP         *string   `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type LoginSessionsResponse struct {
+	Sessions []LoginSession `json:"sessions"`
 }
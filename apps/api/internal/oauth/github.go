@@ -0,0 +1,63 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewGitHubProvider configures GitHub, which speaks OAuth2 but not OIDC
+func NewGitHubProvider(clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name:          "github",
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		scopes:        []string{"read:user", "user:email"},
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		fetchIdentity: fetchGitHubIdentity,
+		authURL:       "https://github.com/login/oauth/authorize",
+		tokenURL:      "https://github.com/login/oauth/access_token",
+		userInfoURL:   "https://api.github.com/user",
+	}
+}
+
+func fetchGitHubIdentity(ctx context.Context, p *Provider, accessToken string) (*Identity, error) {
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := p.getJSON(ctx, p.userInfoURL, accessToken, &user); err != nil {
+		return nil, err
+	}
+
+	// The profile email may be empty or unverified; the emails API says which is primary and verified
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.getJSON(ctx, "https://api.github.com/user/emails", accessToken, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = strings.ToLower(e.Email)
+			identity.EmailVerified = e.Verified
+			break
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,248 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"wakeup/api/internal/config"
+)
+
+// Identity is what we learn about a user from a provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+}
+
+// Provider runs the OAuth2 authorization-code flow (with PKCE) against one identity
+// provider and maps its user info onto an Identity
+type Provider struct {
+	Name         string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+
+	// fetchIdentity reads the user's identity with an access token
+	fetchIdentity func(ctx context.Context, p *Provider, accessToken string) (*Identity, error)
+
+	// OIDC providers resolve their endpoints lazily from the issuer's discovery
+	// document, so a provider that is down at boot doesn't stop the API from starting
+	issuer      string
+	mu          sync.Mutex
+	authURL     string
+	tokenURL    string
+	userInfoURL string
+}
+
+// LoadProviders builds every provider that has credentials configured, keyed by name
+func LoadProviders(cfg *config.Config) map[string]*Provider {
+	providers := map[string]*Provider{}
+	if cfg.GoogleClientID != "" {
+		providers["google"] = NewOIDCProvider("google", "https://accounts.google.com",
+			cfg.GoogleClientID, cfg.GoogleClientSecret, nil)
+	}
+	if cfg.GitHubClientID != "" {
+		providers["github"] = NewGitHubProvider(cfg.GitHubClientID, cfg.GitHubClientSecret)
+	}
+	if cfg.OIDCIssuer != "" && cfg.OIDCClientID != "" {
+		providers[cfg.OIDCName] = NewOIDCProvider(cfg.OIDCName, cfg.OIDCIssuer,
+			cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCScopes)
+	}
+	return providers
+}
+
+// NewOIDCProvider configures an OpenID Connect provider from its issuer URL
+func NewOIDCProvider(name, issuer, clientID, clientSecret string, scopes []string) *Provider {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{
+		Name:          name,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		scopes:        scopes,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		fetchIdentity: fetchOIDCIdentity,
+		issuer:        strings.TrimRight(issuer, "/"),
+	}
+}
+
+// GeneratePKCE returns a random code verifier and its S256 code challenge
+func GeneratePKCE() (string, string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(bytes)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL builds the URL the browser is sent to in order to sign in
+func (p *Provider) AuthCodeURL(ctx context.Context, state, codeChallenge, redirectURI string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.clientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("scope", strings.Join(p.scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + params.Encode(), nil
+}
+
+// Exchange trades an authorization code for the user's identity
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (*Identity, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", p.clientID)
+	form.Set("client_secret", p.clientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := p.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange failed: %s", token.Error)
+	}
+
+	identity, err := p.fetchIdentity(ctx, p, token.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch identity: %w", err)
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("provider returned no subject")
+	}
+	return identity, nil
+}
+
+// discover fills in the endpoints of an OIDC provider from its discovery document
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.authURL != "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	if err := p.doJSON(req, &doc); err != nil {
+		return fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserInfoEndpoint == "" {
+		return errors.New("oidc discovery document is missing endpoints")
+	}
+
+	p.authURL = doc.AuthorizationEndpoint
+	p.tokenURL = doc.TokenEndpoint
+	p.userInfoURL = doc.UserInfoEndpoint
+	return nil
+}
+
+// getJSON performs an authenticated GET against a provider API
+func (p *Provider) getJSON(ctx context.Context, endpoint, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	return p.doJSON(req, out)
+}
+
+func (p *Provider) doJSON(req *http.Request, out interface{}) error {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %d", req.URL.Host, resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
+
+func fetchOIDCIdentity(ctx context.Context, p *Provider, accessToken string) (*Identity, error) {
+	var info struct {
+		Sub           string      `json:"sub"`
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"`
+		Name          string      `json:"name"`
+		Picture       string      `json:"picture"`
+	}
+	if err := p.getJSON(ctx, p.userInfoURL, accessToken, &info); err != nil {
+		return nil, err
+	}
+
+	// Some providers send email_verified as a string
+	verified := false
+	switch v := info.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+
+	return &Identity{
+		Subject:       info.Sub,
+		Email:         strings.ToLower(strings.TrimSpace(info.Email)),
+		EmailVerified: verified,
+		Name:          info.Name,
+		AvatarURL:     info.Picture,
+	}, nil
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// MemoryLimiter keeps state in process. It is fine for a single instance; use
+// PostgresLimiter when several API instances share traffic.
+type MemoryLimiter struct {
+	policy    Policy
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter(policy Policy) *MemoryLimiter {
+	return &MemoryLimiter{policy: policy, entries: map[string]*memoryEntry{}, lastSweep: time.Now()}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	if wait := time.Until(entry.blockedUntil); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+func (l *MemoryLimiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > l.policy.Window {
+		entry = &memoryEntry{}
+		l.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+
+	delay := l.policy.delayFor(entry.failures)
+	entry.blockedUntil = now.Add(delay)
+	return delay, nil
+}
+
+func (l *MemoryLimiter) Reset(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+	return nil
+}
+
+// sweep drops entries whose failures have aged out, at most once per window
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.policy.Window {
+		return
+	}
+	l.lastSweep = now
+	for key, entry := range l.entries {
+		if now.Sub(entry.lastFailure) > l.policy.Window && now.After(entry.blockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresLimiter keeps state in the login_throttles table so every API instance
+// sees the same counts. Keys from different limiters share the table, so callers
+// should namespace them.
+type PostgresLimiter struct {
+	db     *pgxpool.Pool
+	policy Policy
+}
+
+func NewPostgresLimiter(db *pgxpool.Pool, policy Policy) *PostgresLimiter {
+	return &PostgresLimiter{db: db, policy: policy}
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string) (time.Duration, error) {
+	var blockedUntil *time.Time
+	err := l.db.QueryRow(ctx,
+		`SELECT blocked_until FROM login_throttles WHERE key = $1`,
+		key,
+	).Scan(&blockedUntil)
+	if err == pgx.ErrNoRows || (err == nil && blockedUntil == nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if wait := time.Until(*blockedUntil); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Fail counts the failure and sets blocked_until in one upsert, so concurrent
+// failures for a key can't lose counts or shorten each other's delay
+func (l *PostgresLimiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	now := time.Now()
+
+	failures := `CASE WHEN login_throttles.last_failure_at < $3 THEN 1 ELSE login_throttles.failures + 1 END`
+	var blockedUntil time.Time
+	err := l.db.QueryRow(ctx,
+		`INSERT INTO login_throttles (key, failures, last_failure_at, blocked_until)
+		 VALUES ($1, 1, $2, $2 + `+delaySQL("1")+`)
+		 ON CONFLICT (key) DO UPDATE SET
+		     failures = `+failures+`,
+		     last_failure_at = $2,
+		     blocked_until = $2 + `+delaySQL(failures)+`
+		 RETURNING blocked_until`,
+		key, now, now.Add(-l.policy.Window),
+		l.policy.FreeAttempts, l.policy.BaseDelay.Seconds(), l.policy.MaxDelay.Seconds(),
+		l.policy.LockoutAfter, l.policy.LockoutDuration.Seconds(),
+	).Scan(&blockedUntil)
+	if err != nil {
+		return 0, err
+	}
+	return max(blockedUntil.Sub(now), 0), nil
+}
+
+// delaySQL is Policy.delayFor as an SQL interval over the failure count
+// expression f, reading the policy from parameters $4 to $8
+func delaySQL(f string) string {
+	return `(CASE
+		WHEN $7::int > 0 AND ` + f + ` >= $7::int THEN $8::float8
+		WHEN ` + f + ` <= $4::int THEN 0
+		ELSE LEAST($5::float8 * power(2, LEAST(` + f + ` - $4::int - 1, 62)), $6::float8)
+	END * interval '1 second')`
+}
+
+func (l *PostgresLimiter) Reset(ctx context.Context, key string) error {
+	_, err := l.db.Exec(ctx, `DELETE FROM login_throttles WHERE key = $1`, key)
+	return err
+}
+
+// Prune deletes rows whose failures have aged out and that are no longer blocked
+func (l *PostgresLimiter) Prune(ctx context.Context) error {
+	now := time.Now()
+	_, err := l.db.Exec(ctx,
+		`DELETE FROM login_throttles
+		 WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < $2)`,
+		now.Add(-l.policy.Window), now,
+	)
+	return err
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter tracks failed attempts per key (an IP, an email, ...) and decides how long
+// the key has to wait before trying again
+type Limiter interface {
+	// Allow returns zero if key may attempt now, or how long it must wait
+	Allow(ctx context.Context, key string) (time.Duration, error)
+	// Fail records a failed attempt and returns the wait it triggers, if any
+	Fail(ctx context.Context, key string) (time.Duration, error)
+	// Reset forgets a key's failures, e.g. after a successful login
+	Reset(ctx context.Context, key string) error
+}
+
+// Limits bundles the limiters applied to credential checks
+type Limits struct {
+	ByIP      Limiter
+	ByAccount Limiter
+}
+
+// Policy describes how failures turn into delays. The first FreeAttempts failures
+// cost nothing; after that each failure doubles the delay, starting at BaseDelay and
+// capped at MaxDelay. Reaching LockoutAfter failures locks the key for
+// LockoutDuration. Failures older than Window are forgotten.
+type Policy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+// AccountPolicy protects a single account from password guessing
+var AccountPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// IPPolicy is looser since many users can share an address
+var IPPolicy = Policy{
+	FreeAttempts:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutAfter:    100,
+	LockoutDuration: time.Hour,
+	Window:          time.Hour,
+}
+
+// delayFor returns how long a key with the given number of failures is blocked
+func (p Policy) delayFor(failures int) time.Duration {
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelayFor(t *testing.T) {
+	policy := Policy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second}, // capped at MaxDelay
+		{9, 10 * time.Second},
+		{10, 15 * time.Minute}, // locked out
+		{50, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.delayFor(tt.failures); got != tt.want {
+			t.Errorf("delayFor(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyDelayForWithoutLockout(t *testing.T) {
+	policy := Policy{FreeAttempts: 0, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{7, time.Minute},
+		{1000, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.delayFor(tt.failures); got != tt.want {
+			t.Errorf("delayFor(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLimiter(Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour})
+
+	if wait, _ := l.Allow(ctx, "a"); wait != 0 {
+		t.Fatalf("unknown key waits %v", wait)
+	}
+	if delay, _ := l.Fail(ctx, "a"); delay != 0 {
+		t.Fatalf("first failure delays %v, want 0", delay)
+	}
+	if delay, _ := l.Fail(ctx, "a"); delay != time.Minute {
+		t.Fatalf("second failure delays %v, want 1m", delay)
+	}
+	if wait, _ := l.Allow(ctx, "a"); wait <= 0 || wait > time.Minute {
+		t.Errorf("blocked key waits %v, want up to 1m", wait)
+	}
+	if wait, _ := l.Allow(ctx, "b"); wait != 0 {
+		t.Errorf("other key waits %v", wait)
+	}
+
+	l.Reset(ctx, "a")
+	if wait, _ := l.Allow(ctx, "a"); wait != 0 {
+		t.Errorf("reset key waits %v", wait)
+	}
+}
@@ -89,6 +89,18 @@ func (m *MinioClient) GetObject(ctx context.Context, objectKey string) (*minio.O
 	return m.client.GetObject(ctx, m.bucket, objectKey, minio.GetObjectOptions{})
 }
 
+// ListObjectKeys returns the keys of every object under prefix
+func (m *MinioClient) ListObjectKeys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for object := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		keys = append(keys, object.Key)
+	}
+	return keys, nil
+}
+
 // Bucket returns the bucket name
 func (m *MinioClient) Bucket() string {
 	return m.bucket
@@ -8,9 +8,11 @@ import (
 	"time"
 
 	"wakeup/api/internal/auth"
+	"wakeup/api/internal/middleware"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var upgrader = websocket.Upgrader{
@@ -29,9 +31,10 @@ type Event struct {
 
 // Client represents a single WebSocket connection
 type Client struct {
-	UserID uuid.UUID
-	Conn   *websocket.Conn
-	Send   chan []byte
+	UserID    uuid.UUID
+	SessionID uuid.UUID // login session the connecting access token belongs to
+	Conn      *websocket.Conn
+	Send      chan []byte
 }
 
 // Hub manages all active WebSocket connections
@@ -41,6 +44,7 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 	broadcast  chan *BroadcastMessage
+	disconnect chan *DisconnectRequest
 }
 
 // BroadcastMessage targets specific users
@@ -49,12 +53,21 @@ type BroadcastMessage struct {
 	Event   Event
 }
 
+// DisconnectRequest force-closes a user's connections opened from the given
+// login sessions, sending Event to each of them first
+type DisconnectRequest struct {
+	UserID     uuid.UUID
+	SessionIDs []uuid.UUID
+	Event      Event
+}
+
 func NewHub() *Hub {
 	return &Hub{
 		clients:    make(map[uuid.UUID]map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		broadcast:  make(chan *BroadcastMessage, 256),
+		disconnect: make(chan *DisconnectRequest, 64),
 	}
 }
 
@@ -102,6 +115,35 @@ func (h *Hub) Run() {
 				}
 			}
 			h.mu.RUnlock()
+
+		case req := <-h.disconnect:
+			data, err := json.Marshal(req.Event)
+			if err != nil {
+				continue
+			}
+			targets := make(map[uuid.UUID]bool, len(req.SessionIDs))
+			for _, sessionID := range req.SessionIDs {
+				targets[sessionID] = true
+			}
+			h.mu.Lock()
+			if clients, ok := h.clients[req.UserID]; ok {
+				for client := range clients {
+					if !targets[client.SessionID] {
+						continue
+					}
+					select {
+					case client.Send <- data:
+					default:
+					}
+					// Closing Send makes writePump flush the event and close the socket
+					delete(clients, client)
+					close(client.Send)
+				}
+				if len(clients) == 0 {
+					delete(h.clients, req.UserID)
+				}
+			}
+			h.mu.Unlock()
 		}
 	}
 }
@@ -114,6 +156,19 @@ func (h *Hub) Broadcast(userIDs []uuid.UUID, event Event) {
 	}
 }
 
+// DisconnectSessions closes every connection of userID that was opened with one
+// of the given login sessions, after delivering event to it
+func (h *Hub) DisconnectSessions(userID uuid.UUID, sessionIDs []uuid.UUID, event Event) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	h.disconnect <- &DisconnectRequest{
+		UserID:     userID,
+		SessionIDs: sessionIDs,
+		Event:      event,
+	}
+}
+
 // IsOnline checks if a user has active connections
 func (h *Hub) IsOnline(userID uuid.UUID) bool {
 	h.mu.RLock()
@@ -124,12 +179,13 @@ func (h *Hub) IsOnline(userID uuid.UUID) bool {
 
 // WSHandler handles WebSocket upgrade requests
 type WSHandler struct {
-	hub       *Hub
-	jwtSecret string
+	hub  *Hub
+	keys *auth.KeySet
+	db   *pgxpool.Pool
 }
 
-func NewWSHandler(hub *Hub, jwtSecret string) *WSHandler {
-	return &WSHandler{hub: hub, jwtSecret: jwtSecret}
+func NewWSHandler(hub *Hub, keys *auth.KeySet, db *pgxpool.Pool) *WSHandler {
+	return &WSHandler{hub: hub, keys: keys, db: db}
 }
 
 func (h *WSHandler) Connect(w http.ResponseWriter, r *http.Request) {
@@ -140,12 +196,23 @@ func (h *WSHandler) Connect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims, err := auth.ValidateAccessToken(token, h.jwtSecret)
+	claims, err := auth.ValidateAccessToken(token, h.keys)
 	if err != nil {
 		http.Error(w, "invalid token", http.StatusUnauthorized)
 		return
 	}
 
+	// A revoked session can't open new connections with its unexpired tokens
+	active, err := middleware.SessionActive(r.Context(), h.db, claims.UserID, claims.SessionID)
+	if err != nil {
+		http.Error(w, "failed to verify session", http.StatusInternalServerError)
+		return
+	}
+	if !active {
+		http.Error(w, "session revoked", http.StatusUnauthorized)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -153,9 +220,10 @@ func (h *WSHandler) Connect(w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := &Client{
-		UserID: claims.UserID,
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
+		UserID:    claims.UserID,
+		SessionID: claims.SessionID,
+		Conn:      conn,
+		Send:      make(chan []byte, 256),
 	}
 
 	h.hub.register <- client
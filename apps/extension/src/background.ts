@@ -1,12 +1,26 @@
-import { syncRules } from './shared/rules'
+import { syncRules, RULES_CHANGE_ALARM } from './shared/rules'
+import { connectEvents, disconnectEvents } from './shared/events'
 import { isConnected, getEnabled } from './shared/storage'
 
+// Sync now and keep listening for events that change the effective rules, or
+// stop listening when blocking is off or the extension isn't connected
+async function syncAndListen(): Promise<void> {
+  await syncRules()
+  if ((await isConnected()) && (await getEnabled())) {
+    await connectEvents(() => {
+      syncRules().catch((err) => console.error('Failed to sync block rules:', err))
+    })
+  } else {
+    disconnectEvents()
+  }
+}
+
 // Sync rules on startup
 chrome.runtime.onStartup.addListener(async () => {
   console.log('Extension starting up...')
   const connected = await isConnected()
   if (connected) {
-    await syncRules()
+    await syncAndListen()
   }
 })
 
@@ -19,17 +33,18 @@ chrome.runtime.onInstalled.addListener(async () => {
 
   const connected = await isConnected()
   if (connected) {
-    await syncRules()
+    await syncAndListen()
   }
 })
 
 // Handle alarm for periodic sync
 chrome.alarms.onAlarm.addListener(async (alarm) => {
-  if (alarm.name === 'syncRules') {
+  if (alarm.name === 'syncRules' || alarm.name === RULES_CHANGE_ALARM) {
     const connected = await isConnected()
     const enabled = await getEnabled()
     if (connected && enabled) {
-      await syncRules()
+      // Also reconnects the event stream if the worker was restarted
+      await syncAndListen()
     }
   }
 })
@@ -44,7 +59,7 @@ chrome.runtime.onMessage.addListener((message, _sender, sendResponse) => {
   }
 
   if (message.type === 'TOGGLE_ENABLED') {
-    syncRules()
+    syncAndListen()
       .then(() => sendResponse({ success: true }))
       .catch((err) => sendResponse({ success: false, error: err.message }))
     return true
@@ -1,5 +1,6 @@
 import { setTokens, setUser } from '../shared/storage'
 import { api } from '../shared/api'
+import { startPairing } from '../shared/pkce'
 import { syncRules } from '../shared/rules'
 
 const loadingEl = document.getElementById('loading')!
@@ -7,17 +8,18 @@ const successEl = document.getElementById('success')!
 const errorEl = document.getElementById('error')!
 const errorMessageEl = document.getElementById('error-message')!
 const noCodeEl = document.getElementById('no-code')!
+const enterCodeEl = document.getElementById('enter-code')!
+const codeForm = document.getElementById('code-form') as HTMLFormElement
+const codeInput = document.getElementById('code-input') as HTMLInputElement
 
-async function handleCodeExchange() {
-  // Get code from URL
-  const params = new URLSearchParams(window.location.search)
-  const code = params.get('code')
-
-  if (!code) {
-    loadingEl.style.display = 'none'
-    noCodeEl.style.display = 'block'
-    return
+function show(el: HTMLElement) {
+  for (const section of [loadingEl, successEl, errorEl, noCodeEl, enterCodeEl]) {
+    section.style.display = section === el ? 'block' : 'none'
   }
+}
+
+async function handleCodeExchange(code: string) {
+  show(loadingEl)
 
   try {
     // Exchange code for tokens
@@ -34,8 +36,7 @@ async function handleCodeExchange() {
     await syncRules()
 
     // Show success
-    loadingEl.style.display = 'none'
-    successEl.style.display = 'block'
+    show(successEl)
 
     // Close tab after a moment
     setTimeout(() => {
@@ -43,10 +44,34 @@ async function handleCodeExchange() {
     }, 2000)
   } catch (err) {
     console.error('Failed to exchange code:', err)
-    loadingEl.style.display = 'none'
-    errorEl.style.display = 'block'
+    show(errorEl)
     errorMessageEl.textContent = err instanceof Error ? err.message : 'Connection failed'
   }
 }
 
-handleCodeExchange()
+// Open the web app's connect page with a fresh PKCE challenge and wait for
+// the code it issues
+document.querySelectorAll('.connect-btn').forEach((btn) => {
+  btn.addEventListener('click', async () => {
+    const url = await startPairing()
+    await chrome.tabs.create({ url })
+    show(enterCodeEl)
+    codeInput.focus()
+  })
+})
+
+codeForm.addEventListener('submit', (e) => {
+  e.preventDefault()
+  const code = codeInput.value.trim()
+  if (code) {
+    handleCodeExchange(code)
+  }
+})
+
+// A code passed in the URL comes from a pairing this extension started
+const code = new URLSearchParams(window.location.search).get('code')
+if (code) {
+  handleCodeExchange(code)
+} else {
+  show(noCodeEl)
+}
@@ -7,6 +7,7 @@ const notConnectedEl = document.getElementById('not-connected')!
 const connectedEl = document.getElementById('connected')!
 const emailInput = document.getElementById('email-input') as HTMLInputElement
 const passwordInput = document.getElementById('password-input') as HTMLInputElement
+const codeInput = document.getElementById('code-input') as HTMLInputElement
 const loginBtn = document.getElementById('login-btn')!
 const loginErrorEl = document.getElementById('login-error')!
 const userStatusEl = document.getElementById('user-status')!
@@ -22,6 +23,9 @@ const disconnectBtn = document.getElementById('disconnect-btn')!
 let sessionTimer: ReturnType<typeof setInterval> | null = null
 let sessionStartTime: Date | null = null
 
+// Set while the login waits for a second factor
+let mfaToken: string | null = null
+
 // Initialize popup
 async function init() {
   const connected = await isConnected()
@@ -199,23 +203,44 @@ disconnectBtn.addEventListener('click', async () => {
   }
 })
 
+// Switch the login form between the password and the second-factor step
+function showCodeStep(token: string | null) {
+  mfaToken = token
+  emailInput.classList.toggle('hidden', token !== null)
+  passwordInput.classList.toggle('hidden', token !== null)
+  codeInput.classList.toggle('hidden', token === null)
+  codeInput.value = ''
+  loginBtn.textContent = token ? 'Verify' : 'Sign In'
+  if (token) codeInput.focus()
+}
+
 // Login handler
 loginBtn.addEventListener('click', async () => {
   const email = emailInput.value.trim()
   const password = passwordInput.value
+  const code = codeInput.value.trim()
 
-  if (!email || !password) {
-    loginErrorEl.textContent = 'Please enter email and password'
+  const missing = mfaToken ? !code : !email || !password
+  if (missing) {
+    loginErrorEl.textContent = mfaToken ? 'Please enter your code' : 'Please enter email and password'
     loginErrorEl.classList.remove('hidden')
     return
   }
 
-  loginBtn.textContent = 'Signing in...'
+  loginBtn.textContent = mfaToken ? 'Verifying...' : 'Signing in...'
   ;(loginBtn as HTMLButtonElement).disabled = true
   loginErrorEl.classList.add('hidden')
 
   try {
-    const response = await api.login(email, password)
+    const session = mfaToken ? await api.loginMFA(mfaToken, code) : await api.login(email, password)
+    if ('mfa_required' in session) {
+      showCodeStep(session.mfa_token)
+      return
+    }
+    showCodeStep(null)
+
+    // Keep only a scoped extension session, not the full login
+    const response = await api.pairWithSession(session)
 
     // Store tokens and user
     await setTokens({
@@ -234,17 +259,19 @@ loginBtn.addEventListener('click', async () => {
     loginErrorEl.textContent = err instanceof Error ? err.message : 'Login failed'
     loginErrorEl.classList.remove('hidden')
   } finally {
-    loginBtn.textContent = 'Sign In'
+    loginBtn.textContent = mfaToken ? 'Verify' : 'Sign In'
     ;(loginBtn as HTMLButtonElement).disabled = false
   }
 })
 
 // Allow Enter key to submit login
-passwordInput.addEventListener('keypress', (e) => {
-  if (e.key === 'Enter') {
-    loginBtn.click()
-  }
-})
+for (const input of [passwordInput, codeInput]) {
+  input.addEventListener('keypress', (e) => {
+    if (e.key === 'Enter') {
+      loginBtn.click()
+    }
+  })
+}
 
 // Initialize
 init()
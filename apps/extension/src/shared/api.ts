@@ -1,4 +1,5 @@
-import { getTokens, setTokens, clearTokens } from './storage'
+import { getTokens, setTokens, clearTokens, getPairingVerifier, clearPairingVerifier } from './storage'
+import { createChallenge, deviceName } from './pkce'
 
 const API_BASE = 'http://localhost:8080'
 
@@ -6,6 +7,38 @@ interface ApiError {
   error: string
 }
 
+interface AuthResponse {
+  access_token: string
+  refresh_token: string
+  user: { id: string; email: string; display_name: string }
+}
+
+// Login answers with this instead of tokens when the account has two-factor
+// authentication enabled
+export interface MFAChallenge {
+  mfa_required: true
+  mfa_token: string
+  expires_at: string
+}
+
+export interface EffectiveRule {
+  id: string
+  type: string
+  pattern: string
+  enabled: boolean
+}
+
+// The rules that apply right now. In allowlist mode every web page is
+// blocked unless an allowlist rule matches it.
+export interface EffectiveBlockRules {
+  mode: 'blocklist' | 'allowlist'
+  rules: EffectiveRule[]
+  allowlist: EffectiveRule[]
+  focus_active: boolean
+  evaluated_at: string
+  next_change_at?: string
+}
+
 class ApiClient {
   private async refreshAccessToken(): Promise<boolean> {
     const tokens = await getTokens()
@@ -35,6 +68,23 @@ class ApiClient {
   }
 
   async fetch<T>(path: string, options: RequestInit = {}): Promise<T> {
+    const response = await this.send(path, options)
+
+    if (!response.ok) {
+      const error: ApiError = await response.json().catch(() => ({ error: 'Request failed' }))
+      throw new Error(error.error)
+    }
+
+    if (response.status === 204) {
+      return undefined as T
+    }
+
+    return response.json()
+  }
+
+  // Make an authenticated request, refreshing the access token once if it has
+  // expired, and hand back the raw response
+  private async send(path: string, options: RequestInit = {}): Promise<Response> {
     const tokens = await getTokens()
 
     const headers: Record<string, string> = {
@@ -64,46 +114,87 @@ class ApiClient {
       }
     }
 
-    if (!response.ok) {
-      const error: ApiError = await response.json().catch(() => ({ error: 'Request failed' }))
-      throw new Error(error.error)
-    }
-
-    if (response.status === 204) {
-      return undefined as T
-    }
-
-    return response.json()
+    return response
   }
 
   // Auth
   async login(email: string, password: string) {
-    const response = await fetch(`${API_BASE}/auth/login`, {
+    return this.post<AuthResponse | MFAChallenge>('/auth/login', { email, password }, 'Login failed')
+  }
+
+  // Second login step: six digits are an authenticator code, anything else a
+  // recovery code
+  async loginMFA(mfaToken: string, code: string) {
+    const trimmed = code.trim()
+    const body = /^\d{6}$/.test(trimmed)
+      ? { mfa_token: mfaToken, code: trimmed }
+      : { mfa_token: mfaToken, recovery_code: trimmed }
+    return this.post<AuthResponse>('/auth/login/mfa', body, 'Verification failed')
+  }
+
+  // Trade the full session a password login returns for a scoped extension
+  // session: pair with it like the web app's connect page does, then sign the
+  // full session out so only the extension's tokens are kept
+  async pairWithSession(session: AuthResponse) {
+    try {
+      const { verifier, challenge } = await createChallenge()
+      const { code } = await this.post<{ code: string }>(
+        '/auth/extension/code',
+        { code_challenge: challenge, code_challenge_method: 'S256' },
+        'Pairing failed',
+        session.access_token
+      )
+      return await this.post<AuthResponse>(
+        '/auth/extension/exchange',
+        { code, code_verifier: verifier, device_name: deviceName() },
+        'Pairing failed'
+      )
+    } finally {
+      await this.post<void>('/auth/logout', { refresh_token: session.refresh_token }, 'Logout failed').catch(() => {})
+    }
+  }
+
+  // POST outside the stored tokens, for the sign-in steps
+  private async post<T>(path: string, body: unknown, fallbackError: string, accessToken?: string): Promise<T> {
+    const headers: Record<string, string> = { 'Content-Type': 'application/json' }
+    if (accessToken) {
+      headers['Authorization'] = `Bearer ${accessToken}`
+    }
+
+    const response = await fetch(`${API_BASE}${path}`, {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ email, password }),
+      headers,
+      body: JSON.stringify(body),
     })
 
     if (!response.ok) {
-      const error: ApiError = await response.json().catch(() => ({ error: 'Login failed' }))
+      const error: ApiError = await response.json().catch(() => ({ error: fallbackError }))
       throw new Error(error.error)
     }
 
-    return response.json() as Promise<{
-      access_token: string
-      refresh_token: string
-      user: { id: string; email: string; display_name: string }
-    }>
+    if (response.status === 204) {
+      return undefined as T
+    }
+
+    return response.json() as Promise<T>
   }
 
+  // Redeem a pairing code with the verifier of the pairing started here. The
+  // server burns the code on any attempt, so the verifier is dropped too.
   async exchangeCode(code: string) {
+    const verifier = await getPairingVerifier()
+    if (!verifier) {
+      throw new Error('No pairing in progress. Start connecting from the extension.')
+    }
+    await clearPairingVerifier()
+
     return this.fetch<{
       access_token: string
       refresh_token: string
       user: { id: string; email: string; display_name: string }
     }>('/auth/extension/exchange', {
       method: 'POST',
-      body: JSON.stringify({ code }),
+      body: JSON.stringify({ code, code_verifier: verifier, device_name: deviceName() }),
     })
   }
 
@@ -139,15 +230,32 @@ class ApiClient {
     }>('/focus/sessions/active')
   }
 
-  // Block Rules
-  async listBlockRules() {
-    return this.fetch<{
-      rules: Array<{
-        id: string
-        pattern: string
-        enabled: boolean
-      }>
-    }>('/block-rules')
+  // Block Rules: the ones that apply right now. Given the ETag of the last
+  // response, resolves to null when they haven't changed since.
+  async getEffectiveBlockRules(etag?: string | null): Promise<{ data: EffectiveBlockRules; etag: string | null } | null> {
+    const response = await this.send('/block-rules/effective', {
+      headers: etag ? { 'If-None-Match': etag } : {},
+    })
+
+    if (response.status === 304) {
+      return null
+    }
+
+    if (!response.ok) {
+      const error: ApiError = await response.json().catch(() => ({ error: 'Request failed' }))
+      throw new Error(error.error)
+    }
+
+    return { data: await response.json(), etag: response.headers.get('ETag') }
+  }
+
+  // Live events: the WebSocket URL for the current access token, refreshing
+  // it first when asked to, e.g. after the server turned a connection away
+  async eventsURL(refresh = false): Promise<string | null> {
+    if (refresh && !(await this.refreshAccessToken())) return null
+    const tokens = await getTokens()
+    if (!tokens?.accessToken) return null
+    return `${API_BASE.replace('http', 'ws')}/ws?token=${encodeURIComponent(tokens.accessToken)}`
   }
 }
 
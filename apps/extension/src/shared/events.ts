@@ -0,0 +1,61 @@
+import { api } from './api'
+
+// Events after which the effective block rules may differ: a focus session
+// started, changed phase, paused or ended, a scheduled block began, or the
+// rules themselves changed
+const RULE_EVENTS = new Set(['focus.phase_changed', 'focus.block_started', 'blockrules.changed'])
+
+const MAX_RETRY_DELAY = 5 * 60 * 1000
+
+let socket: WebSocket | null = null
+let retryDelay = 1000
+let retryTimer: ReturnType<typeof setTimeout> | undefined
+
+// Keep a WebSocket open to the API and call onChange whenever an event may
+// have changed the effective rules. Safe to call repeatedly; it only
+// connects when there is no open connection.
+export async function connectEvents(onChange: () => void, refresh = false): Promise<void> {
+  if (socket) return
+  clearTimeout(retryTimer)
+
+  const url = await api.eventsURL(refresh)
+  if (!url || socket) return
+
+  const ws = new WebSocket(url)
+  socket = ws
+  let opened = false
+
+  ws.onopen = () => {
+    opened = true
+    retryDelay = 1000
+    // Anything missed while disconnected
+    onChange()
+  }
+
+  ws.onmessage = (msg) => {
+    try {
+      const event = JSON.parse(msg.data)
+      if (RULE_EVENTS.has(event.type)) {
+        onChange()
+      }
+    } catch {
+      // Not an event
+    }
+  }
+
+  ws.onclose = () => {
+    if (socket !== ws) return
+    socket = null
+    // A connection turned away before opening most likely had an expired token
+    retryTimer = setTimeout(() => connectEvents(onChange, !opened), retryDelay)
+    retryDelay = Math.min(retryDelay * 2, MAX_RETRY_DELAY)
+  }
+}
+
+// Close the connection, e.g. when the extension is disconnected or disabled
+export function disconnectEvents(): void {
+  clearTimeout(retryTimer)
+  const ws = socket
+  socket = null
+  ws?.close()
+}
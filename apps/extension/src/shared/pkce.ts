@@ -0,0 +1,47 @@
+import { setPairingVerifier } from './storage'
+
+const WEB_BASE = 'http://localhost:3000'
+
+function base64Url(bytes: Uint8Array): string {
+  let binary = ''
+  for (const b of bytes) binary += String.fromCharCode(b)
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+}
+
+// A fresh PKCE verifier and its S256 challenge
+export async function createChallenge(): Promise<{ verifier: string; challenge: string }> {
+  const verifier = base64Url(crypto.getRandomValues(new Uint8Array(32)))
+  const digest = await crypto.subtle.digest('SHA-256', new TextEncoder().encode(verifier))
+  return { verifier, challenge: base64Url(new Uint8Array(digest)) }
+}
+
+// Start pairing: keep a fresh PKCE verifier and return the connect page URL
+// carrying its S256 challenge. Only this extension can redeem the code the
+// web app issues for it.
+export async function startPairing(): Promise<string> {
+  const { verifier, challenge } = await createChallenge()
+  await setPairingVerifier(verifier)
+
+  const params = new URLSearchParams({
+    code_challenge: challenge,
+    code_challenge_method: 'S256',
+  })
+  return `${WEB_BASE}/extension-connect?${params}`
+}
+
+// A name for this browser, shown in the account's device list
+export function deviceName(): string {
+  const ua = navigator.userAgent
+  const browser =
+    ua.includes('Edg/') ? 'Edge' :
+    ua.includes('Firefox/') ? 'Firefox' :
+    ua.includes('Chrome/') ? 'Chrome' :
+    'Browser'
+  const os =
+    ua.includes('Windows') ? 'Windows' :
+    ua.includes('Mac OS') ? 'macOS' :
+    ua.includes('CrOS') ? 'ChromeOS' :
+    ua.includes('Linux') ? 'Linux' :
+    ''
+  return os ? `WakeUp extension on ${browser} (${os})` : `WakeUp extension on ${browser}`
+}
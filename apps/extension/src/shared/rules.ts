@@ -1,50 +1,121 @@
-import { api } from './api'
-import { getEnabled, setLastRulesSync } from './storage'
+import { api, type EffectiveBlockRules } from './api'
+import { getEnabled, setLastRulesSync, getRulesETag, setRulesETag } from './storage'
 
 interface BlockRule {
   id: string
+  type: string
   pattern: string
   enabled: boolean
 }
 
-// Convert a pattern to DNR rule format
-function patternToDNRRule(pattern: string, id: number): chrome.declarativeNetRequest.Rule {
-  // Clean up pattern - remove protocol if present
-  let urlFilter = pattern
-    .replace(/^https?:\/\//, '')
-    .replace(/^www\./, '')
-
-  // If it's a simple domain, use requestDomains
-  const isDomain = /^[a-zA-Z0-9.-]+$/.test(urlFilter) && !urlFilter.includes('/')
-
-  if (isDomain) {
-    return {
-      id,
-      priority: 1,
-      action: { type: chrome.declarativeNetRequest.RuleActionType.BLOCK },
-      condition: {
-        requestDomains: [urlFilter],
-        resourceTypes: [
-          chrome.declarativeNetRequest.ResourceType.MAIN_FRAME,
-          chrome.declarativeNetRequest.ResourceType.SUB_FRAME,
-        ],
-      },
+// Alarm fired when the effective rules are next due to change
+export const RULES_CHANGE_ALARM = 'rulesChange'
+
+const resourceTypes = [
+  chrome.declarativeNetRequest.ResourceType.MAIN_FRAME,
+  chrome.declarativeNetRequest.ResourceType.SUB_FRAME,
+]
+
+// Any scheme, as the API's matcher ignores it
+const schemePrefix = '^[a-z][a-z0-9+.-]*://'
+
+function escapeRegex(s: string): string {
+  return s.replace(/[.*+?^${}()|[\]\\]/g, '\\$&')
+}
+
+// Translate a glob the way the API's matcher does: * is any run of
+// characters, ? one character and a backslash makes the next one literal
+function globToRegex(glob: string): string {
+  let out = ''
+  let escaped = false
+  for (const ch of glob) {
+    if (escaped) {
+      out += escapeRegex(ch)
+      escaped = false
+    } else if (ch === '\\') {
+      escaped = true
+    } else if (ch === '*') {
+      out += '.*'
+    } else if (ch === '?') {
+      out += '.'
+    } else {
+      out += escapeRegex(ch)
     }
   }
+  if (escaped) out += '\\\\'
+  return out
+}
+
+// Build the DNR condition for a rule. Patterns arrive normalized by the API.
+// Keyword rules match page titles, which DNR can't see, so they get none.
+function ruleCondition(rule: BlockRule): chrome.declarativeNetRequest.RuleCondition | null {
+  switch (rule.type) {
+    case 'domain_subdomains':
+      return { requestDomains: [rule.pattern], resourceTypes }
+    case 'domain':
+      // requestDomains also covers subdomains; the regex pins the exact host
+      return {
+        requestDomains: [rule.pattern],
+        regexFilter: `${schemePrefix}${escapeRegex(rule.pattern)}(:[0-9]+)?([/?#]|$)`,
+        resourceTypes,
+      }
+    case 'url_prefix':
+      // Stored as host without www., then path and query
+      return {
+        regexFilter: `${schemePrefix}(www\\.)?${urlPrefixRegex(rule.pattern)}`,
+        isUrlFilterCaseSensitive: false,
+        resourceTypes,
+      }
+    case 'glob':
+      return {
+        regexFilter: `${schemePrefix}${globToRegex(rule.pattern)}$`,
+        isUrlFilterCaseSensitive: false,
+        resourceTypes,
+      }
+    case 'regex':
+      return { regexFilter: rule.pattern, isUrlFilterCaseSensitive: false, resourceTypes }
+    default:
+      return null
+  }
+}
+
+// The host part of a URL prefix may carry a port in the page URL
+function urlPrefixRegex(pattern: string): string {
+  const slash = pattern.search(/[/?]/)
+  if (slash < 0) return escapeRegex(pattern)
+  return `${escapeRegex(pattern.slice(0, slash))}(:[0-9]+)?${escapeRegex(pattern.slice(slash))}`
+}
+
+// Allow rules outrank block rules, including the catch-all of allowlist mode
+const BLOCK_PRIORITY = 1
+const ALLOW_PRIORITY = 2
 
-  // Otherwise use urlFilter
-  return {
-    id,
-    priority: 1,
-    action: { type: chrome.declarativeNetRequest.RuleActionType.BLOCK },
-    condition: {
-      urlFilter: `*://*${urlFilter}*`,
-      resourceTypes: [
-        chrome.declarativeNetRequest.ResourceType.MAIN_FRAME,
-        chrome.declarativeNetRequest.ResourceType.SUB_FRAME,
-      ],
-    },
+// Convert rules to DNR rules with the given action, numbering them from
+// firstId and leaving out those DNR can't enforce: keywords and regexes its
+// RE2 subset rejects
+async function toDNRRules(
+  rules: BlockRule[],
+  type: chrome.declarativeNetRequest.RuleActionType,
+  priority: number,
+  firstId: number
+): Promise<chrome.declarativeNetRequest.Rule[]> {
+  const dnrRules: chrome.declarativeNetRequest.Rule[] = []
+  for (const rule of rules) {
+    const condition = ruleCondition(rule)
+    if (!condition) continue
+    if (rule.type === 'regex') {
+      const { isSupported } = await chrome.declarativeNetRequest.isRegexSupported({
+        regex: rule.pattern,
+        isCaseSensitive: false,
+      })
+      if (!isSupported) {
+        console.warn(`Skipping rule ${rule.id}: regex not supported by the browser`)
+        continue
+      }
+    }
+    dnrRules.push({ id: firstId + dnrRules.length, priority, action: { type }, condition })
   }
+  return dnrRules
 }
 
 // Fetch rules from API and apply them
@@ -56,7 +127,10 @@ export async function syncRules(): Promise<void> {
   const existingIds = existingRules.map((r) => r.id)
 
   if (!enabled) {
-    // Remove all rules when disabled
+    // Remove all rules when disabled, and their ETag with them so they are
+    // fetched in full when re-enabled
+    await chrome.alarms.clear(RULES_CHANGE_ALARM)
+    await setRulesETag(null)
     if (existingIds.length > 0) {
       await chrome.declarativeNetRequest.updateDynamicRules({
         removeRuleIds: existingIds,
@@ -65,18 +139,38 @@ export async function syncRules(): Promise<void> {
     return
   }
 
-  // Fetch rules from API
-  let rules: BlockRule[] = []
+  // Fetch the rules that apply right now; scoped rules come and go with
+  // focus sessions, time windows and schedules
+  let response: EffectiveBlockRules
+  let etag: string | null
   try {
-    const response = await api.listBlockRules()
-    rules = response.rules.filter((r) => r.enabled)
+    const result = await api.getEffectiveBlockRules(existingIds.length > 0 ? await getRulesETag() : null)
+    if (!result) {
+      // Unchanged; the applied rules and the alarm still hold
+      await setLastRulesSync(Date.now())
+      return
+    }
+    response = result.data
+    etag = result.etag
   } catch (err) {
     console.error('Failed to fetch block rules:', err)
     return
   }
 
-  // Convert to DNR format (start IDs at 1)
-  const dnrRules = rules.map((rule, index) => patternToDNRRule(rule.pattern, index + 1))
+  // IDs start at 1
+  const { BLOCK, ALLOW } = chrome.declarativeNetRequest.RuleActionType
+  const dnrRules = await toDNRRules(response.rules, BLOCK, BLOCK_PRIORITY, 1)
+  dnrRules.push(...(await toDNRRules(response.allowlist, ALLOW, ALLOW_PRIORITY, dnrRules.length + 1)))
+
+  // Allowlist mode blocks every web page that no allow rule lets through
+  if (response.mode === 'allowlist') {
+    dnrRules.push({
+      id: dnrRules.length + 1,
+      priority: BLOCK_PRIORITY,
+      action: { type: BLOCK },
+      condition: { regexFilter: '^https?://', resourceTypes },
+    })
+  }
 
   // Update rules
   await chrome.declarativeNetRequest.updateDynamicRules({
@@ -84,8 +178,15 @@ export async function syncRules(): Promise<void> {
     addRules: dnrRules,
   })
 
+  // Re-sync when a window or schedule boundary is reached
+  await chrome.alarms.clear(RULES_CHANGE_ALARM)
+  if (response.next_change_at) {
+    chrome.alarms.create(RULES_CHANGE_ALARM, { when: Date.parse(response.next_change_at) })
+  }
+
+  await setRulesETag(etag)
   await setLastRulesSync(Date.now())
-  console.log(`Synced ${dnrRules.length} block rules`)
+  console.log(`Synced ${dnrRules.length} block rules (${response.mode} mode)`)
 }
 
 // Clear all blocking rules
@@ -5,6 +5,8 @@ const KEYS = {
   USER: 'user',
   ENABLED: 'enabled',
   LAST_RULES_SYNC: 'lastRulesSyncAt',
+  RULES_ETAG: 'rulesETag',
+  PAIRING_VERIFIER: 'pairingVerifier',
 } as const
 
 export interface User {
@@ -71,6 +73,34 @@ export async function setLastRulesSync(timestamp: number): Promise<void> {
   await chrome.storage.local.set({ [KEYS.LAST_RULES_SYNC]: timestamp })
 }
 
+// ETag of the rules currently applied, to revalidate them with
+export async function getRulesETag(): Promise<string | null> {
+  const result = await chrome.storage.local.get(KEYS.RULES_ETAG)
+  return result[KEYS.RULES_ETAG] || null
+}
+
+export async function setRulesETag(etag: string | null): Promise<void> {
+  if (etag) {
+    await chrome.storage.local.set({ [KEYS.RULES_ETAG]: etag })
+  } else {
+    await chrome.storage.local.remove(KEYS.RULES_ETAG)
+  }
+}
+
+// PKCE verifier of the pairing in progress
+export async function getPairingVerifier(): Promise<string | null> {
+  const result = await chrome.storage.local.get(KEYS.PAIRING_VERIFIER)
+  return result[KEYS.PAIRING_VERIFIER] || null
+}
+
+export async function setPairingVerifier(verifier: string): Promise<void> {
+  await chrome.storage.local.set({ [KEYS.PAIRING_VERIFIER]: verifier })
+}
+
+export async function clearPairingVerifier(): Promise<void> {
+  await chrome.storage.local.remove(KEYS.PAIRING_VERIFIER)
+}
+
 // Check if connected
 export async function isConnected(): Promise<boolean> {
   const tokens = await getTokens()
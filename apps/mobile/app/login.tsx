@@ -5,14 +5,20 @@ import { Button } from '../src/components/Button'
 import { useAuth } from '../src/auth/AuthContext'
 
 export default function LoginScreen() {
-  const { login } = useAuth()
+  const { login, loginMFA } = useAuth()
   const [email, setEmail] = useState('')
   const [password, setPassword] = useState('')
+  const [mfaToken, setMfaToken] = useState<string | null>(null)
+  const [code, setCode] = useState('')
   const [isLoading, setIsLoading] = useState(false)
   const [error, setError] = useState<string | null>(null)
 
   const handleLogin = async () => {
-    if (!email || !password) {
+    if (mfaToken && !code.trim()) {
+      setError('Please enter your code')
+      return
+    }
+    if (!mfaToken && (!email || !password)) {
       setError('Please enter email and password')
       return
     }
@@ -21,7 +27,14 @@ export default function LoginScreen() {
     setError(null)
 
     try {
-      await login(email, password)
+      if (mfaToken) {
+        await loginMFA(mfaToken, code)
+      } else {
+        const challenge = await login(email, password)
+        if (challenge) {
+          setMfaToken(challenge.mfa_token)
+        }
+      }
     } catch (err) {
       console.error('Login failed:', err)
       setError(err instanceof Error ? err.message : 'Login failed')
@@ -42,26 +55,42 @@ export default function LoginScreen() {
             <Text color="$gray11">Focus & Productivity</Text>
           </YStack>
 
-          <YStack gap="$3">
-            <Input
-              placeholder="Email"
-              value={email}
-              onChangeText={setEmail}
-              autoCapitalize="none"
-              keyboardType="email-address"
-              autoComplete="email"
-              size="$4"
-            />
+          {mfaToken ? (
+            <YStack gap="$3">
+              <Text color="$gray11" textAlign="center">
+                Enter the code from your authenticator app or one of your recovery codes.
+              </Text>
+              <Input
+                placeholder="Code"
+                value={code}
+                onChangeText={setCode}
+                autoCapitalize="none"
+                autoComplete="one-time-code"
+                size="$4"
+              />
+            </YStack>
+          ) : (
+            <YStack gap="$3">
+              <Input
+                placeholder="Email"
+                value={email}
+                onChangeText={setEmail}
+                autoCapitalize="none"
+                keyboardType="email-address"
+                autoComplete="email"
+                size="$4"
+              />
 
-            <Input
-              placeholder="Password"
-              value={password}
-              onChangeText={setPassword}
-              secureTextEntry
-              autoComplete="password"
-              size="$4"
-            />
-          </YStack>
+              <Input
+                placeholder="Password"
+                value={password}
+                onChangeText={setPassword}
+                secureTextEntry
+                autoComplete="password"
+                size="$4"
+              />
+            </YStack>
+          )}
 
           {error && (
             <Text color="$red10" textAlign="center">
@@ -78,10 +107,10 @@ export default function LoginScreen() {
             {isLoading ? (
               <XStack gap="$2" alignItems="center">
                 <Spinner size="small" color="white" />
-                <Text color="white">Signing in...</Text>
+                <Text color="white">{mfaToken ? 'Verifying...' : 'Signing in...'}</Text>
               </XStack>
             ) : (
-              'Sign In'
+              mfaToken ? 'Verify' : 'Sign In'
             )}
           </Button>
 
@@ -1,5 +1,5 @@
-import { ApiClient, createApiClient } from '@wakeup/api-client'
-import type { AuthResponse } from '@wakeup/api-client'
+import { ApiClient, createApiClient, isMFAChallenge } from '@wakeup/api-client'
+import type { AuthResponse, LoginResponse } from '@wakeup/api-client'
 import { getTokens, setTokens, clearTokens } from '../auth/tokenStore'
 
 // API URL - configurable via environment variable
@@ -63,8 +63,28 @@ class MobileApiWrapper {
   }
 
   // Auth methods (no withAuth needed — these set tokens themselves)
-  async login(email: string, password: string): Promise<AuthResponse> {
+  /** Returns the MFA challenge as is when the account needs a second factor */
+  async login(email: string, password: string): Promise<LoginResponse> {
     const response = await this.client.login({ email, password })
+    if (isMFAChallenge(response)) {
+      return response
+    }
+    await setTokens({
+      accessToken: response.access_token,
+      refreshToken: response.refresh_token,
+    })
+    this.client.setAccessToken(response.access_token)
+    return response
+  }
+
+  /** Finish a two-step login with an authenticator code or a recovery code */
+  async loginMFA(mfaToken: string, code: string): Promise<AuthResponse> {
+    const trimmed = code.trim()
+    const response = await this.client.loginMFA(
+      /^\d{6}$/.test(trimmed)
+        ? { mfa_token: mfaToken, code: trimmed }
+        : { mfa_token: mfaToken, recovery_code: trimmed }
+    )
     await setTokens({
       accessToken: response.access_token,
       refreshToken: response.refresh_token,
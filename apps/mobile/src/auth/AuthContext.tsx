@@ -1,7 +1,7 @@
 import { createContext, useContext, useState, useEffect, useRef, useCallback, ReactNode } from 'react'
 import { useRouter, useSegments } from 'expo-router'
-import type { User } from '@wakeup/api-client'
-import { WakeupSocket } from '@wakeup/api-client'
+import type { MFAChallengeResponse, User } from '@wakeup/api-client'
+import { isMFAChallenge, WakeupSocket } from '@wakeup/api-client'
 import { api, API_URL } from '../api/client'
 import { getTokens, clearTokens } from './tokenStore'
 
@@ -12,7 +12,8 @@ interface AuthContextType {
   isLoading: boolean
   isAuthenticated: boolean
   socket: WakeupSocket | null
-  login: (email: string, password: string) => Promise<void>
+  login: (email: string, password: string) => Promise<MFAChallengeResponse | null>
+  loginMFA: (mfaToken: string, code: string) => Promise<void>
   register: (email: string, password: string, displayName: string) => Promise<void>
   logout: () => Promise<void>
 }
@@ -88,8 +89,22 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     }
   }
 
+  // Returns the challenge when the account needs a second factor
   async function login(email: string, password: string) {
     const response = await api.login(email, password)
+    if (isMFAChallenge(response)) {
+      return response
+    }
+    setUser(response.user)
+    const tokens = await getTokens()
+    if (tokens) {
+      connectWebSocket(tokens.accessToken)
+    }
+    return null
+  }
+
+  async function loginMFA(mfaToken: string, code: string) {
+    const response = await api.loginMFA(mfaToken, code)
     setUser(response.user)
     const tokens = await getTokens()
     if (tokens) {
@@ -120,6 +135,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
         isAuthenticated: !!user,
         socket,
         login,
+        loginMFA,
         register,
         logout,
       }}
@@ -1,5 +1,5 @@
 import { createContext, useContext, useState, useEffect, useCallback, useRef, type ReactNode } from 'react'
-import { createApiClient, WakeupSocket, type User, type ApiClient, type Message, type ChannelMessage } from '@wakeup/api-client'
+import { createApiClient, isMFAChallenge, WakeupSocket, type User, type ApiClient, type AuthResponse, type MFAChallengeResponse, type Message, type ChannelMessage } from '@wakeup/api-client'
 import { useSocialStore } from '../state/socialStore'
 import { useMessageStore } from '../state/messageStore'
 import { useNestStore } from '../state/nestStore'
@@ -14,7 +14,8 @@ interface AuthState {
 }
 
 interface AuthContextType extends AuthState {
-  login: (email: string, password: string) => Promise<void>
+  login: (email: string, password: string) => Promise<MFAChallengeResponse | null>
+  loginMFA: (mfaToken: string, code: string) => Promise<void>
   register: (email: string, password: string, displayName: string) => Promise<void>
   logout: () => Promise<void>
   updateUser: (user: User) => void
@@ -128,8 +129,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     return () => disconnectWebSocket()
   }, [loadUser, disconnectWebSocket])
 
-  const login = async (email: string, password: string) => {
-    const response = await api.login({ email, password })
+  const completeLogin = (response: AuthResponse) => {
     localStorage.setItem(TOKEN_KEY, response.access_token)
     localStorage.setItem(REFRESH_KEY, response.refresh_token)
     api.setAccessToken(response.access_token)
@@ -138,6 +138,28 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     initSocialData()
   }
 
+  // Returns the challenge when the account needs a second factor; pass its
+  // token to loginMFA with the code
+  const login = async (email: string, password: string) => {
+    const response = await api.login({ email, password })
+    if (isMFAChallenge(response)) {
+      return response
+    }
+    completeLogin(response)
+    return null
+  }
+
+  // Six digits are an authenticator code, anything else a recovery code
+  const loginMFA = async (mfaToken: string, code: string) => {
+    const trimmed = code.trim()
+    const response = await api.loginMFA(
+      /^\d{6}$/.test(trimmed)
+        ? { mfa_token: mfaToken, code: trimmed }
+        : { mfa_token: mfaToken, recovery_code: trimmed }
+    )
+    completeLogin(response)
+  }
+
   const register = async (email: string, password: string, displayName: string) => {
     const response = await api.register({ email, password, display_name: displayName })
     localStorage.setItem(TOKEN_KEY, response.access_token)
@@ -178,6 +200,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
         isLoading,
         isAuthenticated: !!user,
         login,
+        loginMFA,
         register,
         logout,
         updateUser,
@@ -11,12 +11,25 @@ export function ExtensionConnect() {
   const [code, setCode] = useState<string | null>(null)
   const [copied, setCopied] = useState(false)
 
+  // The extension opens this page with the challenge of the PKCE pair it holds
+  const params = new URLSearchParams(window.location.search)
+  const codeChallenge = params.get('code_challenge')
+  const challengeMethod = params.get('code_challenge_method')
+
   const handleGenerateCode = async () => {
+    if (!codeChallenge || challengeMethod !== 'S256') {
+      setError('Open this page from the extension by clicking Connect Account.')
+      return
+    }
+
     setIsLoading(true)
     setError(null)
 
     try {
-      const response = await api.extensionCode()
+      const response = await api.extensionCode({
+        code_challenge: codeChallenge,
+        code_challenge_method: 'S256',
+      })
       setCode(response.code)
     } catch (err) {
       console.error('Failed to generate code:', err)
@@ -73,7 +86,7 @@ export function ExtensionConnect() {
           <KeyRound size={32} />
           <H2>Your Connection Code</H2>
           <Text color="$gray11" textAlign="center">
-            Copy this code and paste it in the extension popup.
+            Copy this code and paste it in the extension tab that opened this page.
           </Text>
 
           <XStack width="100%" gap="$2">
@@ -92,7 +105,7 @@ export function ExtensionConnect() {
           </XStack>
 
           <Text fontSize="$2" color="$gray10" textAlign="center">
-            This code expires in 60 seconds. Click the extension icon and paste this code to connect.
+            This code expires in 60 seconds. Paste it in the extension tab to connect.
           </Text>
 
           <Button variant="outline" onPress={handleGenerateCode}>
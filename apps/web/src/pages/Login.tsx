@@ -71,9 +71,11 @@ const LinkText = styled(Text, {
 
 export function Login() {
   const navigate = useNavigate()
-  const { login } = useAuth()
+  const { login, loginMFA } = useAuth()
   const [email, setEmail] = useState('')
   const [password, setPassword] = useState('')
+  const [mfaToken, setMfaToken] = useState<string | null>(null)
+  const [code, setCode] = useState('')
   const [error, setError] = useState('')
   const [isLoading, setIsLoading] = useState(false)
 
@@ -83,7 +85,17 @@ export function Login() {
     setIsLoading(true)
 
     try {
-      await login(email, password)
+      if (mfaToken) {
+        await loginMFA(mfaToken, code)
+        navigate('/')
+        return
+      }
+
+      const challenge = await login(email, password)
+      if (challenge) {
+        setMfaToken(challenge.mfa_token)
+        return
+      }
       navigate('/')
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Login failed')
@@ -92,6 +104,58 @@ export function Login() {
     }
   }
 
+  const handleBack = () => {
+    setMfaToken(null)
+    setCode('')
+    setError('')
+  }
+
+  if (mfaToken) {
+    return (
+      <LoginContainer>
+        <LoginCard>
+          <YStack gap={8} marginBottom={8}>
+            <Title>Two-factor authentication</Title>
+            <Subtitle>Enter the code from your authenticator app or one of your recovery codes.</Subtitle>
+          </YStack>
+
+          <form onSubmit={handleSubmit}>
+            <YStack gap={20}>
+              <YStack>
+                <FormLabel>
+                  Code
+                  <Text color={discordColors.red}> *</Text>
+                </FormLabel>
+                <StyledInput
+                  id="code"
+                  value={code}
+                  onChangeText={setCode}
+                  autoComplete="one-time-code"
+                  autoFocus
+                />
+              </YStack>
+
+              {error && <ErrorText>{error}</ErrorText>}
+
+              <Button
+                onPress={handleSubmit as () => void}
+                disabled={isLoading || !code.trim()}
+                variant="primary"
+                fullWidth
+              >
+                {isLoading ? 'Verifying...' : 'Verify'}
+              </Button>
+
+              <LinkText onPress={handleBack} cursor="pointer">
+                Back to login
+              </LinkText>
+            </YStack>
+          </form>
+        </LoginCard>
+      </LoginContainer>
+    )
+  }
+
   return (
     <LoginContainer>
       <LoginCard>
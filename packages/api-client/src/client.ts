@@ -25,6 +25,26 @@ export interface LoginRequest {
   password: string
 }
 
+// Returned by login instead of tokens when the account has two-factor
+// authentication enabled. Finish signing in with loginMFA.
+export interface MFAChallengeResponse {
+  mfa_required: true
+  mfa_token: string
+  expires_at: string
+}
+
+export type LoginResponse = AuthResponse | MFAChallengeResponse
+
+export interface MFALoginRequest {
+  mfa_token: string
+  code?: string
+  recovery_code?: string
+}
+
+export function isMFAChallenge(response: LoginResponse): response is MFAChallengeResponse {
+  return 'mfa_required' in response && response.mfa_required
+}
+
 export interface RefreshRequest {
   refresh_token: string
 }
@@ -122,12 +142,20 @@ export interface UpdateProfileRequest {
 }
 
 // Extension auth types
+// The extension generates the PKCE pair; the web app only relays the challenge
+export interface ExtensionCodeRequest {
+  code_challenge: string
+  code_challenge_method: 'S256'
+}
+
 export interface ExtensionCodeResponse {
   code: string
 }
 
 export interface ExtensionExchangeRequest {
   code: string
+  code_verifier: string
+  device_name?: string
 }
 
 export interface ExtensionExchangeResponse {
@@ -335,10 +363,14 @@ export class ApiClient {
     return this.request('POST', '/auth/register', data)
   }
 
-  async login(data: LoginRequest): Promise<AuthResponse> {
+  async login(data: LoginRequest): Promise<LoginResponse> {
     return this.request('POST', '/auth/login', data)
   }
 
+  async loginMFA(data: MFALoginRequest): Promise<AuthResponse> {
+    return this.request('POST', '/auth/login/mfa', data)
+  }
+
   async refresh(data: RefreshRequest): Promise<AuthResponse> {
     return this.request('POST', '/auth/refresh', data)
   }
@@ -441,8 +473,8 @@ export class ApiClient {
   }
 
   // Extension Auth
-  async extensionCode(): Promise<ExtensionCodeResponse> {
-    return this.request('POST', '/auth/extension/code', undefined, true)
+  async extensionCode(data: ExtensionCodeRequest): Promise<ExtensionCodeResponse> {
+    return this.request('POST', '/auth/extension/code', data, true)
   }
 
   async extensionExchange(data: ExtensionExchangeRequest): Promise<ExtensionExchangeResponse> {
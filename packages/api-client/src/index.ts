@@ -2,6 +2,7 @@ export {
   ApiClient,
   ApiError,
   createApiClient,
+  isMFAChallenge,
   type ActiveSessionResponse,
   type AuthResponse,
   type BlockRule,
@@ -17,6 +18,7 @@ export {
   type CreateNestRequest,
   type DownloadUrlResponse,
   type ErrorResponse,
+  type ExtensionCodeRequest,
   type ExtensionCodeResponse,
   type ExtensionExchangeRequest,
   type ExtensionExchangeResponse,
@@ -27,9 +29,12 @@ export {
   type Friendship,
   type FriendsResponse,
   type LoginRequest,
+  type LoginResponse,
   type LogoutRequest,
   type Message,
   type MessagesResponse,
+  type MFAChallengeResponse,
+  type MFALoginRequest,
   type Nest,
   type NestChannel,
   type NestMember,